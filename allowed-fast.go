@@ -0,0 +1,72 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"net/netip"
+	"slices"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// The number of pieces we allow each peer to request while we choke it. BEP 6 suggests 10.
+const allowedFastSetSize = 10
+
+// Generates the canonical allowed fast set for a peer, using the algorithm given in BEP 6. BEP 6
+// only defines this for IPv4, so other addresses get no set.
+func allowedFastSet(ip netip.Addr, infoHash [20]byte, numPieces, k int) (ret []pieceIndex) {
+	ip = ip.Unmap()
+	if !ip.Is4() || numPieces <= 0 {
+		return nil
+	}
+	k = min(k, numPieces)
+	ip4 := ip.As4()
+	// Only the /24 is used, so a peer can't collect more pieces using neighbouring addresses.
+	ip4[3] = 0
+	x := append(ip4[:], infoHash[:]...)
+	for len(ret) < k {
+		sum := sha1.Sum(x)
+		x = sum[:]
+		for i := 0; i < 5 && len(ret) < k; i++ {
+			index := pieceIndex(binary.BigEndian.Uint32(x[i*4:]) % uint32(numPieces))
+			if !slices.Contains(ret, index) {
+				ret = append(ret, index)
+			}
+		}
+	}
+	return
+}
+
+// Tells the peer which pieces it may request while we choke it. This requires the info, and is
+// only done once.
+func (c *PeerConn) sendAllowedFastSet() {
+	if !c.fastEnabled() || !c.t.haveInfo() || !c.allowedFast.IsEmpty() {
+		return
+	}
+	ip, ok := netip.AddrFromSlice(c.remoteIp())
+	if !ok {
+		return
+	}
+	for _, i := range allowedFastSet(ip, c.t.InfoHash(), c.t.numPieces(), allowedFastSetSize) {
+		c.write(pp.Message{
+			Type:  pp.AllowedFast,
+			Index: pp.Integer(i),
+		})
+		c.allowedFast.Add(i)
+	}
+}
+
+// Whether we'll serve the request while choking the peer.
+func (c *PeerConn) requestAllowedFast(r Request) bool {
+	return c.fastEnabled() && c.allowedFast.Contains(pieceIndex(r.Index)) && c.uploadPossible()
+}
+
+func (c *PeerConn) peerSentAllowedFast(piece pieceIndex) {
+	if c.t.haveInfo() && piece >= c.t.numPieces() {
+		// BEP 6 says to ignore these, rather than treating them as an error.
+		torrent.Add("invalid allowed fasts received", 1)
+		return
+	}
+	c.peerAllowedFast.Add(piece)
+	c.updateRequests("PeerConn.mainReadLoop allowed fast")
+}
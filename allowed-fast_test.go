@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"net/netip"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// The example given in BEP 6.
+func TestAllowedFastSetBep6Example(t *testing.T) {
+	var ih [20]byte
+	for i := range ih {
+		ih[i] = 0xaa
+	}
+	ip := netip.MustParseAddr("80.4.4.200")
+	qt.Check(t, qt.DeepEquals(
+		allowedFastSet(ip, ih, 1313, 7),
+		[]pieceIndex{1059, 431, 808, 1217, 287, 376, 1188}))
+	qt.Check(t, qt.DeepEquals(
+		allowedFastSet(ip, ih, 1313, 9),
+		[]pieceIndex{1059, 431, 808, 1217, 287, 376, 1188, 353, 508}))
+	// Neighbours in the same /24 get the same set.
+	qt.Check(t, qt.DeepEquals(
+		allowedFastSet(netip.MustParseAddr("80.4.4.1"), ih, 1313, 7),
+		allowedFastSet(ip, ih, 1313, 7)))
+	qt.Check(t, qt.HasLen(allowedFastSet(ip, ih, 3, 10), 3))
+	qt.Check(t, qt.HasLen(allowedFastSet(netip.MustParseAddr("::2"), ih, 1313, 10), 0))
+}
+
+func TestServeAllowedFastRequestWhileChoking(t *testing.T) {
+	cl := newTestingClient(t)
+	cl.config.Seed = true
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	tor := cl.newTorrentForTesting()
+	tor.info = &metainfo.Info{PieceLength: 3 << 20}
+	pc.setTorrent(tor)
+	tor._completedPieces.Add(0)
+	tor._completedPieces.Add(1)
+	pc.PeerExtensionBytes.SetBit(pp.ExtensionBitFast, true)
+	pc.initMessageWriter()
+	qt.Assert(t, qt.IsTrue(pc.choking))
+	pc.allowedFast.Add(1)
+	req := Request{Index: 1}
+	req.Length = defaultChunkSize
+	qt.Check(t, qt.IsNil(pc.onReadRequest(req, false)))
+	qt.Check(t, qt.HasLen(pc.peerRequests, 1))
+	// Not allowed fast, so it's rejected.
+	req.Index = 0
+	qt.Check(t, qt.IsNil(pc.onReadRequest(req, false)))
+	qt.Check(t, qt.HasLen(pc.peerRequests, 1))
+	qt.Check(t, qt.Equals(pc.messageWriter.writeBuffer.Len(), 17))
+	qt.Check(t, qt.Equals(pc.Stats().AllowedFastCount, 1))
+}
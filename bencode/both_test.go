@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	qt "github.com/go-quicktest/qt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -74,3 +75,43 @@ func testFile(t *testing.T, filename string) {
 func TestBoth(t *testing.T) {
 	testFile(t, "testdata/archlinux-2011.08.19-netinstall-i686.iso.torrent")
 }
+
+func TestUnknownKeysRoundTrip(t *testing.T) {
+	type Embedded struct {
+		C int `bencode:"c"`
+	}
+	type known struct {
+		Embedded
+		A       int              `bencode:"a"`
+		E       string           `bencode:"e,omitempty"`
+		Unknown map[string]Bytes `bencode:",unknown"`
+	}
+	const input = "d1:ai1e1:bli2ee1:ci3e1:di4e1:fd1:xi5eee"
+	var k known
+	qt.Assert(t, qt.IsNil(Unmarshal([]byte(input), &k)))
+	qt.Check(t, qt.Equals(k.A, 1))
+	qt.Check(t, qt.Equals(k.C, 3))
+	qt.Check(t, qt.DeepEquals(k.Unknown, map[string]Bytes{
+		"b": Bytes("li2ee"),
+		"d": Bytes("i4e"),
+		"f": Bytes("d1:xi5ee"),
+	}))
+	b, err := Marshal(k)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), input))
+	// Fields take precedence over unknown keys with the same name.
+	k.Unknown["a"] = Bytes("i9e")
+	k.E = "x"
+	b, err = Marshal(k)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "d1:ai1e1:bli2ee1:ci3e1:di4e1:e1:x1:fd1:xi5eee"))
+}
+
+func TestUnknownKeysBadType(t *testing.T) {
+	var v struct {
+		Unknown []Bytes `bencode:",unknown"`
+	}
+	qt.Check(t, qt.IsNotNil(Unmarshal([]byte("d1:ai1ee"), &v)))
+	_, err := Marshal(v)
+	qt.Check(t, qt.IsNotNil(err))
+}
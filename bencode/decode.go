@@ -29,6 +29,8 @@ type Decoder struct {
 	// Sum of bytes used to Decode values.
 	Offset int64
 	buf    bytes.Buffer
+	// Containers that Token has returned the start of, innermost last.
+	tokenStack []tokenContainer
 }
 
 func (d *Decoder) Decode(v interface{}) (err error) {
@@ -66,6 +68,7 @@ func (d *Decoder) Decode(v interface{}) (err error) {
 	if !ok {
 		d.throwSyntaxError(d.Offset-1, errors.New("unexpected 'e'"))
 	}
+	d.tokenValueDone()
 	return
 }
 
@@ -321,7 +324,7 @@ func getDictField(dict reflect.Type, key reflect.Value) (_ dictField, err error)
 			// bencode tag.
 			panic(key)
 		}
-		return getStructFieldForKey(dict, key.String()), nil
+		return getStructFieldForKey(dict, key.String())
 		// if sf.r.PkgPath != "" {
 		//	panic(&UnmarshalFieldError{
 		//		Key:   key,
@@ -368,6 +371,9 @@ func parseStructFields(struct_ reflect.Type, each func(key string, df dictField)
 			continue
 		}
 		tag := parseTag(tagStr)
+		if tag.Unknown() {
+			continue
+		}
 		key := tag.Key()
 		if key == "" {
 			key = f.Name
@@ -386,7 +392,7 @@ func saveStructFields(struct_ reflect.Type) {
 	structFields[struct_] = m
 }
 
-func getStructFieldForKey(struct_ reflect.Type, key string) (f dictField) {
+func getStructFieldForKey(struct_ reflect.Type, key string) (f dictField, err error) {
 	structFieldsMu.Lock()
 	if _, ok := structFields[struct_]; !ok {
 		saveStructFields(struct_)
@@ -394,16 +400,39 @@ func getStructFieldForKey(struct_ reflect.Type, key string) (f dictField) {
 	f, ok := structFields[struct_][key]
 	structFieldsMu.Unlock()
 	if !ok {
+		if i := getUnknownKeysField(struct_); i >= 0 {
+			return unknownKeyField(struct_, i, key)
+		}
 		var discard interface{}
 		return dictField{
 			Type: reflect.TypeOf(discard),
 			Get:  func(reflect.Value) func(reflect.Value) { return func(reflect.Value) {} },
 			Tags: nil,
-		}
+		}, nil
 	}
 	return
 }
 
+// Returns a dict field that stores the key and its value in the struct's unknown keys field.
+func unknownKeyField(struct_ reflect.Type, fieldIndex int, key string) (dictField, error) {
+	mapType := struct_.Field(fieldIndex).Type
+	if !isUnknownKeysFieldType(mapType) {
+		return dictField{}, fmt.Errorf("unknown keys field has type %v, expected a map with string keys", mapType)
+	}
+	return dictField{
+		Type: mapType.Elem(),
+		Get: func(value reflect.Value) func(reflect.Value) {
+			return func(elem reflect.Value) {
+				m := value.Field(fieldIndex)
+				if m.IsNil() {
+					m.Set(reflect.MakeMap(mapType))
+				}
+				m.SetMapIndex(reflect.ValueOf(key).Convert(mapType.Key()), elem)
+			}
+		},
+	}, nil
+}
+
 var structKeyType = reflect.TypeFor[string]()
 
 func keyType(v reflect.Value) reflect.Type {
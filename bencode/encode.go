@@ -133,19 +133,7 @@ func (e *Encoder) reflectValue(v reflect.Value) {
 	case reflect.String:
 		e.reflectString(v.String())
 	case reflect.Struct:
-		e.writeString("d")
-		for _, ef := range getEncodeFields(v.Type()) {
-			fieldValue := ef.i(v)
-			if !fieldValue.IsValid() {
-				continue
-			}
-			if ef.omitEmpty && isEmptyValue(fieldValue) {
-				continue
-			}
-			e.reflectString(ef.tag)
-			e.reflectValue(fieldValue)
-		}
-		e.writeString("e")
+		e.reflectStruct(v)
 	case reflect.Map:
 		if v.Type().Key().Kind() != reflect.String {
 			panic(&MarshalTypeError{v.Type()})
@@ -178,6 +166,47 @@ func (e *Encoder) reflectValue(v reflect.Value) {
 	}
 }
 
+func (e *Encoder) reflectStruct(v reflect.Value) {
+	// Unknown keys are merged into the fields in key order. Fields take precedence.
+	var unknown reflect.Value
+	var unknownKeys stringValues
+	if i := getUnknownKeysField(v.Type()); i >= 0 {
+		unknown = v.Field(i)
+		if !isUnknownKeysFieldType(unknown.Type()) {
+			panic(&MarshalTypeError{unknown.Type()})
+		}
+		unknownKeys = stringValues(unknown.MapKeys())
+		sort.Sort(unknownKeys)
+	}
+	writeUnknownKeysBefore := func(key string) {
+		for len(unknownKeys) != 0 && unknownKeys.get(0) <= key {
+			if unknownKeys.get(0) != key {
+				e.reflectString(unknownKeys.get(0))
+				e.reflectValue(unknown.MapIndex(unknownKeys[0]))
+			}
+			unknownKeys = unknownKeys[1:]
+		}
+	}
+	e.writeString("d")
+	for _, ef := range getEncodeFields(v.Type()) {
+		writeUnknownKeysBefore(ef.tag)
+		fieldValue := ef.i(v)
+		if !fieldValue.IsValid() {
+			continue
+		}
+		if ef.omitEmpty && isEmptyValue(fieldValue) {
+			continue
+		}
+		e.reflectString(ef.tag)
+		e.reflectValue(fieldValue)
+	}
+	for i := range unknownKeys {
+		e.reflectString(unknownKeys.get(i))
+		e.reflectValue(unknown.MapIndex(unknownKeys[i]))
+	}
+	e.writeString("e")
+}
+
 func (e *Encoder) reflectSequence(v reflect.Value) {
 	// Use bencode string-type
 	if v.Type().Elem().Kind() == reflect.Uint8 {
@@ -278,7 +307,7 @@ func makeEncodeFields(t reflect.Type) (fs []encodeField) {
 		ef.tag = f.Name
 
 		tv := getTag(f.Tag)
-		if tv.Ignore() {
+		if tv.Ignore() || tv.Unknown() {
 			continue
 		}
 		if tv.Key() != "" {
@@ -3,6 +3,7 @@ package bencode
 import (
 	"reflect"
 	"strings"
+	"sync"
 )
 
 func getTag(st reflect.StructTag) tag {
@@ -42,3 +43,32 @@ func (me tag) OmitEmpty() bool {
 func (me tag) IgnoreUnmarshalTypeError() bool {
 	return me.HasOpt("ignore_unmarshal_type_error")
 }
+
+// The field collects the dict keys that don't match any other field.
+func (me tag) Unknown() bool {
+	return me.HasOpt("unknown")
+}
+
+var unknownKeysFields sync.Map // map[reflect.Type]int
+
+// Returns the index of the struct's field tagged to collect unknown dict keys, or -1. Fields of
+// embedded structs aren't considered.
+func getUnknownKeysField(struct_ reflect.Type) int {
+	if i, ok := unknownKeysFields.Load(struct_); ok {
+		return i.(int)
+	}
+	i := -1
+	for j := range struct_.NumField() {
+		f := struct_.Field(j)
+		if !f.Anonymous && getTag(f.Tag).Unknown() {
+			i = j
+			break
+		}
+	}
+	unknownKeysFields.Store(struct_, i)
+	return i
+}
+
+func isUnknownKeysFieldType(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String
+}
@@ -0,0 +1,171 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"runtime"
+	"strconv"
+)
+
+type TokenKind int
+
+const (
+	TokenDictStart TokenKind = iota + 1
+	TokenDictEnd
+	TokenListStart
+	TokenListEnd
+	TokenInt
+	TokenString
+)
+
+func (me TokenKind) String() string {
+	switch me {
+	case TokenDictStart:
+		return "dict start"
+	case TokenDictEnd:
+		return "dict end"
+	case TokenListStart:
+		return "list start"
+	case TokenListEnd:
+		return "list end"
+	case TokenInt:
+		return "int"
+	case TokenString:
+		return "string"
+	default:
+		return fmt.Sprintf("TokenKind(%d)", int(me))
+	}
+}
+
+// A lexical element of bencode, as returned by Decoder.Token.
+type Token struct {
+	Kind TokenKind
+	// The bytes of a string, or the decimal digits of an int.
+	Value []byte
+	// The offsets of the token in the input. Start is the offset of the first byte, and End is
+	// the offset after the last.
+	Start, End int64
+}
+
+// Parses the Value of an int token.
+func (me Token) Int() (int64, error) {
+	if me.Kind != TokenInt {
+		return 0, fmt.Errorf("token is a %v, not an int", me.Kind)
+	}
+	return strconv.ParseInt(bytesAsString(me.Value), 10, 64)
+}
+
+// A dict or list that Token has returned the start of.
+type tokenContainer struct {
+	dict bool
+	// The next item in the dict is a value.
+	value bool
+}
+
+// Returns the next token in the input, without decoding it into Go values. Dict keys must be
+// strings, and container ends must match, but dict key order isn't checked. io.EOF is returned if
+// the input ends between top-level values. Decode can be used to decode whole values between
+// calls to Token, such as the values in a dict.
+func (d *Decoder) Token() (tok Token, err error) {
+	tok.Start = d.Offset
+	b, err := d.r.ReadByte()
+	if err != nil {
+		if err == io.EOF && len(d.tokenStack) != 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	d.Offset++
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(runtime.Error); ok {
+			panic(r)
+		}
+		var ok bool
+		if err, ok = r.(error); !ok {
+			panic(r)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+	var top *tokenContainer
+	if len(d.tokenStack) != 0 {
+		top = &d.tokenStack[len(d.tokenStack)-1]
+	}
+	if top != nil && top.dict && !top.value && b != 'e' && (b < '0' || b > '9') {
+		d.throwSyntaxError(tok.Start, errors.New("non-string key in a dict"))
+	}
+	switch b {
+	case 'e':
+		if top == nil {
+			d.throwSyntaxError(tok.Start, errors.New("unexpected 'e'"))
+		}
+		if top.value {
+			d.throwSyntaxError(tok.Start, errors.New("dict elem missing value"))
+		}
+		tok.Kind = TokenListEnd
+		if top.dict {
+			tok.Kind = TokenDictEnd
+		}
+		d.tokenStack = d.tokenStack[:len(d.tokenStack)-1]
+		d.tokenValueDone()
+	case 'd':
+		tok.Kind = TokenDictStart
+		d.tokenStack = append(d.tokenStack, tokenContainer{dict: true})
+	case 'l':
+		tok.Kind = TokenListStart
+		d.tokenStack = append(d.tokenStack, tokenContainer{})
+	case 'i':
+		d.buf.Reset()
+		if err = d.readInt(); err != nil {
+			return
+		}
+		if _, ok := new(big.Int).SetString(d.buf.String(), 10); !ok {
+			d.throwSyntaxError(tok.Start, errors.New("failed to parse integer"))
+		}
+		tok.Kind = TokenInt
+		tok.Value = append([]byte(nil), d.buf.Bytes()...)
+		d.buf.Reset()
+		d.tokenValueDone()
+	default:
+		if b < '0' || b > '9' {
+			d.raiseUnknownValueType(b, tok.Start)
+		}
+		d.buf.Reset()
+		d.buf.WriteByte(b)
+		var length int
+		length, err = d.parseStringLength()
+		if err != nil {
+			return
+		}
+		tok.Kind = TokenString
+		tok.Value = make([]byte, length)
+		var n int
+		n, err = io.ReadFull(d.r, tok.Value)
+		d.Offset += int64(n)
+		if err != nil {
+			checkForUnexpectedEOF(err, d.Offset)
+			panic(err)
+		}
+		d.tokenValueDone()
+	}
+	tok.End = d.Offset
+	return
+}
+
+// Called after a complete value is read, to track whether a dict key or value is next.
+func (d *Decoder) tokenValueDone() {
+	if len(d.tokenStack) == 0 {
+		return
+	}
+	top := &d.tokenStack[len(d.tokenStack)-1]
+	if top.dict {
+		top.value = !top.value
+	}
+}
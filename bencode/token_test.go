@@ -0,0 +1,115 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+func TestToken(t *testing.T) {
+	const input = "d1:ai-3e1:bl3:fooi1eee"
+	d := NewDecoder(strings.NewReader(input))
+	var kinds []TokenKind
+	var values []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		qt.Assert(t, qt.IsNil(err))
+		kinds = append(kinds, tok.Kind)
+		values = append(values, string(tok.Value))
+		if tok.Kind == TokenString {
+			qt.Check(t, qt.Equals(input[tok.End-int64(len(tok.Value)):tok.End], string(tok.Value)))
+		}
+	}
+	qt.Check(t, qt.DeepEquals(kinds, []TokenKind{
+		TokenDictStart,
+		TokenString, TokenInt,
+		TokenString, TokenListStart, TokenString, TokenInt, TokenListEnd,
+		TokenDictEnd,
+	}))
+	qt.Check(t, qt.DeepEquals(values, []string{"", "a", "-3", "b", "", "foo", "1", "", ""}))
+	qt.Check(t, qt.Equals(d.Offset, int64(len(input))))
+}
+
+func TestTokenOffsets(t *testing.T) {
+	d := NewDecoder(strings.NewReader("li42e4:spame"))
+	var toks []Token
+	for range 4 {
+		tok, err := d.Token()
+		qt.Assert(t, qt.IsNil(err))
+		toks = append(toks, tok)
+	}
+	qt.Check(t, qt.DeepEquals(toks, []Token{
+		{Kind: TokenListStart, Start: 0, End: 1},
+		{Kind: TokenInt, Value: []byte("42"), Start: 1, End: 5},
+		{Kind: TokenString, Value: []byte("spam"), Start: 5, End: 11},
+		{Kind: TokenListEnd, Start: 11, End: 12},
+	}))
+	i, err := toks[1].Int()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(i, int64(42)))
+	_, err = toks[2].Int()
+	qt.Check(t, qt.IsNotNil(err))
+}
+
+func TestTokenThenDecode(t *testing.T) {
+	d := NewDecoder(strings.NewReader("d1:ali1ei2ee1:bi3ee"))
+	tok, err := d.Token()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(tok.Kind, TokenDictStart))
+	var values []any
+	for {
+		tok, err = d.Token()
+		qt.Assert(t, qt.IsNil(err))
+		if tok.Kind == TokenDictEnd {
+			break
+		}
+		qt.Assert(t, qt.Equals(tok.Kind, TokenString))
+		var v any
+		qt.Assert(t, qt.IsNil(d.Decode(&v)))
+		values = append(values, v)
+	}
+	qt.Check(t, qt.DeepEquals(values, []any{[]any{int64(1), int64(2)}, int64(3)}))
+	_, err = d.Token()
+	qt.Check(t, qt.Equals(err, io.EOF))
+}
+
+func TestTokenErrors(t *testing.T) {
+	for _, input := range []string{
+		"e",
+		"li1e",
+		"di1ei2ee",
+		"d1:ae",
+		"ldde",
+		"i1x",
+		"5:abc",
+		"x",
+	} {
+		d := NewDecoder(strings.NewReader(input))
+		var err error
+		for err == nil {
+			_, err = d.Token()
+		}
+		qt.Check(t, qt.Not(qt.Equals(err, io.EOF)), qt.Commentf("%q", input))
+	}
+}
+
+func TestTokenReencode(t *testing.T) {
+	data := loadFile("testdata/archlinux-2011.08.19-netinstall-i686.iso.torrent", t)
+	d := NewDecoder(bytes.NewReader(data))
+	var buf bytes.Buffer
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		qt.Assert(t, qt.IsNil(err))
+		buf.Write(data[tok.Start:tok.End])
+	}
+	qt.Check(t, qt.DeepEquals(buf.Bytes(), data))
+}
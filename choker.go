@@ -0,0 +1,338 @@
+package torrent
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/anacrolix/multiless"
+)
+
+const (
+	// How often upload slots are reassigned.
+	rechokeInterval = 10 * time.Second
+	// The optimistic unchoke rotates every this many rechokes.
+	optimisticUnchokeRechokes = 3
+	// A peer we're interested in that hasn't sent us anything useful for this long is snubbing us,
+	// and doesn't get a regular upload slot.
+	snubTimeout = time.Minute
+	// Upload quota a seeding peer gets before RoundRobinChoker rotates it out.
+	defaultRoundRobinQuota = 4 << 20
+)
+
+// A view of a peer connection that is competing for an upload slot.
+type ChokerPeer struct {
+	PeerConn *PeerConn
+	// We have no data left to download for the peer's torrent.
+	Seeding bool
+	// Bytes per second of useful data received from the peer since the last rechoke.
+	DownloadRate float64
+	// Bytes per second of data sent to the peer since the last rechoke.
+	UploadRate float64
+	// The peer currently holds an upload slot.
+	Unchoked bool
+	// When the peer was last unchoked. Zero if never.
+	LastUnchoked time.Time
+	// Bytes sent to the peer since it was last unchoked.
+	UploadedSinceUnchoke int64
+}
+
+// Decides which interested peers get upload slots. On each rechoke, peers are sorted with the most
+// deserving first, and the Client unchokes them in order until the slot limits in ClientConfig are
+// reached. Snubbed peers and the optimistic unchoke are handled by the Client and aren't passed to
+// the Choker.
+type Choker interface {
+	SortPeers(peers []ChokerPeer)
+}
+
+// The standard BitTorrent choker. Peers are ranked by how fast they upload to us, or when we're
+// seeding, by how fast we upload to them.
+type TitForTatChoker struct{}
+
+func (TitForTatChoker) SortPeers(peers []ChokerPeer) {
+	slices.SortStableFunc(peers, compareChokerPeersTitForTat)
+}
+
+func compareChokerPeersTitForTat(l, r ChokerPeer) int {
+	return multiless.New().Float64(
+		r.reciprocationRate(), l.reciprocationRate(),
+	).Bool(
+		// Prefer peers that already have slots to reduce churn.
+		r.Unchoked, l.Unchoked,
+	).OrderingInt()
+}
+
+func (me ChokerPeer) reciprocationRate() float64 {
+	if me.Seeding {
+		return me.UploadRate
+	}
+	return me.DownloadRate
+}
+
+// Ranks peers by how fast we upload to them regardless of whether we're seeding. This is
+// libtorrent's "fastest upload" seeding choker, and maximizes upload throughput.
+type FastestUploadChoker struct{}
+
+func (FastestUploadChoker) SortPeers(peers []ChokerPeer) {
+	slices.SortStableFunc(peers, func(l, r ChokerPeer) int {
+		return multiless.New().Float64(
+			r.UploadRate, l.UploadRate,
+		).Bool(
+			r.Unchoked, l.Unchoked,
+		).OrderingInt()
+	})
+}
+
+// Rotates upload slots between the peers of seeding torrents, so that every peer gets a turn. An
+// unchoked peer keeps its slot until it has received Quota bytes, and then goes to the back of the
+// queue behind peers that have waited longer. Peers of torrents that are still downloading are
+// ranked tit-for-tat. This is libtorrent's "round robin" seeding choker.
+type RoundRobinChoker struct {
+	// Bytes a peer may download per turn. Defaults to 4 MiB.
+	Quota int64
+}
+
+func (me RoundRobinChoker) quota() int64 {
+	if me.Quota != 0 {
+		return me.Quota
+	}
+	return defaultRoundRobinQuota
+}
+
+func (me RoundRobinChoker) SortPeers(peers []ChokerPeer) {
+	slices.SortStableFunc(peers, func(l, r ChokerPeer) int {
+		if !l.Seeding || !r.Seeding {
+			// Keep downloading torrents ahead, so round robin doesn't starve them of slots.
+			if l.Seeding != r.Seeding {
+				return multiless.New().Bool(l.Seeding, r.Seeding).OrderingInt()
+			}
+			return compareChokerPeersTitForTat(l, r)
+		}
+		lKeep := l.Unchoked && l.UploadedSinceUnchoke < me.quota()
+		rKeep := r.Unchoked && r.UploadedSinceUnchoke < me.quota()
+		return multiless.New().Bool(
+			rKeep, lKeep,
+		).CmpInt64(
+			// Longest waiting first.
+			l.LastUnchoked.Sub(r.LastUnchoked).Nanoseconds(),
+		).OrderingInt()
+	})
+}
+
+func (cfg *ClientConfig) choker() Choker {
+	if cfg.Choker != nil {
+		return cfg.Choker
+	}
+	return TitForTatChoker{}
+}
+
+// Per-connection state maintained by the Client's choker.
+type peerConnChokerState struct {
+	// The peer holds a regular upload slot.
+	uploadSlot bool
+	// The peer holds its torrent's optimistic unchoke.
+	optimistic bool
+
+	lastUnchoked          time.Time
+	bytesWrittenAtUnchoke int64
+
+	// Counters at the last rechoke, and the rates since then.
+	lastRechokeBytesRead    int64
+	lastRechokeBytesWritten int64
+	downloadRate            float64
+	uploadRate              float64
+}
+
+func (c *PeerConn) updateChokerRates(elapsed time.Duration) {
+	read := c._stats.BytesReadUsefulData.Int64()
+	written := c._stats.BytesWrittenData.Int64()
+	secs := elapsed.Seconds()
+	if secs > 0 {
+		c.choker.downloadRate = float64(read-c.choker.lastRechokeBytesRead) / secs
+		c.choker.uploadRate = float64(written-c.choker.lastRechokeBytesWritten) / secs
+	}
+	c.choker.lastRechokeBytesRead = read
+	c.choker.lastRechokeBytesWritten = written
+}
+
+// Whether we could upload to the peer if it had a slot.
+func (c *PeerConn) uploadPossible() bool {
+	if c.t.cl.config.NoUpload {
+		return false
+	}
+	if c.t.dataUploadDisallowed {
+		return false
+	}
+	if c.t.seeding() {
+		return true
+	}
+	// We don't upload after we're done unless we're seeding.
+	return c.t.needData()
+}
+
+func (c *PeerConn) wantsUploadSlot() bool {
+	return c.peerInterested && c.uploadPossible()
+}
+
+// The peer has stopped sending us data we asked for.
+func (c *PeerConn) snubbed() bool {
+	if !c.requestState.Interested || c.peerChoking {
+		return false
+	}
+	last := c.lastUsefulChunkReceived
+	if c.lastBecameInterested.After(last) {
+		last = c.lastBecameInterested
+	}
+	return time.Since(last) >= snubTimeout
+}
+
+func (c *PeerConn) chokerPeer() ChokerPeer {
+	return ChokerPeer{
+		PeerConn:             c,
+		Seeding:              !c.t.needData(),
+		DownloadRate:         c.choker.downloadRate,
+		UploadRate:           c.choker.uploadRate,
+		Unchoked:             c.choker.uploadSlot,
+		LastUnchoked:         c.choker.lastUnchoked,
+		UploadedSinceUnchoke: c._stats.BytesWrittenData.Int64() - c.choker.bytesWrittenAtUnchoke,
+	}
+}
+
+func (c *PeerConn) chokerStatus() string {
+	return fmt.Sprintf(
+		"slot: %v, optimistic: %v, snubbed: %v, dr: %.1f KiB/s, ur: %.1f KiB/s",
+		c.choker.uploadSlot,
+		c.choker.optimistic,
+		c.snubbed(),
+		c.choker.downloadRate/(1<<10),
+		c.choker.uploadRate/(1<<10),
+	)
+}
+
+// Gives up any upload slot. The writer will choke the peer.
+func (c *PeerConn) releaseUploadSlot() {
+	if !c.choker.uploadSlot && !c.choker.optimistic {
+		return
+	}
+	c.choker.uploadSlot = false
+	c.choker.optimistic = false
+	c.tickleWriter()
+}
+
+func (t *Torrent) numUploadSlots() (n int) {
+	for c := range t.conns {
+		if c.choker.uploadSlot {
+			n++
+		}
+	}
+	return
+}
+
+func (cl *Client) numUploadSlots() (n int) {
+	for t := range cl.torrents {
+		n += t.numUploadSlots()
+	}
+	return
+}
+
+func uploadSlotsFree(used, limit int) bool {
+	return limit == 0 || used < limit
+}
+
+// Unchokes a newly interested peer straight away if there's a free slot, rather than making it wait
+// for the next rechoke.
+func (cl *Client) maybeGrantUploadSlot(c *PeerConn) {
+	if c.choker.uploadSlot || c.choker.optimistic || !c.wantsUploadSlot() || c.snubbed() {
+		return
+	}
+	if !uploadSlotsFree(c.t.numUploadSlots(), cl.config.UploadSlotsPerTorrent) {
+		return
+	}
+	if !uploadSlotsFree(cl.numUploadSlots(), cl.config.UploadSlots) {
+		return
+	}
+	c.choker.uploadSlot = true
+	c.tickleWriter()
+}
+
+func (cl *Client) rechoker() {
+	for {
+		select {
+		case <-cl.closed.Done():
+			return
+		case <-time.After(rechokeInterval):
+		}
+		cl.lock()
+		cl.rechoke()
+		cl.unlock()
+	}
+}
+
+// Reassigns upload slots across all torrents. Must be called with the Client lock held.
+func (cl *Client) rechoke() {
+	now := time.Now()
+	elapsed := now.Sub(cl.lastRechoke)
+	cl.lastRechoke = now
+	rotateOptimistic := cl.rechokes%optimisticUnchokeRechokes == 0
+	cl.rechokes++
+	type prior struct{ uploadSlot, optimistic bool }
+	priors := make(map[*PeerConn]prior)
+	var candidates []ChokerPeer
+	for t := range cl.torrents {
+		for c := range t.conns {
+			priors[c] = prior{c.choker.uploadSlot, c.choker.optimistic}
+			c.updateChokerRates(elapsed)
+			if !c.wantsUploadSlot() {
+				c.choker.uploadSlot = false
+				c.choker.optimistic = false
+				continue
+			}
+			if rotateOptimistic {
+				c.choker.optimistic = false
+			}
+			if c.choker.optimistic || c.snubbed() {
+				c.choker.uploadSlot = false
+				continue
+			}
+			candidates = append(candidates, c.chokerPeer())
+		}
+	}
+	cl.config.choker().SortPeers(candidates)
+	torrentSlots := make(map[*Torrent]int)
+	total := 0
+	for _, cp := range candidates {
+		c := cp.PeerConn
+		c.choker.uploadSlot = uploadSlotsFree(torrentSlots[c.t], cl.config.UploadSlotsPerTorrent) &&
+			uploadSlotsFree(total, cl.config.UploadSlots)
+		if c.choker.uploadSlot {
+			torrentSlots[c.t]++
+			total++
+		}
+	}
+	if rotateOptimistic {
+		for t := range cl.torrents {
+			t.rotateOptimisticUnchoke()
+		}
+	}
+	for c, p := range priors {
+		if p != (prior{c.choker.uploadSlot, c.choker.optimistic}) {
+			c.tickleWriter()
+		}
+	}
+}
+
+// Gives the optimistic unchoke to a random interested peer that doesn't have a regular slot, so that
+// new peers get a chance to prove themselves.
+func (t *Torrent) rotateOptimisticUnchoke() {
+	var choked []*PeerConn
+	for c := range t.conns {
+		if c.wantsUploadSlot() && !c.choker.uploadSlot && !c.choker.optimistic {
+			choked = append(choked, c)
+		}
+	}
+	if len(choked) == 0 {
+		return
+	}
+	choked[rand.Intn(len(choked))].choker.optimistic = true
+}
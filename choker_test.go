@@ -0,0 +1,89 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+func TestTitForTatChokerOrder(t *testing.T) {
+	peers := []ChokerPeer{
+		{DownloadRate: 1, UploadRate: 30},
+		{DownloadRate: 3, UploadRate: 10},
+		{DownloadRate: 2, UploadRate: 20, Unchoked: true},
+		{DownloadRate: 2, UploadRate: 20},
+	}
+	TitForTatChoker{}.SortPeers(peers)
+	qt.Check(t, qt.DeepEquals(peers, []ChokerPeer{
+		{DownloadRate: 3, UploadRate: 10},
+		{DownloadRate: 2, UploadRate: 20, Unchoked: true},
+		{DownloadRate: 2, UploadRate: 20},
+		{DownloadRate: 1, UploadRate: 30},
+	}))
+	// Seeding, we rank on the rate we upload.
+	for i := range peers {
+		peers[i].Seeding = true
+	}
+	TitForTatChoker{}.SortPeers(peers)
+	qt.Check(t, qt.Equals(peers[0].UploadRate, 30))
+	qt.Check(t, qt.Equals(peers[3].UploadRate, 10))
+}
+
+func TestRoundRobinChokerRotates(t *testing.T) {
+	now := time.Now()
+	peers := []ChokerPeer{
+		{Seeding: true, Unchoked: true, UploadedSinceUnchoke: 2, LastUnchoked: now},
+		{Seeding: true, LastUnchoked: now.Add(-time.Minute)},
+		{Seeding: true, Unchoked: true, UploadedSinceUnchoke: 1, LastUnchoked: now},
+		{Seeding: true},
+		{DownloadRate: 1},
+	}
+	RoundRobinChoker{Quota: 2}.SortPeers(peers)
+	qt.Check(t, qt.DeepEquals(peers, []ChokerPeer{
+		{DownloadRate: 1},
+		{Seeding: true, Unchoked: true, UploadedSinceUnchoke: 1, LastUnchoked: now},
+		{Seeding: true},
+		{Seeding: true, LastUnchoked: now.Add(-time.Minute)},
+		{Seeding: true, Unchoked: true, UploadedSinceUnchoke: 2, LastUnchoked: now},
+	}))
+}
+
+func TestRechokeUploadSlots(t *testing.T) {
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.UploadSlotsPerTorrent = 2
+	var cl Client
+	cl.init(cfg)
+	cl.initLogger()
+	tor := cl.newTorrentForTesting()
+	cl.torrents[tor] = struct{}{}
+	var conns []*PeerConn
+	for i := range 4 {
+		c := cl.newConnection(nil, newConnectionOpts{network: "test"})
+		c.setTorrent(tor)
+		tor.conns[c] = struct{}{}
+		c.peerInterested = true
+		c._stats.BytesReadUsefulData.Add(int64(i))
+		conns = append(conns, c)
+	}
+	// The first interested peers get slots immediately, until they run out.
+	for _, c := range conns {
+		cl.maybeGrantUploadSlot(c)
+	}
+	qt.Check(t, qt.IsTrue(conns[0].uploadAllowed()))
+	qt.Check(t, qt.IsTrue(conns[1].uploadAllowed()))
+	qt.Check(t, qt.IsFalse(conns[2].uploadAllowed()))
+	cl.lastRechoke = time.Now().Add(-rechokeInterval)
+	cl.rechoke()
+	// The fastest peers get regular slots, and one of the others gets the optimistic unchoke.
+	qt.Check(t, qt.IsTrue(conns[3].choker.uploadSlot))
+	qt.Check(t, qt.IsTrue(conns[2].choker.uploadSlot))
+	qt.Check(t, qt.Equals(tor.numUploadSlots(), 2))
+	qt.Check(t, qt.IsTrue(conns[0].choker.optimistic || conns[1].choker.optimistic))
+	// Losing interest gives up the slot.
+	conns[3].peerInterested = false
+	cl.rechoke()
+	qt.Check(t, qt.IsFalse(conns[3].uploadAllowed()))
+	qt.Check(t, qt.Equals(tor.numUploadSlots(), 2))
+}
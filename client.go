@@ -34,11 +34,14 @@ import (
 	"github.com/dustin/go-humanize"
 	gbtree "github.com/google/btree"
 	"github.com/pion/webrtc/v4"
+	"golang.org/x/time/rate"
 
 	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/dialer"
 	"github.com/anacrolix/torrent/internal/check"
 	"github.com/anacrolix/torrent/internal/limiter"
 	"github.com/anacrolix/torrent/iplist"
+	"github.com/anacrolix/torrent/lsd"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/mse"
 	pp "github.com/anacrolix/torrent/peer_protocol"
@@ -71,8 +74,12 @@ type Client struct {
 	dialers        []Dialer
 	listeners      []Listener
 	dhtServers     []DhtServer
+	lsd            *lsd.Server
 	ipBlockList    iplist.Ranger
 
+	// File storage for each data directory given in AddTorrentOpts.DataDir.
+	dataDirStorages map[string]storage.ClientImpl
+
 	// Set of addresses that have our client ID. This intentionally will
 	// include ourselves if we end up trying to connect to our own address
 	// through legitimate channels.
@@ -99,6 +106,10 @@ type Client struct {
 	defaultLocalLtepProtocolMap LocalLtepProtocolMap
 
 	upnpMappings []*upnpMapping
+
+	// Upload slot assignment, see choker.go.
+	rechokes    int
+	lastRechoke time.Time
 }
 
 type ipStr string
@@ -223,15 +234,20 @@ func (cl *Client) init(cfg *ClientConfig) {
 		Transport: cfg.WebTransport,
 	}
 	if cl.httpClient.Transport == nil {
+		dialContext := cfg.HTTPDialContext
+		if cfg.proxyAll() {
+			dialContext = cfg.Proxy.DialContext
+		}
 		cl.httpClient.Transport = &http.Transport{
 			Proxy:       cfg.HTTPProxy,
-			DialContext: cfg.HTTPDialContext,
+			DialContext: dialContext,
 			// I think this value was observed from some webseeds. It seems reasonable to extend it
 			// to other uses of HTTP from the client.
 			MaxConnsPerHost: 10,
 		}
 	}
 	cl.defaultLocalLtepProtocolMap = makeBuiltinLtepProtocols(!cfg.DisablePEX)
+	cl.lastRechoke = time.Now()
 }
 
 // Creates a new Client. Takes ownership of the ClientConfig. Create another one if you want another
@@ -245,6 +261,7 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 	cl = &Client{}
 	cl.init(cfg)
 	go cl.acceptLimitClearer()
+	go cl.rechoker()
 	cl.initLogger()
 	//cl.logger.Levelf(log.Critical, "test after init")
 	defer func() {
@@ -266,6 +283,10 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 		storageImpl = storageImplCloser
 	}
 	cl.defaultStorage = storage.NewClient(storageImpl)
+	cl.dataDirStorages = make(map[string]storage.ClientImpl)
+	if cfg.DefaultStorage == nil {
+		cl.dataDirStorages[cfg.DataDir] = storageImpl
+	}
 
 	if cfg.PeerID != "" {
 		missinggo.CopyExact(&cl.peerID, cfg.PeerID)
@@ -300,13 +321,27 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 		s := _s // Go is fucking retarded.
 		cl.onClose = append(cl.onClose, func() { go s.Close() })
 		if peerNetworkEnabled(parseNetworkString(s.Addr().Network()), cl.config) {
-			cl.dialers = append(cl.dialers, s)
+			// Outgoing peer connections are only made through the proxy.
+			if cfg.Proxy == nil {
+				cl.dialers = append(cl.dialers, s)
+			}
 			cl.listeners = append(cl.listeners, s)
 			if cl.config.AcceptPeerConnections {
 				go cl.acceptConnections(s)
 			}
 		}
 	}
+	if cfg.Proxy != nil && peerNetworkEnabled(parseNetworkString("tcp"), cfg) {
+		cl.dialers = append(cl.dialers, NetworkDialer{
+			Network: "tcp",
+			Dialer:  cfg.Proxy,
+		})
+	}
+	if pl, ok := cfg.Proxy.(dialer.PacketListener); ok && peerNetworkEnabled(parseNetworkString("udp"), cfg) {
+		d := &proxyUtpDialer{proxy: pl}
+		cl.onClose = append(cl.onClose, func() { d.Close() })
+		cl.dialers = append(cl.dialers, d)
+	}
 
 	go cl.forwardPort()
 	if !cfg.NoDHT {
@@ -322,6 +357,10 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 		}
 	}
 
+	if cfg.LocalServiceDiscovery && !cfg.proxyAll() {
+		cl.startLsd()
+	}
+
 	cl.websocketTrackers = websocketTrackers{
 		PeerId: cl.peerID,
 		Logger: cl.logger.WithNames("websocketTrackers"),
@@ -341,7 +380,7 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 		Proxy:                      cl.config.HTTPProxy,
 		WebsocketTrackerHttpHeader: cl.config.WebsocketTrackerHttpHeader,
 		ICEServers:                 cl.ICEServers(),
-		DialContext:                cl.config.TrackerDialContext,
+		DialContext:                cl.trackerDialContext(),
 		callbacks:                  &cl.config.Callbacks,
 		OnConn: func(dc webtorrent.DataChannelConn, dcc webtorrent.DataChannelContext) {
 			cl.lock()
@@ -403,6 +442,11 @@ func (cl *Client) firewallCallback(net.Addr) bool {
 }
 
 func (cl *Client) listenOnNetwork(n network) bool {
+	// Incoming connections can't be made through the proxy, and the sockets would be used for
+	// DHT, bypassing it.
+	if cl.config.proxyAll() {
+		return false
+	}
 	if n.Ipv4 && cl.config.DisableIPv4 {
 		return false
 	}
@@ -1225,6 +1269,10 @@ func (pc *PeerConn) sendInitialMessages() {
 		})
 	}
 	func() {
+		if t.superSeedingActive() {
+			pc.startSuperSeeding()
+			return
+		}
 		if pc.fastEnabled() {
 			if t.haveAllPieces() {
 				pc.write(pp.Message{Type: pp.HaveAll})
@@ -1238,6 +1286,7 @@ func (pc *PeerConn) sendInitialMessages() {
 		}
 		pc.postBitfield()
 	}()
+	pc.sendAllowedFastSet()
 	if pc.PeerExtensionBytes.SupportsDHT() && cl.config.Extensions.SupportsDHT() && cl.haveDhtServer() {
 		pc.write(pp.Message{
 			Type: pp.Port,
@@ -1351,8 +1400,16 @@ func (cl *Client) newTorrentOpt(opts AddTorrentOpts) (t *Torrent) {
 	}
 	// use provided storage, if provided
 	storageClient := cl.defaultStorage
+	var dataDir string
+	if cl.config.DefaultStorage == nil {
+		dataDir = cl.config.DataDir
+	}
 	if opts.Storage != nil {
 		storageClient = storage.NewClient(opts.Storage)
+		dataDir = ""
+	} else if opts.DataDir != "" {
+		storageClient = storage.NewClient(cl.dataDirStorage(opts.DataDir))
+		dataDir = opts.DataDir
 	}
 
 	t = &Torrent{
@@ -1369,13 +1426,18 @@ func (cl *Client) newTorrentOpt(opts AddTorrentOpts) (t *Torrent) {
 		conns: make(map[*PeerConn]struct{}, 2*cl.config.EstablishedConnsPerTorrent),
 
 		storageOpener:       storageClient,
+		dataDir:             dataDir,
 		maxEstablishedConns: cl.config.EstablishedConnsPerTorrent,
 
 		metadataChanged: sync.Cond{
 			L: cl.locker(),
 		},
 		webSeeds:     make(map[string]*Peer),
+		httpSeeds:    make(map[string]*Peer),
 		gotMetainfoC: make(chan struct{}),
+
+		uploadRateLimiter:   cl.config.newUploadRateLimiter(rate.Inf),
+		downloadRateLimiter: newDownloadRateLimiter(rate.Inf),
 	}
 	var salt [8]byte
 	rand.Read(salt[:])
@@ -1397,6 +1459,22 @@ func (cl *Client) newTorrentOpt(opts AddTorrentOpts) (t *Torrent) {
 	return
 }
 
+// Returns file storage for the directory, shared by all the torrents using it, since the piece
+// completion database can only be opened once.
+func (cl *Client) dataDirStorage(dir string) storage.ClientImpl {
+	if s, ok := cl.dataDirStorages[dir]; ok {
+		return s
+	}
+	impl := storage.NewFile(dir)
+	cl.onClose = append(cl.onClose, func() {
+		if err := impl.Close(); err != nil {
+			cl.logger.Printf("error closing storage for %q: %s", dir, err)
+		}
+	})
+	cl.dataDirStorages[dir] = impl
+	return impl
+}
+
 // A file-like handle to some torrent data resource.
 type Handle interface {
 	io.Reader
@@ -1463,7 +1541,10 @@ func (cl *Client) AddTorrentOpt(opts AddTorrentOpts) (t *Torrent, new bool) {
 			go t.dhtAnnouncer(s)
 		}
 	})
-	cl.torrentsByShortHash[infoHash] = t
+	// A v2-only torrent has no v1 infohash, and is found by its truncated v2 infohash instead.
+	t.eachShortInfohash(func(short [20]byte) {
+		cl.torrentsByShortHash[short] = t
+	})
 	cl.torrents[t] = struct{}{}
 	t.setInfoBytesLocked(opts.InfoBytes)
 	cl.clearAcceptLimits()
@@ -1477,8 +1558,11 @@ type AddTorrentOpts struct {
 	InfoHash   infohash.T
 	InfoHashV2 g.Option[infohash_v2.T]
 	Storage    storage.ClientImpl
-	ChunkSize  pp.Integer
-	InfoBytes  []byte
+	// Stores data with file storage in this directory instead of the default storage. Ignored if
+	// Storage is set.
+	DataDir   string
+	ChunkSize pp.Integer
+	InfoBytes []byte
 }
 
 // Add or merge a torrent spec. Returns new if the torrent wasn't already in the client. See also
@@ -1525,6 +1609,9 @@ func (t *Torrent) MergeSpec(spec *TorrentSpec) error {
 	for _, url := range spec.Webseeds {
 		t.addWebSeed(url)
 	}
+	for _, url := range spec.HttpSeeds {
+		t.addHttpSeed(url)
+	}
 	for _, peerAddr := range spec.PeerAddrs {
 		t.addPeer(PeerInfo{
 			Addr:    StringAddr(peerAddr),
@@ -1701,8 +1788,16 @@ func (cl *Client) newConnection(nc net.Conn, opts newConnectionOpts) (c *PeerCon
 	c.logger = cl.logger.WithDefaultLevel(log.Warning).WithContextText(fmt.Sprintf("%T %p", c, c))
 	c.protocolLogger = c.logger.WithNames(protocolLoggingName)
 	c.setRW(connStatsReadWriter{nc, c})
+	c.uploadRateLimiter = cl.config.newUploadRateLimiter(rateLimitOrInf(cl.config.PeerUploadRateLimit))
+	c.downloadRateLimiter = newDownloadRateLimiter(rateLimitOrInf(cl.config.PeerDownloadRateLimit))
 	c.r = &rateLimitedReader{
-		l: cl.config.DownloadRateLimiter,
+		limiters: func() rateLimiters {
+			return rateLimiters{
+				cl.config.DownloadRateLimiter,
+				c.torrentDownloadRateLimiter.Load(),
+				c.downloadRateLimiter,
+			}
+		},
 		r: c.r,
 	}
 	c.logger.Levelf(
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"time"
 
 	"github.com/anacrolix/bargle"
 	"github.com/anacrolix/tagflag"
@@ -16,7 +22,7 @@ var builtinAnnounceList = [][]string{
 	{"udp://tracker.openbittorrent.com:6969/announce"},
 }
 
-func create() (cmd bargle.Command) {
+func create(ctx context.Context) (cmd bargle.Command) {
 	var args struct {
 		AnnounceList      []string `name:"a" help:"extra announce-list tier entry"`
 		EmptyAnnounceList bool     `name:"n" help:"exclude default announce-list entries"`
@@ -27,6 +33,24 @@ func create() (cmd bargle.Command) {
 		Url               []string `name:"u" help:"add webseed url"`
 		Private           *bool
 		Root              string `arg:"positional"`
+
+		V2     bool `help:"create a v2-only torrent (BEP 52)"`
+		Hybrid bool `help:"create a hybrid v1 and v2 torrent"`
+
+		Workers    int    `help:"number of pieces to hash concurrently (defaults to the number of CPUs)"`
+		Progress   bool   `help:"report hashing progress to stderr"`
+		Checkpoint string `help:"file to save hashing progress to, and resume from"`
+
+		Include    []string        `help:"only include files matching these globs"`
+		Exclude    []string        `help:"exclude files and directories matching these globs"`
+		SkipHidden bool            `help:"exclude files and directories starting with a dot"`
+		Symlinks   string          `help:"follow, skip, or store (as BEP 47 symlinks)" default:"follow"`
+		FileAttrs  bool            `help:"set BEP 47 executable and hidden file attributes"`
+		Pad        bool            `help:"align files to pieces with BEP 47 padding files"`
+		Sort       string          `help:"order files by path, or size (largest first)" default:"path"`
+		Source     string          `help:"set the info source field"`
+		Similar    []metainfo.Hash `help:"infohash of a torrent sharing files with this one (BEP 38)"`
+		Collection []string        `help:"collection this torrent belongs to (BEP 38)"`
 	}
 	cmd = bargle.FromStruct(&args)
 	cmd.Desc = "Creates a torrent metainfo for the file system rooted at ROOT, and outputs it to stdout"
@@ -52,11 +76,79 @@ func create() (cmd bargle.Command) {
 			PieceLength: args.PieceLength.Int64(),
 			Private:     args.Private,
 		}
-		err = info.BuildFromFilePath(args.Root)
+		opts := metainfo.BuildFromFilePathOpts{
+			V2:          args.V2,
+			Hybrid:      args.Hybrid,
+			Include:     args.Include,
+			Exclude:     args.Exclude,
+			SkipHidden:  args.SkipHidden,
+			FileAttrs:   args.FileAttrs,
+			PadFiles:    args.Pad,
+			Source:      args.Source,
+			Similar:     args.Similar,
+			Collections: args.Collection,
+		}
+		switch args.Symlinks {
+		case "follow":
+			opts.Symlinks = metainfo.SymlinksFollow
+		case "skip":
+			opts.Symlinks = metainfo.SymlinksSkip
+		case "store":
+			opts.Symlinks = metainfo.SymlinksAttr
+		default:
+			return fmt.Errorf("unknown symlinks policy %q", args.Symlinks)
+		}
+		switch args.Sort {
+		case "path":
+		case "size":
+			opts.FileOrder = func(l, r metainfo.FileInfo) int {
+				return cmp.Compare(r.Length, l.Length)
+			}
+		default:
+			return fmt.Errorf("unknown sort order %q", args.Sort)
+		}
+		opts.Workers = args.Workers
+		if args.Checkpoint != "" {
+			opts.Checkpoint, err = os.ReadFile(args.Checkpoint)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return
+			}
+		}
+		var lastProgress time.Time
+		opts.Progress = func(p metainfo.GeneratePiecesProgress) {
+			if time.Since(lastProgress) < time.Second && p.PiecesDone != p.NumPieces {
+				return
+			}
+			lastProgress = time.Now()
+			if args.Progress {
+				fmt.Fprintf(os.Stderr, "hashed %v/%v pieces (%v/%v bytes)\n",
+					p.PiecesDone, p.NumPieces, p.BytesDone, p.TotalBytes)
+			}
+			if args.Checkpoint != "" {
+				err := writeCheckpoint(args.Checkpoint, p.Checkpoint)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error writing checkpoint: %v\n", err)
+				}
+			}
+		}
+		mi.PieceLayers, err = info.BuildFromFilePathOpts(ctx, args.Root, opts)
 		if err != nil {
+			if args.Checkpoint != "" && len(info.Pieces) != 0 {
+				// Save everything that was hashed before the interruption.
+				writeCheckpoint(args.Checkpoint, info.Pieces)
+			}
 			return
 		}
+		if args.Checkpoint != "" {
+			os.Remove(args.Checkpoint)
+		}
 		if args.InfoName != nil {
+			if fi, err := os.Stat(args.Root); err == nil && !fi.IsDir() && info.HasV2() {
+				// Single file v2 trees are keyed by the name.
+				info.FileTree.Dir = map[string]metainfo.FileTree{
+					*args.InfoName: info.FileTree.Dir[info.Name],
+				}
+			}
 			info.Name = *args.InfoName
 		}
 		mi.InfoBytes, err = bencode.Marshal(info)
@@ -68,3 +160,13 @@ func create() (cmd bargle.Command) {
 	}
 	return
 }
+
+// Replaces the checkpoint file atomically, so an interruption can't leave it truncated.
+func writeCheckpoint(path string, pieces []byte) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, pieces, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anacrolix/bargle"
+	"github.com/dustin/go-humanize"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// A thin client for the daemon's API.
+type daemonClient struct {
+	// The daemon's API address, as passed to the daemon.
+	Addr string `default:"localhost:9092"`
+}
+
+func (me daemonClient) url(path string) string {
+	return "http://" + me.Addr + path
+}
+
+// Makes a request, and decodes any JSON response into out if it's not nil.
+func (me daemonClient) do(method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequest(method, me.url(path), body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (me daemonClient) doJson(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	return me.do(method, path, "application/json", body, out)
+}
+
+// Prints JSON responses indented.
+func printJson(v any) error {
+	je := json.NewEncoder(os.Stdout)
+	je.SetIndent("", "  ")
+	return je.Encode(v)
+}
+
+// Adds a magnet link, infohash or .torrent file.
+func (me daemonClient) add(arg string) (ret apiTorrent, err error) {
+	if strings.HasPrefix(arg, "magnet:") {
+		err = me.doJson(http.MethodPost, "/torrents", apiAddRequest{Uri: arg}, &ret)
+		return
+	}
+	var ih metainfo.Hash
+	if ih.FromHexString(arg) == nil {
+		err = me.doJson(http.MethodPost, "/torrents", apiAddRequest{InfoHash: arg}, &ret)
+		return
+	}
+	f, err := os.Open(arg)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	err = me.do(http.MethodPost, "/torrents", "application/x-bittorrent", f, &ret)
+	return
+}
+
+// Prints the daemon's server-sent events as they arrive.
+func (me daemonClient) events() error {
+	resp, err := http.Get(me.url("/events"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		if data, ok := strings.CutPrefix(s.Text(), "data: "); ok {
+			fmt.Println(data)
+		}
+	}
+	return s.Err()
+}
+
+// A subcommand taking a single infohash argument.
+func infoHashCmd(desc string, action func(ih string) error) bargle.Command {
+	var args struct {
+		InfoHash string `arg:"positional"`
+	}
+	cmd := bargle.FromStruct(&args)
+	cmd.Desc = desc
+	cmd.DefaultAction = func() error {
+		return action(args.InfoHash)
+	}
+	return cmd
+}
+
+func daemonClientCmd() bargle.Command {
+	c := daemonClient{}
+	cmd := bargle.FromStruct(&c)
+	cmd.Desc = "controls a running torrent daemon"
+	cmd.Positionals = append(cmd.Positionals,
+		bargle.Subcommand{Name: "list", Command: bargle.Command{
+			Desc: "lists torrents",
+			DefaultAction: func() error {
+				var ts []apiTorrent
+				err := c.doJson(http.MethodGet, "/torrents", nil, &ts)
+				if err != nil {
+					return err
+				}
+				for _, t := range ts {
+					state := "active"
+					if t.Paused {
+						state = "paused"
+					}
+					fmt.Printf("%s  %s/%s  %s  %q\n", t.InfoHash, humanize.Bytes(uint64(t.BytesCompleted)), humanize.Bytes(uint64(t.Length)), state, t.Name)
+				}
+				return nil
+			},
+		}},
+		bargle.Subcommand{Name: "add", Command: func() bargle.Command {
+			var args struct {
+				Torrent []string `arity:"+" help:"magnet link, infohash or torrent file path" arg:"positional"`
+			}
+			cmd := bargle.FromStruct(&args)
+			cmd.Desc = "adds torrents"
+			cmd.DefaultAction = func() error {
+				for _, arg := range args.Torrent {
+					t, err := c.add(arg)
+					if err != nil {
+						return fmt.Errorf("adding %q: %w", arg, err)
+					}
+					fmt.Println(t.InfoHash)
+				}
+				return nil
+			}
+			return cmd
+		}()},
+		bargle.Subcommand{Name: "remove", Command: infoHashCmd("drops a torrent", func(ih string) error {
+			return c.doJson(http.MethodDelete, "/torrents/"+ih, nil, nil)
+		})},
+		bargle.Subcommand{Name: "pause", Command: infoHashCmd("stops transferring data for a torrent", func(ih string) error {
+			return c.doJson(http.MethodPost, "/torrents/"+ih+"/pause", nil, nil)
+		})},
+		bargle.Subcommand{Name: "resume", Command: infoHashCmd("resumes a paused torrent", func(ih string) error {
+			return c.doJson(http.MethodPost, "/torrents/"+ih+"/resume", nil, nil)
+		})},
+		bargle.Subcommand{Name: "show", Command: infoHashCmd("shows a torrent and its files", func(ih string) error {
+			var t apiTorrent
+			err := c.doJson(http.MethodGet, "/torrents/"+ih, nil, &t)
+			if err != nil {
+				return err
+			}
+			return printJson(t)
+		})},
+		bargle.Subcommand{Name: "stats", Command: infoHashCmd("shows a torrent's stats", func(ih string) error {
+			var stats apiStats
+			err := c.doJson(http.MethodGet, "/torrents/"+ih+"/stats", nil, &stats)
+			if err != nil {
+				return err
+			}
+			return printJson(stats)
+		})},
+		bargle.Subcommand{Name: "priority", Command: func() bargle.Command {
+			var args struct {
+				InfoHash  string `arg:"positional"`
+				FileIndex int    `arg:"positional"`
+				Priority  string `arg:"positional" help:"none, normal or high"`
+			}
+			cmd := bargle.FromStruct(&args)
+			cmd.Desc = "sets the priority of a file"
+			cmd.DefaultAction = func() error {
+				return c.doJson(
+					http.MethodPut,
+					fmt.Sprintf("/torrents/%s/files/%d/priority", args.InfoHash, args.FileIndex),
+					map[string]string{"priority": args.Priority},
+					nil)
+			}
+			return cmd
+		}()},
+		bargle.Subcommand{Name: "events", Command: bargle.Command{
+			Desc: "prints status events as they happen",
+			DefaultAction: func() error {
+				return c.events()
+			},
+		}},
+	)
+	return cmd
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/httpstream"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/transmissionrpc"
+	"github.com/anacrolix/torrent/types"
+)
+
+type daemonCmd struct {
+	ApiAddr    string `default:"localhost:9092" help:"address to serve the HTTP API on"`
+	DataDir    string `help:"where torrent data is stored"`
+	SessionDir string `help:"torrents are saved here while running and on exit, and restored on start"`
+	Seed       bool   `default:"true"`
+}
+
+// Runs a Client until the context is done, controlled over HTTP. See daemonApi for the routes.
+func runDaemon(ctx context.Context, cmd daemonCmd) error {
+	api := &daemonApi{}
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = cmd.DataDir
+	cfg.Seed = cmd.Seed
+	cfg.Callbacks.StatusUpdated = append(cfg.Callbacks.StatusUpdated, api.events.publish)
+	cl, err := torrent.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("new torrent client: %w", err)
+	}
+	defer cl.Close()
+	api.cl = cl
+	api.dataDir = cfg.DataDir
+	if cmd.SessionDir != "" {
+		ts, err := cl.RestoreSession(cmd.SessionDir)
+		if err != nil {
+			log.Levelf(log.Warning, "restoring session: %v", err)
+		}
+		log.Levelf(log.Info, "restored %v torrents", len(ts))
+		defer func() {
+			err := cl.SaveSession(cmd.SessionDir)
+			if err != nil {
+				log.Levelf(log.Error, "saving session: %v", err)
+			}
+		}()
+		go saveSessionPeriodically(ctx, cl, cmd.SessionDir)
+	}
+	l, err := net.Listen("tcp", cmd.ApiAddr)
+	if err != nil {
+		return err
+	}
+	log.Levelf(log.Info, "serving api at http://%v", l.Addr())
+	s := http.Server{Handler: api.handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(shutdownCtx)
+	}()
+	err = s.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+func saveSessionPeriodically(ctx context.Context, cl *torrent.Client, dir string) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := cl.SaveSession(dir)
+		if err != nil {
+			log.Levelf(log.Warning, "saving session: %v", err)
+		}
+	}
+}
+
+// Fans out StatusUpdated events to subscribers. Events are dropped for subscribers that aren't
+// keeping up, since callbacks can't block.
+type eventBroker struct {
+	mu   sync.Mutex
+	subs map[chan torrent.StatusUpdatedEvent]struct{}
+}
+
+func (me *eventBroker) publish(ev torrent.StatusUpdatedEvent) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for ch := range me.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (me *eventBroker) subscribe() (ch chan torrent.StatusUpdatedEvent, unsubscribe func()) {
+	ch = make(chan torrent.StatusUpdatedEvent, 64)
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.subs == nil {
+		me.subs = make(map[chan torrent.StatusUpdatedEvent]struct{})
+	}
+	me.subs[ch] = struct{}{}
+	return ch, func() {
+		me.mu.Lock()
+		defer me.mu.Unlock()
+		delete(me.subs, ch)
+	}
+}
+
+// The daemon's HTTP API. Torrents are identified by infohash in hex. Requests and responses are
+// JSON, except that POST /torrents also accepts a .torrent file with Content-Type
+// application/x-bittorrent, and /events is a server-sent event stream. Transmission RPC clients
+// can use /transmission/rpc.
+type daemonApi struct {
+	cl      *torrent.Client
+	dataDir string
+	events  eventBroker
+}
+
+func (me *daemonApi) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /torrents", me.listTorrents)
+	mux.HandleFunc("POST /torrents", me.addTorrent)
+	mux.HandleFunc("GET /torrents/{infohash}", me.withTorrent(me.getTorrent))
+	mux.HandleFunc("DELETE /torrents/{infohash}", me.withTorrent(me.removeTorrent))
+	mux.HandleFunc("POST /torrents/{infohash}/pause", me.withTorrent(me.pauseTorrent))
+	mux.HandleFunc("POST /torrents/{infohash}/resume", me.withTorrent(me.resumeTorrent))
+	mux.HandleFunc("GET /torrents/{infohash}/stats", me.withTorrent(me.torrentStats))
+	mux.HandleFunc("PUT /torrents/{infohash}/files/{index}/priority", me.withTorrent(me.setFilePriority))
+	mux.HandleFunc("GET /events", me.streamEvents)
+	mux.Handle("/stream/", http.StripPrefix("/stream", &httpstream.Handler{Client: me.cl}))
+	mux.Handle("/transmission/rpc", &transmissionrpc.Handler{Client: me.cl, DownloadDir: me.dataDir})
+	return mux
+}
+
+type apiTorrent struct {
+	InfoHash       string    `json:"info_hash"`
+	Name           string    `json:"name"`
+	HaveInfo       bool      `json:"have_info"`
+	Length         int64     `json:"length,omitempty"`
+	BytesCompleted int64     `json:"bytes_completed"`
+	Paused         bool      `json:"paused"`
+	Files          []apiFile `json:"files,omitempty"`
+}
+
+type apiFile struct {
+	Path           string `json:"path"`
+	Length         int64  `json:"length"`
+	BytesCompleted int64  `json:"bytes_completed"`
+	Priority       string `json:"priority"`
+}
+
+type apiStats struct {
+	TotalPeers          int   `json:"total_peers"`
+	PendingPeers        int   `json:"pending_peers"`
+	ActivePeers         int   `json:"active_peers"`
+	ConnectedSeeders    int   `json:"connected_seeders"`
+	HalfOpenPeers       int   `json:"half_open_peers"`
+	PiecesComplete      int   `json:"pieces_complete"`
+	BytesReadUsefulData int64 `json:"bytes_read_useful_data"`
+	BytesWrittenData    int64 `json:"bytes_written_data"`
+}
+
+type apiEvent struct {
+	Event    torrent.StatusEvent `json:"event"`
+	Error    string              `json:"error,omitempty"`
+	PeerId   string              `json:"peer_id,omitempty"`
+	Url      string              `json:"url,omitempty"`
+	InfoHash string              `json:"info_hash,omitempty"`
+}
+
+type apiAddRequest struct {
+	// A magnet link.
+	Uri      string `json:"uri,omitempty"`
+	InfoHash string `json:"info_hash,omitempty"`
+}
+
+var priorityNames = map[types.PiecePriority]string{
+	types.PiecePriorityNone:      "none",
+	types.PiecePriorityNormal:    "normal",
+	types.PiecePriorityHigh:      "high",
+	types.PiecePriorityReadahead: "readahead",
+	types.PiecePriorityNext:      "next",
+	types.PiecePriorityNow:       "now",
+}
+
+// The priorities that can be set on files.
+var settablePriorities = map[string]types.PiecePriority{
+	"none":   types.PiecePriorityNone,
+	"normal": types.PiecePriorityNormal,
+	"high":   types.PiecePriorityHigh,
+}
+
+func makeApiTorrent(t *torrent.Torrent, withFiles bool) (ret apiTorrent) {
+	ret = apiTorrent{
+		InfoHash:       t.InfoHash().HexString(),
+		Name:           t.Name(),
+		BytesCompleted: t.BytesCompleted(),
+		Paused:         t.DataDownloadDisallowed(),
+	}
+	if t.Info() == nil {
+		return
+	}
+	ret.HaveInfo = true
+	ret.Length = t.Length()
+	if !withFiles {
+		return
+	}
+	for _, f := range t.Files() {
+		ret.Files = append(ret.Files, apiFile{
+			Path:           f.DisplayPath(),
+			Length:         f.Length(),
+			BytesCompleted: f.BytesCompleted(),
+			Priority:       priorityNames[f.Priority()],
+		})
+	}
+	return
+}
+
+func writeApiJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (me *daemonApi) withTorrent(f func(http.ResponseWriter, *http.Request, *torrent.Torrent)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ih metainfo.Hash
+		if err := ih.FromHexString(r.PathValue("infohash")); err != nil {
+			http.Error(w, "bad infohash", http.StatusBadRequest)
+			return
+		}
+		t, ok := me.cl.Torrent(ih)
+		if !ok {
+			http.Error(w, "torrent not found", http.StatusNotFound)
+			return
+		}
+		f(w, r, t)
+	}
+}
+
+func (me *daemonApi) listTorrents(w http.ResponseWriter, r *http.Request) {
+	ret := []apiTorrent{}
+	for _, t := range me.cl.Torrents() {
+		ret = append(ret, makeApiTorrent(t, false))
+	}
+	writeApiJson(w, ret)
+}
+
+func (me *daemonApi) addTorrent(w http.ResponseWriter, r *http.Request) {
+	t, err := me.addTorrentFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeApiJson(w, makeApiTorrent(t, false))
+}
+
+func (me *daemonApi) addTorrentFromRequest(r *http.Request) (*torrent.Torrent, error) {
+	if r.Header.Get("Content-Type") == "application/x-bittorrent" {
+		mi, err := metainfo.Load(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("loading metainfo: %w", err)
+		}
+		return me.cl.AddTorrent(mi)
+	}
+	var req apiAddRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, fmt.Errorf("decoding request: %w", err)
+	}
+	switch {
+	case req.Uri != "":
+		return me.cl.AddMagnet(req.Uri)
+	case req.InfoHash != "":
+		var ih metainfo.Hash
+		err := ih.FromHexString(req.InfoHash)
+		if err != nil {
+			return nil, fmt.Errorf("parsing infohash: %w", err)
+		}
+		t, _ := me.cl.AddTorrentInfoHash(ih)
+		return t, nil
+	default:
+		return nil, errors.New("no uri or info_hash")
+	}
+}
+
+func (me *daemonApi) getTorrent(w http.ResponseWriter, r *http.Request, t *torrent.Torrent) {
+	writeApiJson(w, makeApiTorrent(t, true))
+}
+
+func (me *daemonApi) removeTorrent(w http.ResponseWriter, r *http.Request, t *torrent.Torrent) {
+	t.Drop()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (me *daemonApi) pauseTorrent(w http.ResponseWriter, r *http.Request, t *torrent.Torrent) {
+	t.DisallowDataDownload()
+	t.DisallowDataUpload()
+	writeApiJson(w, makeApiTorrent(t, false))
+}
+
+func (me *daemonApi) resumeTorrent(w http.ResponseWriter, r *http.Request, t *torrent.Torrent) {
+	t.AllowDataDownload()
+	t.AllowDataUpload()
+	writeApiJson(w, makeApiTorrent(t, false))
+}
+
+func (me *daemonApi) torrentStats(w http.ResponseWriter, r *http.Request, t *torrent.Torrent) {
+	stats := t.Stats()
+	writeApiJson(w, apiStats{
+		TotalPeers:          stats.TotalPeers,
+		PendingPeers:        stats.PendingPeers,
+		ActivePeers:         stats.ActivePeers,
+		ConnectedSeeders:    stats.ConnectedSeeders,
+		HalfOpenPeers:       stats.HalfOpenPeers,
+		PiecesComplete:      stats.PiecesComplete,
+		BytesReadUsefulData: stats.BytesReadUsefulData.Int64(),
+		BytesWrittenData:    stats.BytesWrittenData.Int64(),
+	})
+}
+
+func (me *daemonApi) setFilePriority(w http.ResponseWriter, r *http.Request, t *torrent.Torrent) {
+	if t.Info() == nil {
+		http.Error(w, "torrent info not available yet", http.StatusConflict)
+		return
+	}
+	files := t.Files()
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(files) {
+		http.Error(w, "bad file index", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Priority string `json:"priority"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prio, ok := settablePriorities[req.Priority]
+	if !ok {
+		http.Error(w, "bad priority", http.StatusBadRequest)
+		return
+	}
+	files[index].SetPriority(prio)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (me *daemonApi) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := me.events.subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			b, err := json.Marshal(makeApiEvent(ev))
+			if err != nil {
+				panic(err)
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Event, b)
+			flusher.Flush()
+		}
+	}
+}
+
+func makeApiEvent(ev torrent.StatusUpdatedEvent) (ret apiEvent) {
+	ret = apiEvent{
+		Event:    ev.Event,
+		Url:      ev.Url,
+		InfoHash: ev.InfoHash,
+	}
+	if ev.Error != nil {
+		ret.Error = ev.Error.Error()
+	}
+	if ev.PeerId != (torrent.PeerID{}) {
+		ret.PeerId = fmt.Sprintf("%x", ev.PeerId[:])
+	}
+	return
+}
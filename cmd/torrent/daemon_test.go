@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func newTestDaemon(t *testing.T) (*daemonApi, daemonClient) {
+	api := &daemonApi{}
+	cfg := torrent.TestingConfig(t)
+	cfg.Callbacks.StatusUpdated = append(cfg.Callbacks.StatusUpdated, api.events.publish)
+	cl, err := torrent.NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	t.Cleanup(func() { cl.Close() })
+	api.cl = cl
+	api.dataDir = cfg.DataDir
+	srv := httptest.NewServer(api.handler())
+	t.Cleanup(srv.Close)
+	return api, daemonClient{Addr: strings.TrimPrefix(srv.URL, "http://")}
+}
+
+func writeTestTorrentFile(t *testing.T, mi *metainfo.MetaInfo) string {
+	name := filepath.Join(t.TempDir(), "test.torrent")
+	f, err := os.Create(name)
+	qt.Assert(t, qt.IsNil(err))
+	defer f.Close()
+	qt.Assert(t, qt.IsNil(mi.Write(f)))
+	return name
+}
+
+func TestDaemonAdd(t *testing.T) {
+	_, c := newTestDaemon(t)
+	mi := testutil.GreetingMetaInfo()
+	ih := mi.HashInfoBytes().HexString()
+
+	magnet, err := mi.MagnetV2()
+	qt.Assert(t, qt.IsNil(err))
+	added, err := c.add(magnet.String())
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(added.InfoHash, ih))
+
+	other := "0123456789abcdef0123456789abcdef01234567"
+	added, err = c.add(other)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(added.InfoHash, other))
+	qt.Check(t, qt.IsFalse(added.HaveInfo))
+
+	// Uploading the metainfo gives the magnet's torrent its info.
+	added, err = c.add(writeTestTorrentFile(t, mi))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(added.InfoHash, ih))
+	qt.Check(t, qt.IsTrue(added.HaveInfo))
+
+	var ts []apiTorrent
+	qt.Assert(t, qt.IsNil(c.doJson(http.MethodGet, "/torrents", nil, &ts)))
+	qt.Check(t, qt.HasLen(ts, 2))
+
+	err = c.doJson(http.MethodPost, "/torrents", apiAddRequest{}, nil)
+	qt.Check(t, qt.ErrorMatches(err, `400 Bad Request: no uri or info_hash`))
+	err = c.doJson(http.MethodPost, "/torrents", apiAddRequest{InfoHash: "nope"}, nil)
+	qt.Check(t, qt.ErrorMatches(err, `400 Bad Request: parsing infohash: .*`))
+}
+
+func TestDaemonFilePriority(t *testing.T) {
+	_, c := newTestDaemon(t)
+	mi := testutil.GreetingMetaInfo()
+	ih := mi.HashInfoBytes().HexString()
+	setPriority := func(index, prio string) error {
+		return c.doJson(
+			http.MethodPut,
+			"/torrents/"+ih+"/files/"+index+"/priority",
+			map[string]string{"priority": prio},
+			nil)
+	}
+
+	_, err := c.add(ih)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.ErrorMatches(setPriority("0", "high"), `409 Conflict: .*`))
+
+	_, err = c.add(writeTestTorrentFile(t, mi))
+	qt.Assert(t, qt.IsNil(err))
+
+	qt.Check(t, qt.ErrorMatches(setPriority("1", "high"), `400 Bad Request: bad file index`))
+	qt.Check(t, qt.ErrorMatches(setPriority("-1", "high"), `400 Bad Request: bad file index`))
+	qt.Check(t, qt.ErrorMatches(setPriority("x", "high"), `400 Bad Request: bad file index`))
+	// Readahead and above are only set by readers.
+	qt.Check(t, qt.ErrorMatches(setPriority("0", "now"), `400 Bad Request: bad priority`))
+	qt.Check(t, qt.ErrorMatches(setPriority("0", "urgent"), `400 Bad Request: bad priority`))
+	qt.Assert(t, qt.IsNil(setPriority("0", "high")))
+
+	var got apiTorrent
+	qt.Assert(t, qt.IsNil(c.doJson(http.MethodGet, "/torrents/"+ih, nil, &got)))
+	qt.Assert(t, qt.HasLen(got.Files, 1))
+	qt.Check(t, qt.Equals(got.Files[0].Priority, "high"))
+}
+
+func TestDaemonPauseResume(t *testing.T) {
+	_, c := newTestDaemon(t)
+	ih := testutil.GreetingMetaInfo().HashInfoBytes().HexString()
+	_, err := c.add(ih)
+	qt.Assert(t, qt.IsNil(err))
+
+	var got apiTorrent
+	qt.Assert(t, qt.IsNil(c.doJson(http.MethodPost, "/torrents/"+ih+"/pause", nil, &got)))
+	qt.Check(t, qt.IsTrue(got.Paused))
+	qt.Assert(t, qt.IsNil(c.doJson(http.MethodGet, "/torrents/"+ih, nil, &got)))
+	qt.Check(t, qt.IsTrue(got.Paused))
+	qt.Assert(t, qt.IsNil(c.doJson(http.MethodPost, "/torrents/"+ih+"/resume", nil, &got)))
+	qt.Check(t, qt.IsFalse(got.Paused))
+
+	qt.Check(t, qt.ErrorMatches(
+		c.doJson(http.MethodPost, "/torrents/0123456789abcdef0123456789abcdef01234567/pause", nil, nil),
+		`404 Not Found: torrent not found`))
+	qt.Check(t, qt.ErrorMatches(
+		c.doJson(http.MethodPost, "/torrents/nope/pause", nil, nil),
+		`400 Bad Request: bad infohash`))
+}
+
+func TestDaemonEvents(t *testing.T) {
+	api, c := newTestDaemon(t)
+	resp, err := http.Get(c.url("/events"))
+	qt.Assert(t, qt.IsNil(err))
+	defer resp.Body.Close()
+	qt.Assert(t, qt.Equals(resp.StatusCode, http.StatusOK))
+	qt.Check(t, qt.Equals(resp.Header.Get("Content-Type"), "text/event-stream"))
+	// The subscription is made before the headers are sent.
+	api.events.publish(torrent.StatusUpdatedEvent{
+		Event:    torrent.TrackerAnnounceSuccessful,
+		Url:      "http://tracker.example/announce",
+		InfoHash: "0123456789abcdef0123456789abcdef01234567",
+	})
+	s := bufio.NewScanner(resp.Body)
+	var lines []string
+	for len(lines) < 2 && s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	qt.Assert(t, qt.IsNil(s.Err()))
+	qt.Check(t, qt.DeepEquals(lines, []string{
+		"event: tracker_announce_successful",
+		`data: {"event":"tracker_announce_successful","url":"http://tracker.example/announce","info_hash":"0123456789abcdef0123456789abcdef01234567"}`,
+	}))
+}
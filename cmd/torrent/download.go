@@ -19,6 +19,7 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/dialer"
 	"github.com/anacrolix/torrent/iplist"
 	"github.com/anacrolix/torrent/metainfo"
 	pp "github.com/anacrolix/torrent/peer_protocol"
@@ -332,6 +333,7 @@ type DownloadCmd struct {
 	Quiet                          bool `help:"discard client logging"`
 	Stats                          bool `help:"print stats at termination"`
 	Dht                            bool `default:"true"`
+	Lsd                            bool `help:"find peers on the local network (BEP 14)"`
 	PortForward                    bool `default:"true"`
 	Verify                         bool `help:"verify data after adding torrent"`
 
@@ -347,6 +349,9 @@ type DownloadCmd struct {
 	Ipv6 bool `default:"true"`
 	Pex  bool `default:"true"`
 
+	Proxy          string `help:"make connections through a proxy, like socks5://host:1080 or http://host:3128"`
+	ProxyPeersOnly bool   `help:"only proxy outgoing peer connections, and keep listening, DHT and LSD"`
+
 	LinearDiscard bool     `help:"Read and discard selected regions from start to finish. Useful for testing simultaneous Reader and static file prioritization."`
 	TestPeer      []string `help:"addresses of some starting peers"`
 
@@ -367,6 +372,7 @@ func downloadErr(ctx context.Context, flags downloadFlags) error {
 	clientConfig.DisableIPv6 = !flags.Ipv6
 	clientConfig.DisableAcceptRateLimiting = true
 	clientConfig.NoDHT = !flags.Dht
+	clientConfig.LocalServiceDiscovery = flags.Lsd
 	clientConfig.Debug = flags.Debug
 	clientConfig.Seed = flags.Seed
 	clientConfig.PublicIp4 = flags.PublicIP.To4()
@@ -374,6 +380,14 @@ func downloadErr(ctx context.Context, flags downloadFlags) error {
 	clientConfig.DisablePEX = !flags.Pex
 	clientConfig.DisableWebtorrent = !flags.Webtorrent
 	clientConfig.NoDefaultPortForwarding = !flags.PortForward
+	if flags.Proxy != "" {
+		proxy, err := dialer.ParseProxyUrl(flags.Proxy)
+		if err != nil {
+			return fmt.Errorf("parsing proxy url: %w", err)
+		}
+		clientConfig.Proxy = proxy
+		clientConfig.ProxyPeersOnly = flags.ProxyPeersOnly
+	}
 	if flags.MaxAllocPeerRequestDataPerConn != nil {
 		clientConfig.MaxAllocPeerRequestDataPerConn = int(flags.MaxAllocPeerRequestDataPerConn.Int64())
 	}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type importCmd struct {
+	DataDir string `help:"where torrent data is stored" default:"."`
+	Link    bool   `help:"hard-link data into the data dir instead of copying it, so later writes to the torrent's files change the originals"`
+
+	Torrent string `arg:"positional" help:"the .torrent file"`
+	Dir     string `arg:"positional" help:"directory to search for existing data"`
+}
+
+// Puts data found in a directory into storage for a torrent, so it needn't be downloaded.
+func runImport(ctx context.Context, cmd importCmd) error {
+	mi, err := metainfo.LoadFromFile(cmd.Torrent)
+	if err != nil {
+		return fmt.Errorf("loading torrent: %w", err)
+	}
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = cmd.DataDir
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.NoDefaultPortForwarding = true
+	cfg.ListenPort = 0
+	cl, err := torrent.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("new torrent client: %w", err)
+	}
+	defer cl.Close()
+	t, err := cl.AddTorrent(mi)
+	if err != nil {
+		return err
+	}
+	imported, err := t.ImportData(ctx, cmd.Dir, torrent.ImportDataOpts{HardLink: cmd.Link})
+	for _, i := range imported {
+		how := "copied"
+		if i.Linked {
+			how = "linked"
+		}
+		fmt.Printf("%s %q from %q\n", how, i.File.DisplayPath(), i.Source)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v/%v files found, %v/%v bytes complete\n",
+		len(imported), len(t.Files()), t.BytesCompleted(), t.Length())
+	return nil
+}
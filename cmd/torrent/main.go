@@ -83,6 +83,15 @@ func mainErr(ctx context.Context) error {
 			}
 			return cmd
 		}()},
+		bargle.Subcommand{Name: "tracker", Command: func() bargle.Command {
+			var tc trackerCmd
+			cmd := bargle.FromStruct(&tc)
+			cmd.Desc = "serves UDP and HTTP trackers sharing one swarm store"
+			cmd.DefaultAction = func() error {
+				return runTracker(ctx, tc)
+			}
+			return cmd
+		}()},
 		bargle.Subcommand{Name: "download", Command: func() bargle.Command {
 			var dlc DownloadCmd
 			cmd := bargle.FromStruct(&dlc)
@@ -153,7 +162,26 @@ func mainErr(ctx context.Context) error {
 			Desc: "prints various protocol default version strings",
 		}},
 		bargle.Subcommand{Name: "serve", Command: serve()},
-		bargle.Subcommand{Name: "create", Command: create()},
+		bargle.Subcommand{Name: "create", Command: create(ctx)},
+		bargle.Subcommand{Name: "daemon", Command: func() bargle.Command {
+			var dc daemonCmd
+			cmd := bargle.FromStruct(&dc)
+			cmd.Desc = "runs a client controlled over an HTTP JSON API"
+			cmd.DefaultAction = func() error {
+				return runDaemon(ctx, dc)
+			}
+			return cmd
+		}()},
+		bargle.Subcommand{Name: "remote", Command: daemonClientCmd()},
+		bargle.Subcommand{Name: "import", Command: func() bargle.Command {
+			var ic importCmd
+			cmd := bargle.FromStruct(&ic)
+			cmd.Desc = "finds existing data for a torrent in a directory, regardless of file names"
+			cmd.DefaultAction = func() error {
+				return runImport(ctx, ic)
+			}
+			return cmd
+		}()},
 	)
 	// Well this sux, this old version of bargle doesn't return so we can let the gostdapp Context
 	// clean up.
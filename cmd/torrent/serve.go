@@ -10,6 +10,7 @@ import (
 
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/httpstream"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
 )
@@ -19,6 +20,10 @@ func serve() (cmd bargle.Command) {
 	cmd.Positionals = append(cmd.Positionals, &bargle.Positional{
 		Value: bargle.AutoUnmarshaler(&filePaths),
 	})
+	superSeed := false
+	superSeedFlag := bargle.NewFlag(&superSeed)
+	superSeedFlag.AddLong("super-seed")
+	cmd.Options = append(cmd.Options, superSeedFlag.Make())
 	cmd.Desc = "creates and seeds a torrent from a filepath"
 	cmd.DefaultAction = func() error {
 		cfg := torrent.NewDefaultClientConfig()
@@ -31,6 +36,7 @@ func serve() (cmd bargle.Command) {
 		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			cl.WriteStatus(w)
 		})
+		http.Handle("/stream/", http.StripPrefix("/stream", &httpstream.Handler{Client: cl}))
 		for _, filePath := range filePaths {
 			totalLength, err := totalLength(filePath)
 			if err != nil {
@@ -68,6 +74,7 @@ func serve() (cmd bargle.Command) {
 				}),
 			})
 			defer to.Drop()
+			to.SetSuperSeeding(superSeed)
 			err = to.MergeSpec(&torrent.TorrentSpec{
 				InfoBytes: mi.InfoBytes,
 				Trackers: [][]string{{
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/log"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/anacrolix/torrent/tracker"
+	httpTrackerServer "github.com/anacrolix/torrent/tracker/http/server"
+	trackerServer "github.com/anacrolix/torrent/tracker/server"
+	"github.com/anacrolix/torrent/tracker/udp"
+	udpTrackerServer "github.com/anacrolix/torrent/tracker/udp/server"
+	"github.com/anacrolix/torrent/types/infohash"
+	"github.com/anacrolix/torrent/version"
+)
+
+type trackerCmd struct {
+	UdpAddr          string   `default:":6969" help:"UDP tracker listen address, empty to disable"`
+	HttpAddr         string   `default:":6969" help:"HTTP tracker listen address, serving /announce and /scrape, empty to disable"`
+	AnnounceInterval int      `default:"300" help:"seconds between announces handed out to peers"`
+	Db               string   `help:"bolt database file to persist swarms in across restarts"`
+	Allowlist        string   `help:"file of hex info-hashes, one per line, that may be tracked"`
+	Upstream         []string `help:"upstream tracker URL to fetch peers from for sparse swarms"`
+}
+
+func runTracker(ctx context.Context, flags trackerCmd) error {
+	swarms := &trackerServer.InMemory{
+		AnnounceInterval: time.Duration(flags.AnnounceInterval) * time.Second,
+	}
+	if flags.Db != "" {
+		store, err := trackerServer.NewBoltSwarmStore(flags.Db)
+		if err != nil {
+			return fmt.Errorf("opening swarm store: %w", err)
+		}
+		defer store.Close()
+		swarms.Store = store
+	}
+	var announceTracker trackerServer.AnnounceTracker = swarms
+	if flags.Allowlist != "" {
+		allowed, err := readInfoHashAllowlist(flags.Allowlist)
+		if err != nil {
+			return fmt.Errorf("reading allowlist: %w", err)
+		}
+		log.Printf("allowing %v info-hashes", len(allowed))
+		announceTracker = allowlistAnnounceTracker{announceTracker, allowed}
+	}
+	handler := &trackerServer.AnnounceHandler{
+		AnnounceTracker:      announceTracker,
+		UpstreamAnnounceGate: &trackerServer.InMemoryUpstreamAnnounceGate{},
+	}
+	copy(handler.UpstreamAnnouncePeerId[:], version.DefaultBep20Prefix)
+	_, err := rand.Read(handler.UpstreamAnnouncePeerId[len(version.DefaultBep20Prefix):])
+	if err != nil {
+		return err
+	}
+	for _, url := range flags.Upstream {
+		cl, err := tracker.NewClient(url, tracker.NewClientOpts{})
+		if err != nil {
+			return fmt.Errorf("creating upstream tracker client for %q: %w", url, err)
+		}
+		defer cl.Close()
+		handler.UpstreamTrackers = append(handler.UpstreamTrackers, cl)
+		handler.UpstreamTrackerUrls = append(handler.UpstreamTrackerUrls, url)
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	// Servers block until their listeners are closed.
+	var closers []io.Closer
+	if flags.UdpAddr != "" {
+		// The address family in responses is determined by the socket, so use one for each.
+		for _, family := range []struct {
+			network string
+			udp.AddrFamily
+		}{
+			{"udp4", udp.AddrFamilyIpv4},
+			{"udp6", udp.AddrFamilyIpv6},
+		} {
+			pc, err := net.ListenPacket(family.network, flags.UdpAddr)
+			if err != nil {
+				log.Levelf(log.Warning, "not serving %v tracker: %v", family.network, err)
+				continue
+			}
+			log.Printf("serving %v tracker at %v", family.network, pc.LocalAddr())
+			defer pc.Close()
+			closers = append(closers, pc)
+			server := &udpTrackerServer.Server{
+				ConnTracker: &udpTrackerServer.InMemoryConnectionTracker{},
+				SendResponse: func(ctx context.Context, data []byte, addr net.Addr) (int, error) {
+					return pc.WriteTo(data, addr)
+				},
+				Announce: handler,
+			}
+			g.Go(func() error {
+				return udpTrackerServer.RunSimple(ctx, server, pc, family.AddrFamily)
+			})
+		}
+	}
+	if flags.HttpAddr != "" {
+		var mux http.ServeMux
+		mux.Handle("/announce", httpTrackerServer.Handler{Announce: handler})
+		mux.Handle("/scrape", httpTrackerServer.ScrapeHandler{AnnounceTracker: announceTracker})
+		l, err := net.Listen("tcp", flags.HttpAddr)
+		if err != nil {
+			return fmt.Errorf("listening for http: %w", err)
+		}
+		log.Printf("serving http tracker at %v", l.Addr())
+		server := &http.Server{Handler: &mux}
+		closers = append(closers, server)
+		g.Go(func() error {
+			return server.Serve(l)
+		})
+	}
+	go func() {
+		<-ctx.Done()
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	err = g.Wait()
+	// Servers return these when they're stopped for shutdown.
+	if errors.Is(err, http.ErrServerClosed) || errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return err
+}
+
+func readInfoHashAllowlist(path string) (ret map[trackerServer.InfoHash]struct{}, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	ret = make(map[trackerServer.InfoHash]struct{})
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var ih infohash.T
+		err = ih.FromHexString(line)
+		if err != nil {
+			err = fmt.Errorf("parsing %q: %w", line, err)
+			return
+		}
+		ret[ih] = struct{}{}
+	}
+	err = s.Err()
+	return
+}
+
+var errInfoHashNotAllowed = errors.New("info-hash not allowed")
+
+// Refuses announces for info-hashes that aren't allowed, and scrapes them as empty.
+type allowlistAnnounceTracker struct {
+	trackerServer.AnnounceTracker
+	allowed map[trackerServer.InfoHash]struct{}
+}
+
+func (me allowlistAnnounceTracker) TrackAnnounce(
+	ctx context.Context, req udp.AnnounceRequest, addr trackerServer.AnnounceAddr,
+) error {
+	if _, ok := me.allowed[req.InfoHash]; !ok {
+		return errInfoHashNotAllowed
+	}
+	return me.AnnounceTracker.TrackAnnounce(ctx, req, addr)
+}
+
+func (me allowlistAnnounceTracker) Scrape(
+	ctx context.Context, infoHashes []trackerServer.InfoHash,
+) (ret []udp.ScrapeInfohashResult, err error) {
+	var allowed []trackerServer.InfoHash
+	for _, ih := range infoHashes {
+		if _, ok := me.allowed[ih]; ok {
+			allowed = append(allowed, ih)
+		}
+	}
+	allowedResults, err := me.AnnounceTracker.Scrape(ctx, allowed)
+	if err != nil {
+		return
+	}
+	ret = make([]udp.ScrapeInfohashResult, 0, len(infoHashes))
+	for _, ih := range infoHashes {
+		var res udp.ScrapeInfohashResult
+		if _, ok := me.allowed[ih]; ok {
+			res, allowedResults = allowedResults[0], allowedResults[1:]
+		}
+		ret = append(ret, res)
+	}
+	return
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/pion/webrtc/v4"
 	"golang.org/x/time/rate"
 
+	"github.com/anacrolix/torrent/dialer"
 	"github.com/anacrolix/torrent/iplist"
 	"github.com/anacrolix/torrent/mse"
 	"github.com/anacrolix/torrent/storage"
@@ -45,14 +46,39 @@ type ClientDhtConfig struct {
 	DHTOnQuery func(query *krpc.Msg, source net.Addr) (propagate bool)
 }
 
+type ClientLsdConfig struct {
+	// Announce torrents and find peers on the local network with BEP 14 multicast.
+	LocalServiceDiscovery bool
+	// The interface to use for LocalServiceDiscovery. The system chooses if nil.
+	LocalServiceDiscoveryInterface *net.Interface
+}
+
+type ClientProxyConfig struct {
+	// Outgoing peer connections are made through this, such as a dialer.Socks5 or
+	// dialer.HttpConnect (see dialer.ParseProxyUrl). uTP goes through the proxy's UDP relay if it
+	// implements dialer.PacketListener, like dialer.Socks5, and is otherwise only used for incoming
+	// connections. WebRTC peers are disabled, since they would bypass the proxy. Unless
+	// ProxyPeersOnly is set, incoming connections, DHT, LSD and port forwarding are disabled too.
+	Proxy dialer.WithContext
+	// Only outgoing peer connections use Proxy, and incoming connections, DHT and LSD work as usual.
+	// Otherwise trackers, web seeds and other HTTP requests use it too. UDP trackers then need a
+	// Proxy that implements dialer.PacketListener, like dialer.Socks5.
+	ProxyPeersOnly bool
+}
+
 // Probably not safe to modify this after it's given to a Client.
 type ClientConfig struct {
 	ClientTrackerConfig
 	ClientDhtConfig
+	ClientLsdConfig
+	ClientProxyConfig
 
 	// Store torrent file data in this directory unless .DefaultStorage is
 	// specified.
 	DataDir string `long:"data-dir" description:"directory to store downloaded torrent data"`
+	// If set, torrents stored in DataDir are moved here when they complete. DataDir then only holds
+	// incomplete torrents. See Torrent.MoveStorage.
+	CompleteDataDir string
 	// The address to listen for new uTP and TCP BitTorrent protocol connections. DHT shares a UDP
 	// socket with uTP unless configured otherwise.
 	ListenHost              func(network string) string
@@ -79,8 +105,22 @@ type ClientConfig struct {
 	// buffer (~4096), and the requested chunk size (~16KiB, see TorrentSpec.ChunkSize). If limit is
 	// not Inf, and burst is left at 0, the implementation will choose a suitable burst.
 	DownloadRateLimiter *rate.Limiter
+	// Caps the chunk data uploaded to each peer, in bytes per second, in addition to the Client and
+	// Torrent limits. Unlimited if zero. See also PeerConn.SetUploadRateLimit.
+	PeerUploadRateLimit rate.Limit
+	// Caps reads from each peer connection, in bytes per second, in addition to the Client and
+	// Torrent limits. Unlimited if zero. See also PeerConn.SetDownloadRateLimit.
+	PeerDownloadRateLimit rate.Limit
 	// Maximum unverified bytes across all torrents. Not used if zero.
 	MaxUnverifiedBytes int64
+	// Ranks interested peers for upload slots every 10s. Defaults to TitForTatChoker.
+	Choker Choker
+	// Maximum peers unchoked per torrent, not counting the optimistic unchoke that rotates every
+	// 30s. Unlimited if zero.
+	UploadSlotsPerTorrent int
+	// Maximum peers unchoked across all torrents, not counting optimistic unchokes. Unlimited if
+	// zero.
+	UploadSlots int
 
 	// User-provided Client peer ID. If not present, one is generated automatically.
 	PeerID string
@@ -152,6 +192,9 @@ type ClientConfig struct {
 	KeepAliveTimeout time.Duration
 	// Maximum bytes to buffer per peer connection for peer request data before it is sent.
 	MaxAllocPeerRequestDataPerConn int
+	// Send BEP 6 Suggest messages to interested peers for pieces that were just read from storage
+	// for another peer, and are likely still cached. Intended for seeds serving many peers.
+	SuggestHotPieces bool
 
 	// The IP addresses as our peers should see them. May differ from the
 	// local interfaces due to NAT or other network configurations.
@@ -238,6 +281,7 @@ func NewDefaultClientConfig() *ClientConfig {
 		Extensions:             defaultPeerExtensionBytes(),
 		AcceptPeerConnections:  true,
 		MaxUnverifiedBytes:     64 << 20,
+		UploadSlotsPerTorrent:  8,
 		DialRateLimiter:        rate.NewLimiter(10, 10),
 		PieceHashersPerTorrent: 2,
 	}
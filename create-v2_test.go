@@ -0,0 +1,87 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestTransferCreatedV2(t *testing.T) {
+	t.Run("V2", func(t *testing.T) {
+		testTransferCreated(t, metainfo.BuildFromFilePathOpts{V2: true})
+	})
+	t.Run("Hybrid", func(t *testing.T) {
+		testTransferCreated(t, metainfo.BuildFromFilePathOpts{Hybrid: true})
+	})
+}
+
+// Creates a torrent from files on disk, and checks that a leecher can get all of it from a seeder
+// using that data.
+func testTransferCreated(t *testing.T, opts metainfo.BuildFromFilePathOpts) {
+	seederDir := t.TempDir()
+	root := filepath.Join(seederDir, "root")
+	r := rand.New(rand.NewSource(1))
+	for name, size := range map[string]int{
+		"a":   40000,
+		"b/c": 100,
+		"d":   0,
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		qt.Assert(t, qt.IsNil(os.MkdirAll(filepath.Dir(path), 0o755)))
+		b := make([]byte, size)
+		r.Read(b)
+		qt.Assert(t, qt.IsNil(os.WriteFile(path, b, 0o644)))
+	}
+	info := metainfo.Info{PieceLength: 16384}
+	var mi metainfo.MetaInfo
+	var err error
+	mi.PieceLayers, err = info.BuildFromFilePathOpts(context.Background(), root, opts)
+	qt.Assert(t, qt.IsNil(err))
+	mi.InfoBytes, err = bencode.Marshal(info)
+	qt.Assert(t, qt.IsNil(err))
+
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = seederDir
+	// The testing default is too small to serve whole chunks.
+	cfg.MaxAllocPeerRequestDataPerConn = defaultChunkSize
+	seeder, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer seeder.Close()
+	seederTorrent, _, err := seeder.AddTorrentSpec(TorrentSpecFromMetaInfo(&mi))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(seederTorrent.VerifyDataContext(context.Background())))
+	qt.Assert(t, qt.IsTrue(seederTorrent.Complete().Bool()))
+
+	leecherDir := t.TempDir()
+	cfg = TestingConfig(t)
+	cfg.DataDir = leecherDir
+	leecher, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer leecher.Close()
+	leecherTorrent, _, err := leecher.AddTorrentSpec(TorrentSpecFromMetaInfo(&mi))
+	qt.Assert(t, qt.IsNil(err))
+	leecherTorrent.AddClientPeer(seeder)
+	ctx, cancel := context.WithTimeout(t.Context(), time.Minute)
+	defer cancel()
+	for _, f := range leecherTorrent.Files() {
+		want, err := os.ReadFile(filepath.Join(seederDir, filepath.FromSlash(f.Path())))
+		qt.Assert(t, qt.IsNil(err))
+		fr := f.NewReader()
+		fr.SetContext(ctx)
+		got, err := io.ReadAll(fr)
+		fr.Close()
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.IsTrue(bytes.Equal(got, want)), qt.Commentf("file %q", f.Path()))
+	}
+}
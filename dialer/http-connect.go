@@ -0,0 +1,83 @@
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Tunnels TCP connections through an HTTP proxy with the CONNECT method.
+type HttpConnect struct {
+	// The proxy's address as host:port.
+	Addr string
+	// Basic authentication is sent in Proxy-Authorization if Username is set.
+	Username string
+	Password string
+	// Used to connect to the proxy. Uses Default if nil.
+	Forward WithContext
+}
+
+var _ WithContext = HttpConnect{}
+
+func (me HttpConnect) DialContext(ctx context.Context, network, addr string) (_ net.Conn, err error) {
+	if err = checkTcpNetwork(network); err != nil {
+		return
+	}
+	conn, err := forwardOrDefault(me.Forward).DialContext(ctx, "tcp", me.Addr)
+	if err != nil {
+		return
+	}
+	done := handshakeContext(ctx, conn)
+	br, err := me.connect(conn, addr)
+	err = done(err)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("http connect: %w", err)
+	}
+	if br.Buffered() != 0 {
+		// The peer spoke first, and it was read with the response.
+		conn = bufferedConn{conn, br}
+	}
+	return proxiedConn{conn, proxiedRemoteAddr(network, addr)}, nil
+}
+
+func (me HttpConnect) connect(conn net.Conn, addr string) (br *bufio.Reader, err error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if me.Username != "" {
+		// Borrow the encoding from the standard library, and move it to the proxy header.
+		req.SetBasicAuth(me.Username, me.Password)
+		req.Header["Proxy-Authorization"] = req.Header["Authorization"]
+		delete(req.Header, "Authorization")
+	}
+	err = req.Write(conn)
+	if err != nil {
+		return
+	}
+	br = bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return
+	}
+	// The body isn't read, since after success it's the tunnel, and otherwise the conn is discarded.
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("proxy responded %q", resp.Status)
+	}
+	return
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (me bufferedConn) Read(b []byte) (int, error) {
+	return me.r.Read(b)
+}
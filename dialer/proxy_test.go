@@ -0,0 +1,229 @@
+package dialer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+// A TCP server that echoes, to be reached through the proxies.
+func echoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func checkEcho(t *testing.T, c net.Conn) {
+	_, err := c.Write([]byte("hello"))
+	qt.Assert(t, qt.IsNil(err))
+	var b [5]byte
+	_, err = io.ReadFull(c, b[:])
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b[:]), "hello"))
+}
+
+// Just enough of a SOCKS5 server to test the client against. Requires the username "user" and
+// password "pass".
+func socks5Server(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSocks5(c)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveSocks5(c net.Conn) {
+	defer c.Close()
+	var b [2]byte
+	io.ReadFull(c, b[:])
+	io.ReadFull(c, make([]byte, b[1]))
+	c.Write([]byte{socks5Version, socks5AuthUserPassword})
+	io.ReadFull(c, b[:])
+	user := make([]byte, b[1])
+	io.ReadFull(c, user)
+	io.ReadFull(c, b[:1])
+	pass := make([]byte, b[0])
+	io.ReadFull(c, pass)
+	if string(user) != "user" || string(pass) != "pass" {
+		c.Write([]byte{1, 1})
+		return
+	}
+	c.Write([]byte{1, 0})
+	var header [3]byte
+	io.ReadFull(c, header[:])
+	host, port, err := readSocks5Addr(c)
+	if err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	switch header[1] {
+	case socks5CmdConnect:
+		tc, err := net.Dial("tcp", target)
+		if err != nil {
+			c.Write([]byte{socks5Version, 5, 0, socks5AtypIpv4, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer tc.Close()
+		reply, _ := appendSocks5Addr([]byte{socks5Version, 0, 0}, tc.LocalAddr().String())
+		c.Write(reply)
+		go io.Copy(tc, c)
+		io.Copy(c, tc)
+	case socks5CmdUdpAssociate:
+		relay, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return
+		}
+		defer relay.Close()
+		reply, _ := appendSocks5Addr([]byte{socks5Version, 0, 0}, relay.LocalAddr().String())
+		c.Write(reply)
+		go relayUdp(relay)
+		io.Copy(io.Discard, c)
+	}
+}
+
+// Forwards datagrams from the client to their targets, and replies back with the header.
+func relayUdp(relay *net.UDPConn) {
+	var client netip.AddrPort
+	b := make([]byte, 0x10000)
+	for {
+		n, from, err := relay.ReadFromUDPAddrPort(b)
+		if err != nil {
+			return
+		}
+		if from.Port() != 0 && (client == netip.AddrPort{} || from == client) {
+			client = from
+			r := bytes.NewReader(b[3:n])
+			host, port, err := readSocks5Addr(r)
+			if err != nil {
+				continue
+			}
+			target, _ := netip.ParseAddrPort(net.JoinHostPort(host, strconv.Itoa(int(port))))
+			relay.WriteToUDPAddrPort(b[n-r.Len():n], target)
+			continue
+		}
+		packet := []byte{0, 0, 0, socks5AtypIpv4}
+		packet = append(packet, from.Addr().AsSlice()...)
+		packet = binary.BigEndian.AppendUint16(packet, from.Port())
+		relay.WriteToUDPAddrPort(append(packet, b[:n]...), client)
+	}
+}
+
+func TestSocks5Connect(t *testing.T) {
+	target := echoServer(t)
+	proxy := Socks5{
+		Addr:     socks5Server(t),
+		Username: "user",
+		Password: "pass",
+	}
+	c, err := proxy.DialContext(context.Background(), "tcp", target)
+	qt.Assert(t, qt.IsNil(err))
+	defer c.Close()
+	qt.Check(t, qt.Equals(c.RemoteAddr().String(), target))
+	checkEcho(t, c)
+
+	proxy.Password = "wrong"
+	_, err = proxy.DialContext(context.Background(), "tcp", target)
+	qt.Check(t, qt.ErrorMatches(err, "socks5: authentication failed"))
+}
+
+func TestSocks5UdpAssociate(t *testing.T) {
+	echo, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	qt.Assert(t, qt.IsNil(err))
+	defer echo.Close()
+	go func() {
+		b := make([]byte, 100)
+		for {
+			n, from, err := echo.ReadFromUDPAddrPort(b)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDPAddrPort(b[:n], from)
+		}
+	}()
+	pc, err := Socks5{
+		Addr:     socks5Server(t),
+		Username: "user",
+		Password: "pass",
+	}.ListenPacket(context.Background(), "udp")
+	qt.Assert(t, qt.IsNil(err))
+	defer pc.Close()
+	_, err = pc.WriteTo([]byte("ping"), echo.LocalAddr())
+	qt.Assert(t, qt.IsNil(err))
+	b := make([]byte, 10)
+	n, from, err := pc.ReadFrom(b)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b[:n]), "ping"))
+	qt.Check(t, qt.Equals(from.String(), echo.LocalAddr().String()))
+}
+
+func TestHttpConnect(t *testing.T) {
+	target := echoServer(t)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if user, pass, _ := (&http.Request{Header: http.Header{
+			"Authorization": r.Header["Proxy-Authorization"],
+		}}).BasicAuth(); user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		tc, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer tc.Close()
+		w.WriteHeader(http.StatusOK)
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		go io.Copy(tc, c)
+		io.Copy(c, tc)
+	}))
+	defer proxy.Close()
+	d, err := ParseProxyUrl("http://user:pass@" + proxy.Listener.Addr().String())
+	qt.Assert(t, qt.IsNil(err))
+	c, err := d.DialContext(context.Background(), "tcp", target)
+	qt.Assert(t, qt.IsNil(err))
+	defer c.Close()
+	checkEcho(t, c)
+
+	d, err = ParseProxyUrl("http://" + proxy.Listener.Addr().String())
+	qt.Assert(t, qt.IsNil(err))
+	_, err = d.DialContext(context.Background(), "tcp", target)
+	qt.Check(t, qt.ErrorMatches(err, `http connect: proxy responded "407 .*"`))
+}
@@ -0,0 +1,360 @@
+package dialer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	socks5Version = 5
+
+	socks5AuthNone         = 0
+	socks5AuthUserPassword = 2
+	socks5AuthNoAcceptable = 0xff
+
+	socks5CmdConnect      = 1
+	socks5CmdUdpAssociate = 3
+
+	socks5AtypIpv4   = 1
+	socks5AtypDomain = 3
+	socks5AtypIpv6   = 4
+
+	// RSV, FRAG, ATYP, the longest address (a domain) and the port.
+	socks5MaxUdpHeaderLen = 2 + 1 + 1 + 1 + 255 + 2
+)
+
+// A SOCKS5 (RFC 1928) proxy client. TCP connections are made with CONNECT, and UDP is relayed with
+// UDP ASSOCIATE. Names are always resolved by the proxy.
+type Socks5 struct {
+	// The proxy's address as host:port.
+	Addr string
+	// Username and password authentication (RFC 1929) is offered if Username is set.
+	Username string
+	Password string
+	// Used to connect to the proxy. Uses Default if nil.
+	Forward WithContext
+}
+
+var (
+	_ WithContext    = Socks5{}
+	_ PacketListener = Socks5{}
+)
+
+func (me Socks5) DialContext(ctx context.Context, network, addr string) (_ net.Conn, err error) {
+	if err = checkTcpNetwork(network); err != nil {
+		return
+	}
+	conn, _, err := me.request(ctx, socks5CmdConnect, addr)
+	if err != nil {
+		return
+	}
+	return proxiedConn{conn, proxiedRemoteAddr(network, addr)}, nil
+}
+
+// Returns a PacketConn that relays datagrams through the proxy. The association lasts until the
+// PacketConn is closed, or the proxy ends it. The network only needs to be UDP, since the relay is
+// reached over whichever IP version the proxy provides.
+func (me Socks5) ListenPacket(ctx context.Context, network string) (_ net.PacketConn, err error) {
+	if !strings.HasPrefix(network, "udp") {
+		return nil, fmt.Errorf("unsupported network %q", network)
+	}
+	ctrl, relayAddr, err := me.request(ctx, socks5CmdUdpAssociate, "0.0.0.0:0")
+	if err != nil {
+		return
+	}
+	if relayAddr.Addr().IsUnspecified() {
+		// The relay is on the proxy host.
+		proxyAddr, _ := ctrl.RemoteAddr().(*net.TCPAddr)
+		if proxyAddr == nil {
+			ctrl.Close()
+			return nil, errors.New("socks5: unspecified relay address")
+		}
+		relayAddr = netip.AddrPortFrom(proxyAddr.AddrPort().Addr(), relayAddr.Port())
+	}
+	relay, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(relayAddr))
+	if err != nil {
+		ctrl.Close()
+		return
+	}
+	pc := &socks5PacketConn{
+		ctrl:  ctrl,
+		relay: relay,
+	}
+	go pc.watchCtrl()
+	return pc, nil
+}
+
+// Connects to the proxy and performs a request, returning the connection and the bound address in
+// the reply.
+func (me Socks5) request(ctx context.Context, cmd byte, addr string) (
+	conn net.Conn, bound netip.AddrPort, err error,
+) {
+	conn, err = forwardOrDefault(me.Forward).DialContext(ctx, "tcp", me.Addr)
+	if err != nil {
+		return
+	}
+	done := handshakeContext(ctx, conn)
+	bound, err = me.handshake(conn, cmd, addr)
+	err = done(err)
+	if err != nil {
+		conn.Close()
+		conn = nil
+		err = fmt.Errorf("socks5: %w", err)
+	}
+	return
+}
+
+func (me Socks5) handshake(conn net.Conn, cmd byte, addr string) (bound netip.AddrPort, err error) {
+	methods := []byte{socks5AuthNone}
+	if me.Username != "" {
+		methods = append(methods, socks5AuthUserPassword)
+	}
+	_, err = conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...))
+	if err != nil {
+		return
+	}
+	var reply [2]byte
+	_, err = io.ReadFull(conn, reply[:])
+	if err != nil {
+		return
+	}
+	if reply[0] != socks5Version {
+		err = fmt.Errorf("unexpected version %v", reply[0])
+		return
+	}
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthUserPassword:
+		err = me.authenticate(conn)
+		if err != nil {
+			return
+		}
+	case socks5AuthNoAcceptable:
+		err = errors.New("no acceptable authentication methods")
+		return
+	default:
+		err = fmt.Errorf("unexpected authentication method %v", reply[1])
+		return
+	}
+	b, err := appendSocks5Addr([]byte{socks5Version, cmd, 0}, addr)
+	if err != nil {
+		return
+	}
+	_, err = conn.Write(b)
+	if err != nil {
+		return
+	}
+	var header [3]byte
+	_, err = io.ReadFull(conn, header[:])
+	if err != nil {
+		return
+	}
+	if header[1] != 0 {
+		err = socks5ReplyError(header[1])
+		return
+	}
+	host, port, err := readSocks5Addr(conn)
+	if err != nil {
+		return
+	}
+	// Relays are always given by IP in practice. A name here is ignored, as is the bound address
+	// for CONNECT.
+	ip, _ := netip.ParseAddr(host)
+	bound = netip.AddrPortFrom(ip.Unmap(), port)
+	return
+}
+
+func (me Socks5) authenticate(conn net.Conn) (err error) {
+	if len(me.Username) > 255 || len(me.Password) > 255 {
+		return errors.New("username or password too long")
+	}
+	b := []byte{1, byte(len(me.Username))}
+	b = append(b, me.Username...)
+	b = append(b, byte(len(me.Password)))
+	b = append(b, me.Password...)
+	_, err = conn.Write(b)
+	if err != nil {
+		return
+	}
+	var reply [2]byte
+	_, err = io.ReadFull(conn, reply[:])
+	if err != nil {
+		return
+	}
+	if reply[1] != 0 {
+		return errors.New("authentication failed")
+	}
+	return
+}
+
+type socks5ReplyError byte
+
+func (me socks5ReplyError) Error() string {
+	switch me {
+	case 1:
+		return "general server failure"
+	case 2:
+		return "connection not allowed by ruleset"
+	case 3:
+		return "network unreachable"
+	case 4:
+		return "host unreachable"
+	case 5:
+		return "connection refused"
+	case 6:
+		return "TTL expired"
+	case 7:
+		return "command not supported"
+	case 8:
+		return "address type not supported"
+	default:
+		return fmt.Sprintf("reply code %v", byte(me))
+	}
+}
+
+func appendSocks5Addr(b []byte, addr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("parsing port: %w", err)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ip = ip.Unmap()
+		if ip.Is4() {
+			b = append(b, socks5AtypIpv4)
+		} else {
+			b = append(b, socks5AtypIpv6)
+		}
+		b = append(b, ip.AsSlice()...)
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name too long: %q", host)
+		}
+		b = append(b, socks5AtypDomain, byte(len(host)))
+		b = append(b, host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+func readSocks5Addr(r io.Reader) (host string, port uint16, err error) {
+	var atyp [1]byte
+	_, err = io.ReadFull(r, atyp[:])
+	if err != nil {
+		return
+	}
+	var b []byte
+	switch atyp[0] {
+	case socks5AtypIpv4:
+		b = make([]byte, 4)
+	case socks5AtypIpv6:
+		b = make([]byte, 16)
+	case socks5AtypDomain:
+		var n [1]byte
+		_, err = io.ReadFull(r, n[:])
+		if err != nil {
+			return
+		}
+		b = make([]byte, n[0])
+	default:
+		err = fmt.Errorf("unknown address type %v", atyp[0])
+		return
+	}
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return
+	}
+	if atyp[0] == socks5AtypDomain {
+		host = string(b)
+	} else {
+		ip, _ := netip.AddrFromSlice(b)
+		host = ip.String()
+	}
+	var portBytes [2]byte
+	_, err = io.ReadFull(r, portBytes[:])
+	port = binary.BigEndian.Uint16(portBytes[:])
+	return
+}
+
+// Datagrams relayed with UDP ASSOCIATE. Each is prefixed with the remote address.
+type socks5PacketConn struct {
+	// The association ends when this is closed.
+	ctrl  net.Conn
+	relay *net.UDPConn
+}
+
+// The proxy ends the association by closing the control connection.
+func (me *socks5PacketConn) watchCtrl() {
+	io.Copy(io.Discard, me.ctrl)
+	me.relay.Close()
+}
+
+func (me *socks5PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	buf := make([]byte, len(b)+socks5MaxUdpHeaderLen)
+	for {
+		n, err = me.relay.Read(buf)
+		if err != nil {
+			return
+		}
+		r := bytes.NewReader(buf[:n])
+		var header [3]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			continue
+		}
+		// Fragments aren't supported, and are dropped.
+		if header[2] != 0 {
+			continue
+		}
+		host, port, err := readSocks5Addr(r)
+		if err != nil {
+			continue
+		}
+		n = copy(b, buf[n-r.Len():n])
+		addr = proxiedRemoteAddr("udp", net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)))
+		return n, addr, nil
+	}
+}
+
+func (me *socks5PacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	packet, err := appendSocks5Addr([]byte{0, 0, 0}, addr.String())
+	if err != nil {
+		return
+	}
+	_, err = me.relay.Write(append(packet, b...))
+	if err != nil {
+		return
+	}
+	return len(b), nil
+}
+
+func (me *socks5PacketConn) Close() error {
+	me.ctrl.Close()
+	return me.relay.Close()
+}
+
+func (me *socks5PacketConn) LocalAddr() net.Addr {
+	return me.relay.LocalAddr()
+}
+
+func (me *socks5PacketConn) SetDeadline(t time.Time) error {
+	return me.relay.SetDeadline(t)
+}
+
+func (me *socks5PacketConn) SetReadDeadline(t time.Time) error {
+	return me.relay.SetReadDeadline(t)
+}
+
+func (me *socks5PacketConn) SetWriteDeadline(t time.Time) error {
+	return me.relay.SetWriteDeadline(t)
+}
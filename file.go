@@ -195,6 +195,8 @@ func (f *File) SetPriority(prio PiecePriority) {
 		f.t.updatePiecePriorities(f.BeginPieceIndex(), f.EndPieceIndex(), "File.SetPriority")
 	}
 	f.t.cl.unlock()
+	// Files are None by default, but storage only treats them as unwanted once that's explicit.
+	f.t.setStorageFileWanted(f, prio != PiecePriorityNone)
 }
 
 // Returns the priority per File.SetPriority.
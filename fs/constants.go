@@ -1,10 +0,0 @@
-package torrentfs
-
-import (
-	"os"
-)
-
-// Constants used across the torrentfs package
-var (
-	defaultMode = os.FileMode(0555)
-)
@@ -0,0 +1,112 @@
+package torrentfs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/anacrolix/fuse"
+	fusefs "github.com/anacrolix/fuse/fs"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// A directory in the root where writing a .torrent file, or a file containing a magnet link, adds
+// the torrent to the client. Nothing is kept in it.
+const controlDirName = ".add"
+
+type controlNode struct {
+	fs *TorrentFS
+}
+
+var (
+	_ fusefs.HandleReadDirAller = controlNode{}
+	_ fusefs.NodeCreater        = controlNode{}
+)
+
+func (cn controlNode) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Mode = os.ModeDir | writableDirMode
+	return nil
+}
+
+func (cn controlNode) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return nil, nil
+}
+
+func (cn controlNode) Lookup(ctx context.Context, name string) (fusefs.Node, error) {
+	return nil, fuse.ENOENT
+}
+
+func (cn controlNode) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fusefs.Node, fusefs.Handle, error) {
+	h := &addHandle{cl: cn.fs.Client}
+	return addNode{h}, h, nil
+}
+
+// A file being written into the control directory.
+type addNode struct {
+	h *addHandle
+}
+
+func (an addNode) Attr(ctx context.Context, attr *fuse.Attr) error {
+	an.h.mu.Lock()
+	defer an.h.mu.Unlock()
+	attr.Size = uint64(len(an.h.buf))
+	attr.Mode = 0o644
+	return nil
+}
+
+type addHandle struct {
+	cl  *torrent.Client
+	mu  sync.Mutex
+	buf []byte
+}
+
+var _ interface {
+	fusefs.HandleWriter
+	fusefs.HandleFlusher
+} = (*addHandle)(nil)
+
+func (me *addHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	end := int(req.Offset) + len(req.Data)
+	if end > len(me.buf) {
+		me.buf = append(me.buf, make([]byte, end-len(me.buf))...)
+	}
+	copy(me.buf[req.Offset:], req.Data)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// The torrent is added when the file is closed, so errors are returned from close.
+func (me *addHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if len(me.buf) == 0 {
+		return nil
+	}
+	err := addTorrentData(me.cl, me.buf)
+	me.buf = nil
+	return err
+}
+
+// Adds a torrent from metainfo, or a magnet link.
+func addTorrentData(cl *torrent.Client, b []byte) error {
+	if s := strings.TrimSpace(string(b)); strings.HasPrefix(s, "magnet:") {
+		_, err := cl.AddMagnet(s)
+		if err != nil {
+			return fuse.Errno(syscall.EINVAL)
+		}
+		return nil
+	}
+	mi, err := metainfo.Load(bytes.NewReader(b))
+	if err != nil {
+		return fuse.Errno(syscall.EINVAL)
+	}
+	_, err = cl.AddTorrent(mi)
+	return err
+}
@@ -2,44 +2,36 @@ package torrentfs
 
 import (
 	"context"
-	"github.com/anacrolix/torrent"
 	"io"
 	"sync"
 
 	"github.com/anacrolix/fuse"
 	fusefs "github.com/anacrolix/fuse/fs"
 	"github.com/anacrolix/missinggo/v2"
-	"github.com/anacrolix/missinggo/v2/pproffd"
+
+	"github.com/anacrolix/torrent"
 )
 
-// TorrentFS represents the filesystem for torrents
-type torrentFS struct {
-	mu           sync.Mutex
-	blockedReads int
-	event        *sync.Cond
-	destroyed    chan struct{}
-	// Add other required fields
+type fileHandle struct {
+	fn fileNode
+	// Serializes reads, since the reader isn't safe for concurrent use.
+	mu sync.Mutex
+	r  torrent.Reader
 }
 
-// Define the metrics counter at package level
-var torrentfsReadRequests = missinggo.NewExpVar("torrentfs.read.requests")
+var _ interface {
+	fusefs.HandleReader
+	fusefs.HandleReleaser
+} = (*fileHandle)(nil)
 
-func (me fileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+func (me *fileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
 	torrentfsReadRequests.Add(1)
 	if req.Dir {
 		panic("read on directory")
 	}
-	r := me.tf.NewReader()
-	defer func() {
-		if closer, ok := r.(io.Closer); ok {
-			closer.Close()
-		}
-	}()
-	seeker, ok := r.(io.Seeker)
-	if !ok {
-		panic("reader does not implement io.Seeker")
-	}
-	pos, err := seeker.Seek(req.Offset, io.SeekStart)
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	pos, err := me.r.Seek(req.Offset, io.SeekStart)
 	if err != nil {
 		panic(err)
 	}
@@ -50,51 +42,44 @@ func (me fileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse
 	readDone := make(chan struct{})
 	ctx, cancel := context.WithCancel(ctx)
 	var readErr error
+	fs := me.fn.FS
 	go func() {
 		defer close(readDone)
-		me.fn.FS.mu.Lock()
-		me.fn.FS.blockedReads++
-		me.fn.FS.event.Broadcast()
-		me.fn.FS.mu.Unlock()
+		fs.mu.Lock()
+		fs.blockedReads++
+		fs.event.Broadcast()
+		fs.mu.Unlock()
 		var n int
-		r := missinggo.ContextedReader{Reader: r, Ctx: ctx}
-		// log.Printf("reading %v bytes at %v", len(resp.Data), req.Offset)
-		if true {
-			// A user reported on that on freebsd 12.2, the system requires that reads are
-			// completely filled. Their system only asks for 64KiB at a time. I've seen systems that
-			// can demand up to 16MiB at a time, so this gets tricky. For now, I'll restore the old
-			// behaviour from before 2a7352a, which nobody reported problems with.
-			n, readErr = io.ReadFull(r, resp.Data)
-			if readErr == io.ErrUnexpectedEOF {
-				readErr = nil
-			}
-		} else {
-			n, readErr = r.Read(resp.Data)
-			if readErr == io.EOF {
-				readErr = nil
-			}
+		r := missinggo.ContextedReader{R: me.r, Ctx: ctx}
+		// A user reported on that on freebsd 12.2, the system requires that reads are completely
+		// filled. Their system only asks for 64KiB at a time. I've seen systems that can demand up
+		// to 16MiB at a time, so this gets tricky. For now, I'll restore the old behaviour from
+		// before 2a7352a, which nobody reported problems with.
+		n, readErr = io.ReadFull(r, resp.Data)
+		if readErr == io.ErrUnexpectedEOF || readErr == io.EOF {
+			readErr = nil
 		}
 		resp.Data = resp.Data[:n]
 	}()
 	defer func() {
 		<-readDone
-		me.fn.FS.mu.Lock()
-		me.fn.FS.blockedReads--
-		me.fn.FS.event.Broadcast()
-		me.fn.FS.mu.Unlock()
+		fs.mu.Lock()
+		fs.blockedReads--
+		fs.event.Broadcast()
+		fs.mu.Unlock()
 	}()
 	defer cancel()
 
 	select {
 	case <-readDone:
 		return readErr
-	case <-me.fn.FS.destroyed:
+	case <-fs.destroyed:
 		return fuse.EIO
 	case <-ctx.Done():
 		return fuse.EINTR
 	}
 }
 
-func (me fileHandle) Release(context.Context, *fuse.ReleaseRequest) error {
-	return nil
+func (me *fileHandle) Release(context.Context, *fuse.ReleaseRequest) error {
+	return me.r.Close()
 }
@@ -10,25 +10,39 @@ import (
 )
 
 type fileNode struct {
-	fusefs.Node
-	tf *torrent.File
+	node
+	f *torrent.File
 }
 
-var _ fusefs.NodeOpener = (*fileNode)(nil)
+var (
+	_ fusefs.NodeOpener      = fileNode{}
+	_ fusefs.NodeGetxattrer  = fileNode{}
+	_ fusefs.NodeListxattrer = fileNode{}
+)
 
-func (fn *fileNode) Attr(ctx context.Context, attr *fuse.Attr) error {
-	attr.Size = uint64(fn.tf.Length())
+func (fn fileNode) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Size = uint64(fn.f.Length())
+	// Report what's been downloaded, so tools like du show progress.
+	attr.Blocks = uint64(fn.f.BytesCompleted()+511) / 512
 	attr.Mode = defaultMode
 	return nil
 }
 
-func (fn *fileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fusefs.Handle, error) {
-	return &fileHandle{fn: fn, tf: fn.tf}, nil
+func (fn fileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fusefs.Handle, error) {
+	// The reader is kept for the life of the handle, so readahead carries over between reads.
+	return &fileHandle{fn: fn, r: fn.f.NewReader()}, nil
+}
+
+func (fn fileNode) xattrs() map[string]string {
+	ret := fn.node.xattrs()
+	ret[xattrBytesCompleted] = formatInt(fn.f.BytesCompleted())
+	return ret
 }
 
-type fileHandle struct {
-	fn *fileNode
-	tf *torrent.File
+func (fn fileNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return getxattr(fn.xattrs(), req, resp)
 }
 
-var _ fusefs.Handle = (*fileHandle)(nil)
+func (fn fileNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	return listxattr(fn.xattrs(), resp)
+}
@@ -16,6 +16,9 @@ import (
 
 const (
 	defaultMode = 0o555
+	// For directories that can be changed, like the root where torrents are dropped by removing
+	// them.
+	writableDirMode = 0o755
 )
 
 var torrentfsReadRequests = expvar.NewInt("torrentfsReadRequests")
@@ -25,7 +28,7 @@ type TorrentFS struct {
 	destroyed    chan struct{}
 	mu           sync.Mutex
 	blockedReads int
-	event        sync.Cond
+	event        *sync.Cond
 }
 
 var (
@@ -33,11 +36,14 @@ var (
 
 	_ fusefs.NodeForgetter      = rootNode{}
 	_ fusefs.HandleReadDirAller = rootNode{}
+	_ fusefs.NodeRemover        = rootNode{}
 	_ fusefs.HandleReadDirAller = dirNode{}
+	_ fusefs.NodeGetxattrer     = dirNode{}
+	_ fusefs.NodeListxattrer    = dirNode{}
 )
 
 // Is a directory node that lists all torrents and handles destruction of the
-// filesystem.
+// filesystem. Removing a torrent from it drops the torrent from the client.
 type rootNode struct {
 	fs *TorrentFS
 }
@@ -137,7 +143,18 @@ func (dn dirNode) Attr(ctx context.Context, attr *fuse.Attr) error {
 	return nil
 }
 
+func (dn dirNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return getxattr(dn.xattrs(), req, resp)
+}
+
+func (dn dirNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	return listxattr(dn.xattrs(), resp)
+}
+
 func (rn rootNode) Lookup(ctx context.Context, name string) (_node fusefs.Node, err error) {
+	if name == controlDirName {
+		return controlNode{rn.fs}, nil
+	}
 	for _, t := range rn.fs.Client.Torrents() {
 		info := t.Info()
 		if t.Name() != name || info == nil {
@@ -162,6 +179,10 @@ func (rn rootNode) Lookup(ctx context.Context, name string) (_node fusefs.Node,
 }
 
 func (rn rootNode) ReadDirAll(ctx context.Context) (dirents []fuse.Dirent, err error) {
+	dirents = append(dirents, fuse.Dirent{
+		Name: controlDirName,
+		Type: fuse.DT_Dir,
+	})
 	for _, t := range rn.fs.Client.Torrents() {
 		info := t.Info()
 		if info == nil {
@@ -182,10 +203,25 @@ func (rn rootNode) ReadDirAll(ctx context.Context) (dirents []fuse.Dirent, err e
 }
 
 func (rn rootNode) Attr(ctx context.Context, attr *fuse.Attr) error {
-	attr.Mode = os.ModeDir | defaultMode
+	attr.Mode = os.ModeDir | writableDirMode
 	return nil
 }
 
+func (rn rootNode) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if req.Name == controlDirName {
+		return fuse.EPERM
+	}
+	for _, t := range rn.fs.Client.Torrents() {
+		info := t.Info()
+		if info == nil || info.BestName() != req.Name || info.IsDir() != req.Dir {
+			continue
+		}
+		t.Drop()
+		return nil
+	}
+	return fuse.ENOENT
+}
+
 // TODO(anacrolix): Why should rootNode implement this?
 func (rn rootNode) Forget() {
 	rn.fs.Destroy()
@@ -210,6 +246,6 @@ func New(cl *torrent.Client) *TorrentFS {
 		Client:    cl,
 		destroyed: make(chan struct{}),
 	}
-	fs.event.L = &fs.mu
+	fs.event = sync.NewCond(&fs.mu)
 	return fs
 }
@@ -1,6 +1,7 @@
 package torrentfs
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -254,3 +255,48 @@ func TestIsSubPath(t *testing.T) {
 		assert.Equal(t, case_.is, isSubPath(case_.parent, case_.child))
 	}
 }
+
+func TestControlDirAndXattrs(t *testing.T) {
+	cfg := torrent.TestingConfig(t)
+	cl, err := torrent.NewClient(cfg)
+	require.NoError(t, err)
+	defer cl.Close()
+	fs := New(cl)
+	defer fs.Destroy()
+	ctx := context.Background()
+	root, _ := fs.Root()
+
+	// Add a torrent by writing its metainfo into the control directory.
+	control, err := root.(fusefs.NodeStringLookuper).Lookup(ctx, controlDirName)
+	require.NoError(t, err)
+	_, h, err := control.(fusefs.NodeCreater).Create(ctx, &fuse.CreateRequest{Name: "a.torrent"}, &fuse.CreateResponse{})
+	require.NoError(t, err)
+	mi := testutil.GreetingMetaInfo()
+	var buf bytes.Buffer
+	require.NoError(t, mi.Write(&buf))
+	var wresp fuse.WriteResponse
+	require.NoError(t, h.(fusefs.HandleWriter).Write(ctx, &fuse.WriteRequest{Data: buf.Bytes()}, &wresp))
+	assert.EqualValues(t, buf.Len(), wresp.Size)
+	require.NoError(t, h.(fusefs.HandleFlusher).Flush(ctx, &fuse.FlushRequest{}))
+	require.Len(t, cl.Torrents(), 1)
+
+	node, err := root.(fusefs.NodeStringLookuper).Lookup(ctx, "greeting")
+	require.NoError(t, err)
+	var attr fuse.Attr
+	require.NoError(t, node.Attr(ctx, &attr))
+	// Nothing is downloaded yet.
+	assert.EqualValues(t, 0, attr.Blocks)
+	var xresp fuse.GetxattrResponse
+	require.NoError(t, node.(fusefs.NodeGetxattrer).Getxattr(ctx, &fuse.GetxattrRequest{Name: xattrInfoHash}, &xresp))
+	assert.EqualValues(t, mi.HashInfoBytes().HexString(), xresp.Xattr)
+	require.NoError(t, node.(fusefs.NodeGetxattrer).Getxattr(ctx, &fuse.GetxattrRequest{Name: xattrPieces}, &xresp))
+	assert.EqualValues(t, "0/3", xresp.Xattr)
+	var lresp fuse.ListxattrResponse
+	require.NoError(t, node.(fusefs.NodeListxattrer).Listxattr(ctx, &fuse.ListxattrRequest{}, &lresp))
+	assert.Contains(t, string(lresp.Xattr), xattrBytesCompleted+"\x00")
+	assert.Equal(t, fuse.ErrNoXattr, node.(fusefs.NodeGetxattrer).Getxattr(ctx, &fuse.GetxattrRequest{Name: "user.other"}, &xresp))
+
+	// Removing the torrent from the root drops it.
+	require.NoError(t, root.(fusefs.NodeRemover).Remove(ctx, &fuse.RemoveRequest{Name: "greeting"}))
+	assert.Empty(t, cl.Torrents())
+}
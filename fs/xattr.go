@@ -0,0 +1,47 @@
+package torrentfs
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/anacrolix/fuse"
+)
+
+// Extended attributes exposing torrent state, for nodes within a torrent. Values are text.
+const (
+	xattrInfoHash       = "user.torrent.infohash"
+	xattrPieces         = "user.torrent.pieces"
+	xattrPeers          = "user.torrent.peers"
+	xattrSeeders        = "user.torrent.seeders"
+	xattrBytesCompleted = "user.torrent.bytes_completed"
+)
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+func (n node) xattrs() map[string]string {
+	stats := n.t.Stats()
+	return map[string]string{
+		xattrInfoHash: n.t.InfoHash().HexString(),
+		// Completed over total.
+		xattrPieces:  strconv.Itoa(stats.PiecesComplete) + "/" + strconv.Itoa(n.t.NumPieces()),
+		xattrPeers:   strconv.Itoa(stats.ActivePeers),
+		xattrSeeders: strconv.Itoa(stats.ConnectedSeeders),
+	}
+}
+
+func getxattr(xattrs map[string]string, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	value, ok := xattrs[req.Name]
+	if !ok {
+		return fuse.ErrNoXattr
+	}
+	resp.Xattr = []byte(value)
+	return nil
+}
+
+func listxattr(xattrs map[string]string, resp *fuse.ListxattrResponse) error {
+	resp.Append(slices.Sorted(maps.Keys(xattrs))...)
+	return nil
+}
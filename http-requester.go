@@ -0,0 +1,227 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/log"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/anacrolix/torrent/webseed"
+)
+
+// The parts of fetching chunks over HTTP that differ between webseeds and BEP 17 HTTP seeds.
+type httpRequesterImpl interface {
+	// Returns the requests starting at x that can be fetched with a single HTTP request. They're
+	// wanted from the peer and not already being handled.
+	requestsFrom(x RequestIndex) []Request
+	// Makes an HTTP request for reqs. The body returns their data in order. Called without the
+	// Client lock.
+	doHttpRequest(ctx context.Context, reqs []Request) (io.ReadCloser, error)
+	// Handles an error for requests that weren't cancelled. Called with the Client lock held.
+	onRequestError(reqs []Request, err error)
+}
+
+// Runs requests for a peer that serves chunks over HTTP, limiting concurrency and backing off on
+// errors according to health. It's embedded in the peer implementation.
+type httpRequester struct {
+	peer           *Peer
+	impl           httpRequesterImpl
+	activeRequests map[Request]context.CancelFunc
+	requesterCond  sync.Cond
+
+	health webseed.Health
+	// HTTP requests in progress. This is limited by health.Concurrency.
+	activeHttpRequests int
+}
+
+// Starts maxRequests requesters. The Client lock must be held.
+func (me *httpRequester) init(p *Peer, impl httpRequesterImpl, maxRequests int) {
+	me.peer = p
+	me.impl = impl
+	g.MakeMapWithCap(&me.activeRequests, maxRequests)
+	me.health.MaxConcurrency = maxRequests
+	me.requesterCond.L = p.t.cl.locker()
+	for i := 0; i < maxRequests; i += 1 {
+		go me.requester(i)
+	}
+}
+
+func (me *httpRequester) statusLines() []string {
+	return append(
+		[]string{fmt.Sprintf("active requests: %v", me.activeHttpRequests)},
+		me.health.StatusLines(time.Now())...)
+}
+
+func (me *httpRequester) _cancel(r RequestIndex) bool {
+	if cancel, ok := me.activeRequests[me.peer.t.requestIndexToRequest(r)]; ok {
+		cancel()
+		// The requester is running and will handle the result.
+		return true
+	}
+	// There should be no requester handling this, so no further events will occur.
+	return false
+}
+
+func (me *httpRequester) _request(r Request) bool {
+	me.requesterCond.Signal()
+	return true
+}
+
+func (me *httpRequester) handleUpdateRequests() {
+	// Because this is synchronous, HTTP peers seem to get first dibs on newly prioritized pieces.
+	go func() {
+		me.peer.t.cl.lock()
+		defer me.peer.t.cl.unlock()
+		me.peer.maybeUpdateActualRequestState()
+	}()
+}
+
+// Releases the peer's requests, and wakes the requesters so they can exit.
+func (me *httpRequester) onClose() {
+	me.peer.logger.Levelf(log.Debug, "closing")
+	// Just deleting them means we would have to manually cancel active requests.
+	me.peer.cancelAllRequests()
+	me.peer.t.iterPeers(func(p *Peer) {
+		if p.isLowOnRequests() {
+			p.updateRequests("httpRequester.onClose")
+		}
+	})
+	me.requesterCond.Broadcast()
+}
+
+func (me *httpRequester) requester(i int) {
+	me.requesterCond.L.Lock()
+	defer me.requesterCond.L.Unlock()
+start:
+	for !me.peer.closed.IsSet() {
+		if wait := time.Until(me.health.BackoffUntil()); wait > 0 {
+			me.requesterCond.L.Unlock()
+			select {
+			case <-me.peer.closed.Done():
+			case <-time.After(wait):
+			}
+			me.requesterCond.L.Lock()
+			continue
+		}
+		if me.activeHttpRequests >= me.health.Concurrency() {
+			me.requesterCond.Wait()
+			continue
+		}
+		for reqIndex := range me.peer.requestState.Requests.Iterator() {
+			if !me.requestIteratorLocked(i, reqIndex) {
+				goto start
+			}
+		}
+		// Found no requests to handle, so wait.
+		me.requesterCond.Wait()
+	}
+}
+
+// Returns true if we should look for another request to start. Returns false if we handled this
+// one.
+func (me *httpRequester) requestIteratorLocked(requesterIndex int, x RequestIndex) bool {
+	if _, ok := me.activeRequests[me.peer.t.requestIndexToRequest(x)]; ok {
+		return true
+	}
+	reqs := me.impl.requestsFrom(x)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancelling any of the chunks cancels the whole request. The chunks that arrived are kept.
+	for _, r := range reqs {
+		me.activeRequests[r] = cancel
+	}
+	me.activeHttpRequests++
+	locker := me.requesterCond.L
+	err := func() error {
+		locker.Unlock()
+		defer locker.Lock()
+		return me.doRequest(ctx, reqs)
+	}()
+	me.activeHttpRequests--
+	for _, r := range reqs {
+		delete(me.activeRequests, r)
+	}
+	// A slot is free, and concurrency may have changed.
+	me.requesterCond.Broadcast()
+	if err != nil {
+		level := log.Warning
+		if errors.Is(err, context.Canceled) {
+			level = log.Debug
+		}
+		me.peer.logger.Levelf(level, "requester %v: error requesting %v: %v", requesterIndex, reqs[0], err)
+		// Requesters wait out any backoff before starting another request.
+		me.peer.updateRequests("httpRequester request errored")
+	}
+	return false
+}
+
+// Receives each chunk as it arrives, so memory use is bounded by the chunk size, and chunks
+// received before an error are kept.
+func (me *httpRequester) doRequest(ctx context.Context, reqs []Request) error {
+	body, err := me.impl.doHttpRequest(ctx, reqs)
+	if err != nil {
+		return me.rejectRequests(reqs, err)
+	}
+	defer body.Close()
+	var buf []byte
+	for i, r := range reqs {
+		buf = slices.Grow(buf[:0], int(r.Length))[:r.Length]
+		n, err := io.ReadFull(body, buf)
+		if err == nil {
+			// Increment ChunksRead and friends
+			me.peer.doChunkReadStats(int64(n))
+		}
+		me.peer.readBytes(int64(n))
+		if err != nil {
+			return me.rejectRequests(reqs[i:], err)
+		}
+		me.receiveChunk(r, buf)
+	}
+	me.peer.t.cl.lock()
+	me.health.OnSuccess()
+	me.peer.t.cl.unlock()
+	return nil
+}
+
+func (me *httpRequester) receiveChunk(r Request, b []byte) {
+	me.peer.t.cl.lock()
+	defer me.peer.t.cl.unlock()
+	if me.peer.t.closed.IsSet() {
+		return
+	}
+	me.health.OnData(time.Now(), int64(len(b)))
+	err := me.peer.receiveChunk(&pp.Message{
+		Type:  pp.Piece,
+		Index: r.Index,
+		Begin: r.Begin,
+		Piece: b,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Handles a request that failed before the data for reqs arrived.
+func (me *httpRequester) rejectRequests(reqs []Request, err error) error {
+	me.peer.t.cl.lock()
+	defer me.peer.t.cl.unlock()
+	if me.peer.t.closed.IsSet() {
+		return nil
+	}
+	if !errors.Is(err, context.Canceled) && !me.peer.closed.IsSet() {
+		me.impl.onRequestError(reqs, err)
+	}
+	for _, r := range reqs {
+		if !me.peer.remoteRejectedRequest(me.peer.t.requestIndexFromRequest(r)) {
+			panic("invalid reject")
+		}
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+
+	"github.com/anacrolix/torrent/httpseed"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// A BEP 17 HTTP seed. It's like webseedPeer, except requests are made for ranges within a piece,
+// and the seed is assumed to have all pieces.
+type httpSeedPeer struct {
+	// First field for stats alignment.
+	peer   Peer
+	client httpseed.Client
+	pieces roaring.Bitmap
+	httpRequester
+}
+
+var (
+	_ legacyPeerImpl    = (*httpSeedPeer)(nil)
+	_ httpRequesterImpl = (*httpSeedPeer)(nil)
+)
+
+func (me *httpSeedPeer) lastWriteUploadRate() float64 {
+	// We never upload to HTTP seeds.
+	return 0
+}
+
+func (me *httpSeedPeer) peerImplStatusLines() []string {
+	return append([]string{me.client.Url}, me.httpRequester.statusLines()...)
+}
+
+func (me *httpSeedPeer) String() string {
+	return fmt.Sprintf("http seed peer for %q", me.client.Url)
+}
+
+func (me *httpSeedPeer) onGotInfo(info *metainfo.Info) {
+	me.pieces.AddRange(0, uint64(info.NumPieces()))
+	me.pieces.Iterate(func(x uint32) bool {
+		me.peer.t.incPieceAvailability(pieceIndex(x))
+		return true
+	})
+}
+
+func (me *httpSeedPeer) writeInterested(interested bool) bool {
+	return true
+}
+
+func (me *httpSeedPeer) connectionFlags() string {
+	return "HS"
+}
+
+func (me *httpSeedPeer) drop() {}
+
+func (me *httpSeedPeer) ban() {
+	me.peer.close()
+}
+
+func (me *httpSeedPeer) peerHasAllPieces() (all, known bool) {
+	if !me.peer.t.haveInfo() {
+		return true, false
+	}
+	return me.pieces.GetCardinality() == uint64(me.peer.t.numPieces()), true
+}
+
+func (me *httpSeedPeer) peerPieces() *roaring.Bitmap {
+	return &me.pieces
+}
+
+// Returns the requests from x to the end of its piece that are wanted from this peer and not
+// already being handled. BEP 17 allows them to be fetched with a single HTTP request.
+func (me *httpSeedPeer) requestsFrom(x RequestIndex) (reqs []Request) {
+	t := me.peer.t
+	end := t.pieceRequestIndexOffset(t.pieceIndexOfRequestIndex(x) + 1)
+	for ; x < end; x++ {
+		if !me.peer.requestState.Requests.Contains(x) {
+			continue
+		}
+		r := t.requestIndexToRequest(x)
+		if _, ok := me.activeRequests[r]; ok {
+			continue
+		}
+		reqs = append(reqs, r)
+	}
+	return
+}
+
+// Merges adjacent chunks into ranges for the request.
+func requestsRanges(reqs []Request) (ret []httpseed.Range) {
+	for _, r := range reqs {
+		if n := len(ret); n != 0 && ret[n-1].Begin+ret[n-1].Length == int64(r.Begin) {
+			ret[n-1].Length += int64(r.Length)
+			continue
+		}
+		ret = append(ret, httpseed.Range{Begin: int64(r.Begin), Length: int64(r.Length)})
+	}
+	return
+}
+
+func (me *httpSeedPeer) doHttpRequest(ctx context.Context, reqs []Request) (io.ReadCloser, error) {
+	return me.client.Request(ctx, int(reqs[0].Index), requestsRanges(reqs))
+}
+
+func (me *httpSeedPeer) onRequestError(reqs []Request, err error) {
+	me.health.OnError(time.Now(), err)
+}
@@ -0,0 +1,99 @@
+// Package httpseed implements BEP 17 HTTP seeding, where a server script is asked for ranges of a
+// piece by infohash and piece index. See https://www.bittorrent.org/beps/bep_0017.html. BEP 19
+// webseeds, which map requests onto files, are handled by package webseed.
+package httpseed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/webseed"
+)
+
+// A range of bytes within a piece.
+type Range struct {
+	Begin  int64
+	Length int64
+}
+
+type Client struct {
+	HttpClient *http.Client
+	Url        string
+	InfoHash   metainfo.Hash
+	// Wrap http response bodies for such things as download rate limiting.
+	ResponseBodyWrapper func(io.Reader) io.Reader
+}
+
+// Formats ranges for the ranges query parameter. The ends are inclusive.
+func formatRanges(ranges []Range) string {
+	var sb strings.Builder
+	for i, r := range ranges {
+		if i != 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%d-%d", r.Begin, r.Begin+r.Length-1)
+	}
+	return sb.String()
+}
+
+func (me *Client) requestUrl(piece int, ranges []Range) (string, error) {
+	u, err := url.Parse(me.Url)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("info_hash", string(me.InfoHash[:]))
+	q.Set("piece", strconv.Itoa(piece))
+	if len(ranges) != 0 {
+		q.Set("ranges", formatRanges(ranges))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Requests the ranges of the piece. If no ranges are given, the whole piece is requested. The body
+// returns the data for the ranges concatenated in order, and must be closed. The server asking us to
+// wait returns webseed.ErrRetryAfter.
+func (me *Client) Request(ctx context.Context, piece int, ranges []Range) (io.ReadCloser, error) {
+	u, err := me.requestUrl(piece, ranges)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := me.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if me.ResponseBodyWrapper == nil {
+			return resp.Body, nil
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{me.ResponseBodyWrapper(resp.Body), resp.Body}, nil
+	case http.StatusServiceUnavailable:
+		// BEP 17 has the body give the number of seconds to wait.
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64))
+		var retryAfter webseed.ErrRetryAfter
+		if secs, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32); err == nil {
+			retryAfter.Duration = time.Duration(secs) * time.Second
+		}
+		return nil, retryAfter
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+}
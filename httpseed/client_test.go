@@ -0,0 +1,89 @@
+package httpseed
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/webseed"
+)
+
+func newTestServer(t *testing.T, h http.Handler) *Client {
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return &Client{
+		HttpClient: s.Client(),
+		Url:        s.URL + "/seed?key=value",
+		InfoHash:   metainfo.NewHashFromHex("0123456789abcdef0123456789abcdef01234567"),
+	}
+}
+
+func TestRequest(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	info := &metainfo.Info{
+		Name:        "data",
+		Length:      int64(len(data)),
+		PieceLength: 100,
+		Pieces:      make([]byte, 3*metainfo.HashSize),
+	}
+	var c *Client
+	c = newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The existing query is kept.
+		qt.Check(t, qt.Equals(r.URL.Query().Get("key"), "value"))
+		(&Handler{
+			Info:     info,
+			InfoHash: c.InfoHash,
+			Data:     bytes.NewReader(data),
+		}).ServeHTTP(w, r)
+	}))
+	read := func(piece int, ranges ...Range) []byte {
+		body, err := c.Request(context.Background(), piece, ranges)
+		qt.Assert(t, qt.IsNil(err))
+		defer body.Close()
+		b, err := io.ReadAll(body)
+		qt.Assert(t, qt.IsNil(err))
+		return b
+	}
+	qt.Check(t, qt.DeepEquals(read(1), data[100:200]))
+	// The last piece is short.
+	qt.Check(t, qt.DeepEquals(read(2), data[200:]))
+	qt.Check(t, qt.DeepEquals(
+		read(1, Range{0, 10}, Range{50, 5}),
+		append(data[100:110:110], data[150:155]...)))
+	_, err := c.Request(context.Background(), 2, []Range{{40, 20}})
+	qt.Check(t, qt.IsNotNil(err))
+	_, err = c.Request(context.Background(), 3, nil)
+	qt.Check(t, qt.IsNotNil(err))
+}
+
+func TestRequestRetryAfter(t *testing.T) {
+	c := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "30")
+	}))
+	_, err := c.Request(context.Background(), 0, nil)
+	qt.Check(t, qt.ErrorIs(err, webseed.ErrTooFast))
+	var retryAfter webseed.ErrRetryAfter
+	qt.Assert(t, qt.ErrorAs(err, &retryAfter))
+	qt.Check(t, qt.Equals(retryAfter.Duration, 30*time.Second))
+}
+
+func TestFormatAndParseRanges(t *testing.T) {
+	ranges := []Range{{0, 10}, {16384, 16384}}
+	s := formatRanges(ranges)
+	qt.Check(t, qt.Equals(s, "0-9,16384-32767"))
+	parsed, err := parseRanges(s, 32768)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(parsed, ranges))
+	_, err = parseRanges(s, 32767)
+	qt.Check(t, qt.IsNotNil(err))
+	_, err = parseRanges("5", 100)
+	qt.Check(t, qt.IsNotNil(err))
+}
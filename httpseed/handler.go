@@ -0,0 +1,80 @@
+package httpseed
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Serves BEP 17 requests for a single torrent. It's intended for tests, with httptest.Server.
+type Handler struct {
+	Info     *metainfo.Info
+	InfoHash metainfo.Hash
+	// The torrent data, addressed by offset in the torrent.
+	Data io.ReaderAt
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+func (me *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("info_hash") != string(me.InfoHash[:]) {
+		http.Error(w, "unknown info_hash", http.StatusNotFound)
+		return
+	}
+	piece, err := strconv.Atoi(q.Get("piece"))
+	if err != nil || piece < 0 || piece >= me.Info.NumPieces() {
+		http.Error(w, "bad piece", http.StatusBadRequest)
+		return
+	}
+	// BEP 17 predates v2, so pieces are v1 pieces.
+	p := me.Info.Piece(piece)
+	ranges := []Range{{0, p.V1Length()}}
+	if s := q.Get("ranges"); s != "" {
+		ranges, err = parseRanges(s, p.V1Length())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var length int64
+	for _, r := range ranges {
+		length += r.Length
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	for _, r := range ranges {
+		_, err := io.Copy(w, io.NewSectionReader(me.Data, p.Offset()+r.Begin, r.Length))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Parses the ranges query parameter, checking they're within a piece of the given length.
+func parseRanges(s string, pieceLength int64) (ret []Range, err error) {
+	for _, field := range strings.Split(s, ",") {
+		beginStr, endStr, ok := strings.Cut(field, "-")
+		if !ok {
+			return nil, fmt.Errorf("bad range %q", field)
+		}
+		var begin, end int64
+		begin, err = strconv.ParseInt(beginStr, 10, 64)
+		if err != nil {
+			return
+		}
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return
+		}
+		if begin < 0 || end < begin || end >= pieceLength {
+			return nil, fmt.Errorf("range %q out of bounds", field)
+		}
+		ret = append(ret, Range{begin, end - begin + 1})
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package torrent
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/httpseed"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Serves random data from a BEP 17 HTTP seed, and returns the metainfo with the seed added.
+func newTestHttpSeed(t *testing.T) (mi metainfo.MetaInfo, data []byte) {
+	data = make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	info := metainfo.Info{
+		Name:        "data",
+		Length:      int64(len(data)),
+		PieceLength: 1 << 15,
+	}
+	qt.Assert(t, qt.IsNil(info.GeneratePieces(func(metainfo.FileInfo) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})))
+	mi.InfoBytes = bencode.MustMarshal(info)
+	s := httptest.NewServer(&httpseed.Handler{
+		Info:     &info,
+		InfoHash: mi.HashInfoBytes(),
+		Data:     bytes.NewReader(data),
+	})
+	t.Cleanup(s.Close)
+	mi.HttpSeeds = []string{s.URL + "/seed"}
+	return
+}
+
+// Checks that a torrent can be downloaded from only a BEP 17 HTTP seed.
+func TestHttpSeedDownload(t *testing.T) {
+	mi, data := newTestHttpSeed(t)
+	cfg := TestingConfig(t)
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, _, err := cl.AddTorrentSpec(TorrentSpecFromMetaInfo(&mi))
+	qt.Assert(t, qt.IsNil(err))
+	r := tor.NewReader()
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(bytes.Equal(got, data)))
+}
+
+// An HTTP seed added before the info should count once toward piece availability, and not at all
+// after it's closed.
+func TestHttpSeedAddedBeforeInfoAvailability(t *testing.T) {
+	mi, _ := newTestHttpSeed(t)
+	cl, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, _ := cl.AddTorrentOpt(AddTorrentOpts{InfoHash: mi.HashInfoBytes()})
+	tor.AddHttpSeeds(mi.HttpSeeds)
+	qt.Assert(t, qt.IsNil(tor.SetInfoBytes(mi.InfoBytes)))
+	checkAvailability := func(want int) {
+		cl.rLock()
+		defer cl.rUnlock()
+		for i := range tor.numPieces() {
+			qt.Check(t, qt.Equals(tor.piece(i).availability(), want), qt.Commentf("piece %v", i))
+		}
+	}
+	checkAvailability(1)
+	cl.lock()
+	hs := tor.httpSeeds[mi.HttpSeeds[0]]
+	cl.unlock()
+	qt.Assert(t, qt.IsNil(hs.Close()))
+	checkAvailability(0)
+}
@@ -0,0 +1,204 @@
+// Package httpstream serves the files of torrents in a torrent.Client over HTTP, so they can be
+// streamed while they download. Range requests are supported, so media players can seek.
+package httpstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/types"
+)
+
+// Serves torrents from Client. The routes are:
+//
+//	/                      JSON list of torrents
+//	/<infohash>/           JSON list of the torrent's files
+//	/<infohash>/<path>     file data, where path is File.DisplayPath
+//
+// File requests take the query parameters readahead (bytes), responsive (bool), and priority
+// ("normal" or "high", which also downloads the whole file in the background).
+type Handler struct {
+	Client *torrent.Client
+	// The readahead for file requests that don't give one. Zero leaves the Reader default.
+	Readahead int64
+	// Return data before pieces are verified, unless a request says otherwise.
+	Responsive bool
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+func (me *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if p == "" {
+		me.serveTorrents(w)
+		return
+	}
+	ihStr, filePath, _ := strings.Cut(p, "/")
+	var ih metainfo.Hash
+	if err := ih.FromHexString(ihStr); err != nil {
+		http.Error(w, "bad infohash", http.StatusBadRequest)
+		return
+	}
+	t, ok := me.Client.Torrent(ih)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// This lets magnet links be streamed as soon as they're added.
+	select {
+	case <-t.GotInfo():
+	case <-r.Context().Done():
+		return
+	}
+	if filePath == "" {
+		serveFiles(w, t)
+		return
+	}
+	for i, f := range t.Files() {
+		if f.DisplayPath() == filePath {
+			me.serveFile(w, r, f, i)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+type torrentJson struct {
+	InfoHash       string `json:"info_hash"`
+	Name           string `json:"name"`
+	HaveInfo       bool   `json:"have_info"`
+	Length         int64  `json:"length,omitempty"`
+	BytesCompleted int64  `json:"bytes_completed"`
+}
+
+type fileJson struct {
+	Path           string `json:"path"`
+	Length         int64  `json:"length"`
+	BytesCompleted int64  `json:"bytes_completed"`
+	// Relative to the torrent's listing.
+	Url string `json:"url"`
+}
+
+func makeTorrentJson(t *torrent.Torrent) (ret torrentJson) {
+	ret = torrentJson{
+		InfoHash:       t.InfoHash().HexString(),
+		Name:           t.Name(),
+		BytesCompleted: t.BytesCompleted(),
+	}
+	if t.Info() != nil {
+		ret.HaveInfo = true
+		ret.Length = t.Length()
+	}
+	return
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (me *Handler) serveTorrents(w http.ResponseWriter) {
+	ret := []torrentJson{}
+	for _, t := range me.Client.Torrents() {
+		ret = append(ret, makeTorrentJson(t))
+	}
+	writeJson(w, ret)
+}
+
+func serveFiles(w http.ResponseWriter, t *torrent.Torrent) {
+	ret := struct {
+		torrentJson
+		Files []fileJson `json:"files"`
+	}{
+		torrentJson: makeTorrentJson(t),
+		Files:       []fileJson{},
+	}
+	for _, f := range t.Files() {
+		ret.Files = append(ret.Files, fileJson{
+			Path:           f.DisplayPath(),
+			Length:         f.Length(),
+			BytesCompleted: f.BytesCompleted(),
+			Url:            escapePath(f.DisplayPath()),
+		})
+	}
+	writeJson(w, ret)
+}
+
+func escapePath(p string) string {
+	comps := strings.Split(p, "/")
+	for i, c := range comps {
+		comps[i] = url.PathEscape(c)
+	}
+	return strings.Join(comps, "/")
+}
+
+var priorities = map[string]types.PiecePriority{
+	"normal": types.PiecePriorityNormal,
+	"high":   types.PiecePriorityHigh,
+}
+
+func (me *Handler) serveFile(w http.ResponseWriter, r *http.Request, f *torrent.File, fileIndex int) {
+	q := r.URL.Query()
+	readahead := me.Readahead
+	if s := q.Get("readahead"); s != "" {
+		var err error
+		readahead, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || readahead < 0 {
+			http.Error(w, "bad readahead", http.StatusBadRequest)
+			return
+		}
+	}
+	responsive := me.Responsive
+	if s := q.Get("responsive"); s != "" {
+		var err error
+		responsive, err = strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, "bad responsive", http.StatusBadRequest)
+			return
+		}
+	}
+	if s := q.Get("priority"); s != "" {
+		prio, ok := priorities[s]
+		if !ok {
+			http.Error(w, "bad priority", http.StatusBadRequest)
+			return
+		}
+		if f.Priority() < prio {
+			f.SetPriority(prio)
+		}
+	}
+	reader := f.NewReader()
+	defer reader.Close()
+	// Reads stop when the client goes away.
+	reader.SetContext(r.Context())
+	if readahead != 0 {
+		reader.SetReadahead(readahead)
+	}
+	if responsive {
+		reader.SetResponsive()
+	}
+	// Torrent data never changes, so the infohash and file identify the content. This is what
+	// If-Range and If-None-Match are checked against.
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, f.Torrent().InfoHash().HexString(), fileIndex))
+	// Set it explicitly, because sniffing the content could block waiting for data.
+	contentType := mime.TypeByExtension(path.Ext(f.DisplayPath()))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, path.Base(f.DisplayPath()), time.Time{}, reader)
+}
@@ -0,0 +1,80 @@
+package httpstream
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestHandler(t *testing.T) {
+	cfg := torrent.TestingConfig(t)
+	testutil.CreateDummyTorrentData(cfg.DataDir)
+	cl, err := torrent.NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(tor.VerifyData()))
+	s := httptest.NewServer(&Handler{Client: cl})
+	defer s.Close()
+	ih := tor.InfoHash().HexString()
+
+	get := func(path string, header http.Header) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, s.URL+path, nil)
+		qt.Assert(t, qt.IsNil(err))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := s.Client().Do(req)
+		qt.Assert(t, qt.IsNil(err))
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		qt.Assert(t, qt.IsNil(err))
+		return resp, string(b)
+	}
+
+	_, body := get("/", nil)
+	var torrents []torrentJson
+	qt.Assert(t, qt.IsNil(json.Unmarshal([]byte(body), &torrents)))
+	qt.Assert(t, qt.HasLen(torrents, 1))
+	qt.Check(t, qt.Equals(torrents[0].InfoHash, ih))
+	qt.Check(t, qt.Equals(torrents[0].Length, int64(len(testutil.GreetingFileContents))))
+
+	_, body = get("/"+ih+"/", nil)
+	var files struct {
+		Files []fileJson `json:"files"`
+	}
+	qt.Assert(t, qt.IsNil(json.Unmarshal([]byte(body), &files)))
+	qt.Assert(t, qt.HasLen(files.Files, 1))
+	qt.Check(t, qt.Equals(files.Files[0].Url, "greeting"))
+
+	filePath := "/" + ih + "/greeting"
+	resp, body := get(filePath, nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusOK))
+	qt.Check(t, qt.Equals(body, testutil.GreetingFileContents))
+	etag := resp.Header.Get("ETag")
+	qt.Check(t, qt.Not(qt.Equals(etag, "")))
+
+	resp, body = get(filePath, http.Header{"Range": {"bytes=2-5"}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusPartialContent))
+	qt.Check(t, qt.Equals(body, testutil.GreetingFileContents[2:6]))
+	// A stale If-Range gets the whole file.
+	resp, _ = get(filePath, http.Header{"Range": {"bytes=2-5"}, "If-Range": {`"stale"`}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusOK))
+	resp, _ = get(filePath, http.Header{"Range": {"bytes=2-5"}, "If-Range": {etag}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusPartialContent))
+	resp, _ = get(filePath, http.Header{"If-None-Match": {etag}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusNotModified))
+
+	resp, _ = get("/"+ih+"/missing", nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusNotFound))
+	resp, _ = get(filePath+"?readahead=-1", nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusBadRequest))
+}
@@ -0,0 +1,229 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/internal/clonefile"
+	"github.com/anacrolix/torrent/merkle"
+)
+
+type ImportDataOpts struct {
+	// Hard-link files into the torrent's data dir where possible, instead of copying them. The
+	// source file then shares data with the torrent's file, so it's modified by anything written
+	// there later, such as when the torrent redownloads a piece. Files with pieces that also
+	// hold data from other files are still copied, since those parts aren't checked.
+	HardLink bool
+}
+
+// A file found by Torrent.ImportData.
+type ImportedFile struct {
+	File *File
+	// The path of the file that had the data.
+	Source string
+	// The source was hard-linked into place, rather than copied.
+	Linked bool
+}
+
+// Searches dir for files with the same content as the torrent's files, regardless of their names,
+// and puts the data into storage. Candidates are matched by length, and then by the file's v2
+// merkle root, or the v1 hashes of the pieces that lie entirely within the file. Files are copied
+// into place if the torrent is stored in a data dir and they don't exist there yet, using reflinks
+// where the filesystem supports them. Otherwise the data is written through storage. The pieces
+// of imported files are verified. The torrent must have its info. This is best done before
+// downloading starts.
+func (t *Torrent) ImportData(ctx context.Context, dir string, opts ImportDataOpts) (ret []ImportedFile, err error) {
+	if t.Info() == nil {
+		return nil, errors.New("torrent has no info")
+	}
+	candidates := make(map[int64][]string)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		candidates[fi.Size()] = append(candidates[fi.Size()], path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %q: %w", dir, err)
+	}
+	for _, f := range t.Files() {
+		if f.Length() == 0 || f.fi.IsPadding() {
+			continue
+		}
+		for _, path := range candidates[f.Length()] {
+			var ok bool
+			ok, err = t.fileDataMatches(ctx, f, path)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				t.logger.Levelf(log.Warning, "checking %q for %v: %v", path, f, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			imported := ImportedFile{File: f, Source: path}
+			imported.Linked, err = t.importFile(f, path, opts)
+			if err != nil {
+				return ret, fmt.Errorf("importing %q for %v: %w", path, f, err)
+			}
+			ret = append(ret, imported)
+			break
+		}
+	}
+	for _, imported := range ret {
+		f := imported.File
+		for i := f.BeginPieceIndex(); i < f.EndPieceIndex(); i++ {
+			err = t.Piece(i).VerifyDataContext(ctx)
+			if err != nil {
+				return ret, fmt.Errorf("verifying piece %v: %w", i, err)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Whether the file at path has the content of f, as far as can be determined from f's hashes.
+func (t *Torrent) fileDataMatches(ctx context.Context, f *File, path string) (bool, error) {
+	osFile, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer osFile.Close()
+	if f.piecesRoot.Ok {
+		h := merkle.NewHash()
+		_, err := io.Copy(h, ctxReader{ctx, osFile})
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(h.Sum(nil), f.piecesRoot.Value[:]), nil
+	}
+	// Pieces that straddle other files can't be checked.
+	checked := false
+	for i := f.BeginPieceIndex(); i < f.EndPieceIndex(); i++ {
+		p := t.info.Piece(i)
+		hash := p.V1Hash()
+		if !hash.Ok || p.Offset() < f.Offset() || p.Offset()+p.Length() > f.Offset()+f.Length() {
+			continue
+		}
+		h := sha1.New()
+		_, err := io.Copy(h, io.NewSectionReader(ctxReaderAt{ctx, osFile}, p.Offset()-f.Offset(), p.Length()))
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(h.Sum(nil), hash.Value[:]) {
+			return false, nil
+		}
+		checked = true
+	}
+	return checked, nil
+}
+
+// Puts the data of the file at path into storage for f. Returns true if it was hard-linked.
+func (t *Torrent) importFile(f *File, path string, opts ImportDataOpts) (linked bool, err error) {
+	t.cl.rLock()
+	dataDir := t.dataDir
+	t.cl.rUnlock()
+	if dataDir != "" {
+		target := t.dataDirFilePath(dataDir, f)
+		if _, err := os.Lstat(target); errors.Is(err, os.ErrNotExist) {
+			os.MkdirAll(filepath.Dir(target), 0o777)
+			if opts.HardLink && !t.fileSharesPieces(f) {
+				err = os.Link(path, target)
+				if err == nil {
+					return true, nil
+				}
+				t.logger.Levelf(log.Info, "linking %q to %q failed, copying instead: %v", path, target, err)
+			}
+			err = clonefile.Clone(path, target)
+			if err == nil {
+				return false, nil
+			}
+			t.logger.Levelf(log.Info, "copying %q to %q failed, writing to storage instead: %v", path, target, err)
+		}
+	}
+	return false, t.copyFileIntoStorage(f, path)
+}
+
+// Whether the first or last piece of f also has data from other files. Those pieces are written
+// in full when they're downloaded.
+func (t *Torrent) fileSharesPieces(f *File) bool {
+	if t.info.FilesArePieceAligned() {
+		return false
+	}
+	first := t.info.Piece(f.BeginPieceIndex())
+	last := t.info.Piece(f.EndPieceIndex() - 1)
+	return first.Offset() != f.Offset() || last.Offset()+last.Length() != f.Offset()+f.Length()
+}
+
+func (t *Torrent) copyFileIntoStorage(f *File, path string) error {
+	osFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer osFile.Close()
+	t.storageIoLock.RLock()
+	defer t.storageIoLock.RUnlock()
+	var buf []byte
+	for i := f.BeginPieceIndex(); i < f.EndPieceIndex(); i++ {
+		p := t.piece(i)
+		info := p.Info()
+		// The part of the piece that's in the file.
+		begin := max(info.Offset(), f.Offset())
+		end := min(info.Offset()+info.Length(), f.Offset()+f.Length())
+		buf = slices.Grow(buf[:0], int(end-begin))[:end-begin]
+		_, err := osFile.ReadAt(buf, begin-f.Offset())
+		if err != nil {
+			return err
+		}
+		_, err = p.Storage().WriteAt(buf, begin-info.Offset())
+		if err != nil {
+			return fmt.Errorf("writing piece %v: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Stops reads when the context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (me ctxReader) Read(b []byte) (int, error) {
+	if err := me.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return me.r.Read(b)
+}
+
+type ctxReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (me ctxReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if err := me.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return me.r.ReadAt(b, off)
+}
@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestImportData(t *testing.T) {
+	for _, hardLink := range []bool{false, true} {
+		cfg := TestingConfig(t)
+		cl, err := NewClient(cfg)
+		qt.Assert(t, qt.IsNil(err))
+		defer cl.Close()
+		tor, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+		qt.Assert(t, qt.IsNil(err))
+
+		srcDir := t.TempDir()
+		src := filepath.Join(srcDir, "renamed")
+		qt.Assert(t, qt.IsNil(os.WriteFile(src, []byte(testutil.GreetingFileContents), 0o644)))
+		// Same length, different content.
+		qt.Assert(t, qt.IsNil(os.WriteFile(
+			filepath.Join(srcDir, "decoy"),
+			make([]byte, len(testutil.GreetingFileContents)),
+			0o644)))
+
+		imported, err := tor.ImportData(context.Background(), srcDir, ImportDataOpts{HardLink: hardLink})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.HasLen(imported, 1))
+		qt.Check(t, qt.Equals(imported[0].Source, src))
+		qt.Check(t, qt.Equals(imported[0].Linked, hardLink))
+		qt.Check(t, qt.IsTrue(tor.Complete().Bool()))
+		target := filepath.Join(cfg.DataDir, testutil.GreetingFileName)
+		b, err := os.ReadFile(target)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(string(b), testutil.GreetingFileContents))
+		qt.Check(t, qt.Equals(sameFile(t, src, target), hardLink))
+	}
+}
+
+// Files sharing pieces with other files aren't hard-linked, since the shared pieces aren't checked
+// against the source, and downloading them would write into it.
+func TestImportDataSharedPiecesNotLinked(t *testing.T) {
+	files := map[string]string{
+		"a": "hello",
+		"b": "goodbye",
+	}
+	info := metainfo.Info{
+		Name:        "t",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: int64(len(files["a"]))},
+			{Path: []string{"b"}, Length: int64(len(files["b"]))},
+		},
+	}
+	qt.Assert(t, qt.IsNil(info.GeneratePieces(func(fi metainfo.FileInfo) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[fi.Path[0]])), nil
+	})))
+	cfg := TestingConfig(t)
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(info)})
+	qt.Assert(t, qt.IsNil(err))
+	srcDir := t.TempDir()
+	for name, data := range files {
+		qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(srcDir, name), []byte(data), 0o644)))
+	}
+	imported, err := tor.ImportData(context.Background(), srcDir, ImportDataOpts{HardLink: true})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.HasLen(imported, 2))
+	for _, i := range imported {
+		qt.Check(t, qt.IsFalse(i.Linked))
+		qt.Check(t, qt.IsFalse(sameFile(t, i.Source, filepath.Join(cfg.DataDir, filepath.FromSlash(i.File.Path())))))
+	}
+	qt.Check(t, qt.IsTrue(tor.Complete().Bool()))
+}
+
+func sameFile(t *testing.T, a, b string) bool {
+	aFi, err := os.Stat(a)
+	qt.Assert(t, qt.IsNil(err))
+	bFi, err := os.Stat(b)
+	qt.Assert(t, qt.IsNil(err))
+	return os.SameFile(aFi, bFi)
+}
@@ -0,0 +1,52 @@
+// Package clonefile makes independent copies of files, sharing their data where the filesystem
+// supports it.
+package clonefile
+
+import (
+	"io"
+	"os"
+)
+
+// Creates dst with the contents of src. dst must not exist. A reflink is used if possible, so the
+// copy is cheap, but unlike a hard link, writes to either file don't affect the other. Otherwise the
+// data is copied.
+func Clone(src, dst string) error {
+	return clone(src, dst, true)
+}
+
+// Creates dst as a reflink of src. dst must not exist. Unlike Clone, the data is never copied: an
+// error is returned if the filesystem doesn't support reflinks.
+func Reflink(src, dst string) error {
+	return clone(src, dst, false)
+}
+
+func clone(src, dst string, copyFallback bool) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := out.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	err = reflink(out, in)
+	if err == nil || !copyFallback {
+		return
+	}
+	_, err = io.Copy(out, in)
+	return
+}
@@ -0,0 +1,43 @@
+package clonefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	qt.Assert(t, qt.IsNil(os.WriteFile(src, []byte("hello"), 0o644)))
+	qt.Assert(t, qt.IsNil(Clone(src, dst)))
+	b, err := os.ReadFile(dst)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "hello"))
+	qt.Assert(t, qt.IsNil(os.WriteFile(dst, []byte("world"), 0o644)))
+	b, err = os.ReadFile(src)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "hello"))
+	// Existing files aren't replaced.
+	qt.Check(t, qt.ErrorIs(Clone(src, dst), os.ErrExist))
+}
+
+func TestReflinkLeavesNoFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	qt.Assert(t, qt.IsNil(os.WriteFile(src, []byte("hello"), 0o644)))
+	err := Reflink(src, dst)
+	if err == nil {
+		b, err := os.ReadFile(dst)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(string(b), "hello"))
+		return
+	}
+	// The filesystem doesn't support reflinks, and the data isn't copied instead.
+	_, err = os.Lstat(dst)
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+}
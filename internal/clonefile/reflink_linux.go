@@ -0,0 +1,11 @@
+package clonefile
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func reflink(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package clonefile
+
+import (
+	"errors"
+	"os"
+)
+
+func reflink(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,86 @@
+package torrent
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/lsd"
+)
+
+// BEP 14 suggests announcing each torrent every 5 minutes, and not more than once a minute.
+const lsdAnnounceInterval = 5 * time.Minute
+
+func (cl *Client) startLsd() {
+	s, err := lsd.NewServer(lsd.ServerConfig{
+		Interface:  cl.config.LocalServiceDiscoveryInterface,
+		OnAnnounce: cl.onLsdAnnounce,
+		Logger:     cl.logger.WithNames("lsd"),
+	})
+	if err != nil {
+		cl.logger.Levelf(log.Warning, "starting local service discovery: %v", err)
+		return
+	}
+	cl.lsd = s
+	cl.onClose = append(cl.onClose, func() { s.Close() })
+	go cl.lsdAnnouncer()
+}
+
+func (cl *Client) onLsdAnnounce(a lsd.Announce, from netip.AddrPort) {
+	cl.lock()
+	defer cl.unlock()
+	for _, ih := range a.InfoHashes {
+		t, ok := cl.torrentsByShortHash[ih]
+		if !ok || !t.lsdAllowed() {
+			continue
+		}
+		t.addPeers([]PeerInfo{{
+			Addr:   ipPortAddr{from.Addr().AsSlice(), a.Port},
+			Source: PeerSourceLsd,
+		}})
+	}
+}
+
+// Private torrents must only get peers from their trackers (BEP 27). Until the info is known, the
+// torrent might be private.
+func (t *Torrent) lsdAllowed() bool {
+	return t.haveInfo() && (t.info.Private == nil || !*t.info.Private)
+}
+
+func (cl *Client) lsdAnnouncer() {
+	for {
+		cl.lock()
+		var ihs [][20]byte
+		for t := range cl.torrents {
+			if t.lsdAllowed() {
+				ihs = append(ihs, t.InfoHash())
+			}
+		}
+		port := cl.incomingPeerPort()
+		cl.unlock()
+		if port != 0 {
+			err := cl.lsd.Announce(port, ihs)
+			if err != nil {
+				cl.logger.Levelf(log.Debug, "announcing to local service discovery: %v", err)
+			}
+		}
+		select {
+		case <-cl.closed.Done():
+			return
+		case <-time.After(lsdAnnounceInterval):
+		}
+	}
+}
+
+// Announces a torrent when its info is known rather than waiting for the next periodic announce.
+func (cl *Client) lsdAnnounceTorrent(t *Torrent) {
+	if cl.lsd == nil || !t.lsdAllowed() {
+		return
+	}
+	port := cl.incomingPeerPort()
+	if port == 0 {
+		return
+	}
+	go cl.lsd.Announce(port, [][20]byte{t.InfoHash()})
+}
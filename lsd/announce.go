@@ -0,0 +1,93 @@
+// Package lsd implements BEP 14 Local Service Discovery, which finds peers for torrents on the local
+// network by multicasting announces.
+package lsd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+)
+
+var (
+	Ipv4Group = &net.UDPAddr{IP: net.IPv4(239, 192, 152, 143), Port: 6771}
+	Ipv6Group = &net.UDPAddr{IP: net.ParseIP("ff15::efc0:988f"), Port: 6771}
+)
+
+const requestLine = "BT-SEARCH * HTTP/1.1"
+
+// Announces more than this many info-hashes are split up, to stay within a typical MTU.
+const maxInfoHashesPerAnnounce = 20
+
+type Announce struct {
+	// The announcer's BitTorrent listen port.
+	Port int
+	// Info-hashes are hex-encoded on the wire.
+	InfoHashes [][20]byte
+	// Lets an announcer recognise its own announces when they're looped back. Optional.
+	Cookie string
+}
+
+// Encodes the announce as sent to the multicast group.
+func (me Announce) Marshal(group *net.UDPAddr) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\r\n", requestLine)
+	fmt.Fprintf(&b, "Host: %s\r\n", group)
+	fmt.Fprintf(&b, "Port: %d\r\n", me.Port)
+	for _, ih := range me.InfoHashes {
+		fmt.Fprintf(&b, "Infohash: %x\r\n", ih)
+	}
+	if me.Cookie != "" {
+		fmt.Fprintf(&b, "cookie: %s\r\n", me.Cookie)
+	}
+	b.WriteString("\r\n\r\n")
+	return b.Bytes()
+}
+
+// Parses an announce. Info-hashes that aren't valid are skipped.
+func ParseAnnounce(b []byte) (ret Announce, err error) {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(b)))
+	line, err := r.ReadLine()
+	if err != nil {
+		return
+	}
+	if line != requestLine {
+		err = fmt.Errorf("unexpected request line %q", line)
+		return
+	}
+	h, err := r.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return
+	}
+	err = nil
+	ret.Port, err = strconv.Atoi(h.Get("Port"))
+	if err != nil {
+		err = fmt.Errorf("parsing port: %w", err)
+		return
+	}
+	if ret.Port <= 0 || ret.Port > 0xffff {
+		err = fmt.Errorf("invalid port %v", ret.Port)
+		return
+	}
+	for _, s := range h.Values("Infohash") {
+		var ih [20]byte
+		if hex.DecodedLen(len(s)) != len(ih) {
+			continue
+		}
+		if _, err := hex.Decode(ih[:], []byte(s)); err != nil {
+			continue
+		}
+		ret.InfoHashes = append(ret.InfoHashes, ih)
+	}
+	if len(ret.InfoHashes) == 0 {
+		err = errors.New("no valid info-hashes")
+		return
+	}
+	ret.Cookie = h.Get("Cookie")
+	return
+}
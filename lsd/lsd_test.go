@@ -0,0 +1,84 @@
+package lsd
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+func TestAnnounceRoundTrip(t *testing.T) {
+	a := Announce{
+		Port:       6881,
+		InfoHashes: [][20]byte{{1}, {2, 3}},
+		Cookie:     "abc",
+	}
+	b := a.Marshal(Ipv4Group)
+	qt.Check(t, qt.Equals(string(b), "BT-SEARCH * HTTP/1.1\r\n"+
+		"Host: 239.192.152.143:6771\r\n"+
+		"Port: 6881\r\n"+
+		"Infohash: 0100000000000000000000000000000000000000\r\n"+
+		"Infohash: 0203000000000000000000000000000000000000\r\n"+
+		"cookie: abc\r\n"+
+		"\r\n\r\n"))
+	parsed, err := ParseAnnounce(b)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(parsed, a))
+}
+
+func TestParseAnnounceSkipsBadInfohashes(t *testing.T) {
+	a, err := ParseAnnounce([]byte("BT-SEARCH * HTTP/1.1\r\n" +
+		"Host: [ff15::efc0:988f]:6771\r\n" +
+		"Port: 1\r\n" +
+		"Infohash: nope\r\n" +
+		"Infohash: ABCDEF0000000000000000000000000000000000\r\n" +
+		"\r\n"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(a.InfoHashes, [][20]byte{{0xab, 0xcd, 0xef}}))
+	_, err = ParseAnnounce([]byte("GET / HTTP/1.1\r\nPort: 1\r\n\r\n"))
+	qt.Check(t, qt.IsNotNil(err))
+	_, err = ParseAnnounce([]byte("BT-SEARCH * HTTP/1.1\r\nPort: 1\r\nInfohash: 00\r\n\r\n"))
+	qt.Check(t, qt.IsNotNil(err))
+}
+
+type receivedAnnounce struct {
+	Announce
+	from netip.AddrPort
+}
+
+func newTestServer(t *testing.T) (*Server, chan receivedAnnounce) {
+	c := make(chan receivedAnnounce, 10)
+	s, err := NewServer(ServerConfig{
+		OnAnnounce: func(a Announce, from netip.AddrPort) {
+			c <- receivedAnnounce{a, from}
+		},
+	})
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, c
+}
+
+func TestServersOnSameHost(t *testing.T) {
+	s1, c1 := newTestServer(t)
+	_, c2 := newTestServer(t)
+	err := s1.Announce(42, [][20]byte{{1}})
+	if err != nil {
+		t.Skipf("sending to multicast groups: %v", err)
+	}
+	select {
+	case ra := <-c2:
+		qt.Check(t, qt.Equals(ra.Port, 42))
+		qt.Check(t, qt.DeepEquals(ra.InfoHashes, [][20]byte{{1}}))
+	case <-time.After(5 * time.Second):
+		t.Skip("no multicast loopback")
+	}
+	// Our own announces are ignored.
+	select {
+	case ra := <-c1:
+		t.Fatalf("received own announce: %v", ra)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
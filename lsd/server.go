@@ -0,0 +1,166 @@
+package lsd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/anacrolix/log"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+type ServerConfig struct {
+	// The interface to join the multicast groups and send announces on. The system chooses if nil.
+	Interface *net.Interface
+	// Called from the receiving goroutines with announces from other peers.
+	OnAnnounce func(a Announce, from netip.AddrPort)
+	Logger     log.Logger
+}
+
+// Sends and receives announces on the IPv4 and IPv6 LSD multicast groups.
+type Server struct {
+	config ServerConfig
+	cookie string
+	groups []*serverGroup
+
+	closeOnce sync.Once
+}
+
+type serverGroup struct {
+	addr *net.UDPAddr
+	// Joined to the group, and bound to the LSD port, which other processes can share.
+	recv *net.UDPConn
+	// Sends from an ephemeral port, with multicast loopback so other clients on this host hear us.
+	send *net.UDPConn
+}
+
+// Joins whichever of the multicast groups are available, and starts receiving announces. An error
+// is returned only if no group could be joined.
+func NewServer(config ServerConfig) (s *Server, err error) {
+	var cookie [8]byte
+	rand.Read(cookie[:])
+	s = &Server{
+		config: config,
+		cookie: hex.EncodeToString(cookie[:]),
+	}
+	var errs []error
+	for _, group := range []struct {
+		network string
+		addr    *net.UDPAddr
+	}{
+		{"udp4", Ipv4Group},
+		{"udp6", Ipv6Group},
+	} {
+		g, err := newServerGroup(group.network, group.addr, config.Interface)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("joining %v: %w", group.addr, err))
+			continue
+		}
+		s.groups = append(s.groups, g)
+	}
+	if len(s.groups) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		config.Logger.Levelf(log.Debug, "%v", err)
+	}
+	for _, g := range s.groups {
+		go s.receive(g)
+	}
+	return
+}
+
+func newServerGroup(network string, addr *net.UDPAddr, ifi *net.Interface) (_ *serverGroup, err error) {
+	recv, err := net.ListenMulticastUDP(network, ifi, addr)
+	if err != nil {
+		return
+	}
+	send, err := net.ListenUDP(network, nil)
+	if err != nil {
+		recv.Close()
+		return
+	}
+	if network == "udp4" {
+		pc := ipv4.NewPacketConn(send)
+		if ifi != nil {
+			err = pc.SetMulticastInterface(ifi)
+		}
+		if err == nil {
+			err = pc.SetMulticastLoopback(true)
+		}
+	} else {
+		pc := ipv6.NewPacketConn(send)
+		if ifi != nil {
+			err = pc.SetMulticastInterface(ifi)
+		}
+		if err == nil {
+			err = pc.SetMulticastLoopback(true)
+		}
+	}
+	if err != nil {
+		recv.Close()
+		send.Close()
+		return
+	}
+	return &serverGroup{addr, recv, send}, nil
+}
+
+func (s *Server) receive(g *serverGroup) {
+	b := make([]byte, 1<<16)
+	for {
+		n, from, err := g.recv.ReadFromUDPAddrPort(b)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.config.Logger.Levelf(log.Warning, "reading from %v: %v", g.addr, err)
+			}
+			return
+		}
+		a, err := ParseAnnounce(b[:n])
+		if err != nil {
+			s.config.Logger.Levelf(log.Debug, "parsing announce from %v: %v", from, err)
+			continue
+		}
+		if a.Cookie == s.cookie {
+			continue
+		}
+		if s.config.OnAnnounce != nil {
+			s.config.OnAnnounce(a, netip.AddrPortFrom(from.Addr().Unmap(), from.Port()))
+		}
+	}
+}
+
+// Announces the info-hashes with our listen port to all joined groups. BEP 14 asks that each
+// info-hash is announced no more than once a minute.
+func (s *Server) Announce(port int, infoHashes [][20]byte) (err error) {
+	for len(infoHashes) != 0 {
+		batch := infoHashes[:min(len(infoHashes), maxInfoHashesPerAnnounce)]
+		infoHashes = infoHashes[len(batch):]
+		a := Announce{
+			Port:       port,
+			InfoHashes: batch,
+			Cookie:     s.cookie,
+		}
+		for _, g := range s.groups {
+			_, writeErr := g.send.WriteToUDP(a.Marshal(g.addr), g.addr)
+			if writeErr != nil {
+				err = errors.Join(err, fmt.Errorf("sending to %v: %w", g.addr, writeErr))
+			}
+		}
+	}
+	return
+}
+
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		for _, g := range s.groups {
+			g.recv.Close()
+			g.send.Close()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"expvar"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Two clients on this host find each other through loopback multicast.
+func TestLsdTwoClients(t *testing.T) {
+	seederDataDir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(seederDataDir)
+	newClient := func(dataDir string) *Client {
+		cfg := TestingConfig(t)
+		cfg.Seed = true
+		cfg.DataDir = dataDir
+		cfg.LocalServiceDiscovery = true
+		// Only LSD should introduce the clients.
+		cfg.DisablePEX = true
+		// The seeder is announced before it has verified its data, and would otherwise refuse conns
+		// until it has.
+		cfg.AlwaysWantConns = true
+		// Announces come from a non-loopback address, so we have to listen on it.
+		cfg.ListenHost = func(string) string { return "" }
+		cl, err := NewClient(cfg)
+		qt.Assert(t, qt.IsNil(err))
+		t.Cleanup(func() { cl.Close() })
+		if cl.lsd == nil {
+			t.Skip("local service discovery unavailable")
+		}
+		return cl
+	}
+	leecher := newClient(t.TempDir())
+	leecherTorrent, _, _ := leecher.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	leecherTorrent.DownloadAll()
+	// Known swarm sources get replaced when the peer is learned some other way, so count the peers
+	// added from LSD announces instead.
+	lsdPeersAdded := func() int64 {
+		v, _ := torrent.Get(fmt.Sprintf("peers added by source %q", PeerSourceLsd)).(*expvar.Int)
+		if v == nil {
+			return 0
+		}
+		return v.Value()
+	}
+	lsdPeersAddedBefore := lsdPeersAdded()
+	// Adding the torrent announces it, now that the leecher is listening.
+	seeder := newClient(seederDataDir)
+	seederTorrent, _, _ := seeder.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	seederTorrent.VerifyData()
+	select {
+	case <-leecherTorrent.Complete().On():
+	case <-time.After(10 * time.Second):
+		t.Fatal("leecher didn't complete")
+	}
+	qt.Check(t, qt.IsTrue(lsdPeersAdded() > lsdPeersAddedBefore))
+}
+
+// Private torrents aren't announced or given LSD peers, including before it's known that they're
+// private.
+func TestLsdNotAllowedForPrivateTorrents(t *testing.T) {
+	cl, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	check := func(private bool) {
+		info := metainfo.Info{
+			Name:        "a",
+			Length:      1,
+			PieceLength: 1,
+			Pieces:      make([]byte, 20),
+			Private:     &private,
+		}
+		infoBytes, err := bencode.Marshal(info)
+		qt.Assert(t, qt.IsNil(err))
+		tor, _ := cl.AddTorrentInfoHash(metainfo.HashBytes(infoBytes))
+		defer tor.Drop()
+		cl.rLock()
+		qt.Check(t, qt.IsFalse(tor.lsdAllowed()))
+		cl.rUnlock()
+		qt.Assert(t, qt.IsNil(tor.SetInfoBytes(infoBytes)))
+		cl.rLock()
+		qt.Check(t, qt.Equals(tor.lsdAllowed(), !private))
+		cl.rUnlock()
+	}
+	check(true)
+	check(false)
+}
@@ -1,8 +1,19 @@
 package metainfo
 
+import "strings"
+
 // See BEP 47. This is common to both Info and FileInfo.
 type ExtendedFileAttrs struct {
 	Attr        string   `bencode:"attr,omitempty"`
 	SymlinkPath []string `bencode:"symlink path,omitempty"`
 	Sha1        string   `bencode:"sha1,omitempty"`
 }
+
+// Padding files contain only zeroes, and exist to align the following file to a piece boundary.
+func (me ExtendedFileAttrs) IsPadding() bool {
+	return strings.Contains(me.Attr, "p")
+}
+
+func (me ExtendedFileAttrs) IsSymlink() bool {
+	return strings.Contains(me.Attr, "l")
+}
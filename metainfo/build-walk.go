@@ -0,0 +1,200 @@
+package metainfo
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// How Info.BuildFromFilePathOpts handles symbolic links.
+type SymlinkPolicy int
+
+const (
+	// Symlinks are treated as the file or directory they point to.
+	SymlinksFollow SymlinkPolicy = iota
+	// Symlinks are left out.
+	SymlinksSkip
+	// Symlinks to paths inside the root are stored as BEP 47 symlinks. Other symlinks are followed.
+	// v2 file trees can't contain symlinks, so they only appear in v1 and hybrid infos.
+	SymlinksAttr
+)
+
+type filePathWalker struct {
+	root string
+	opts *BuildFromFilePathOpts
+	// The real paths of the directories being walked, to detect symlink cycles.
+	dirs  []string
+	files []FileInfo
+}
+
+// Walks the root, setting Name, and Files or Length. The files are unsorted. Directories are
+// implicit in torrent files, so empty ones are left out.
+func (info *Info) setFilesFromFilePath(root string, opts *BuildFromFilePathOpts) error {
+	info.Name = func() string {
+		b := filepath.Base(root)
+		switch b {
+		case ".", "..", string(filepath.Separator):
+			return NoName
+		default:
+			return b
+		}
+	}()
+	info.Files = nil
+	for _, pattern := range slices.Concat(opts.Include, opts.Exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		// The root is a file.
+		info.Length = fi.Size()
+		info.ExtendedFileAttrs = opts.fileAttrs(fi.Name(), fi.Mode())
+		return nil
+	}
+	w := filePathWalker{
+		root: root,
+		opts: opts,
+	}
+	err = w.walkDir(root, nil)
+	info.Files = w.files
+	return err
+}
+
+func (w *filePathWalker) walkDir(dir string, relPath []string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	realDir, err = filepath.Abs(realDir)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(w.dirs, realDir) {
+		return fmt.Errorf("symlink cycle at %q", dir)
+	}
+	w.dirs = append(w.dirs, realDir)
+	defer func() { w.dirs = w.dirs[:len(w.dirs)-1] }()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = w.walkEntry(filepath.Join(dir, entry.Name()), append(slices.Clip(relPath), entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *filePathWalker) walkEntry(fsPath string, relPath []string) error {
+	name := relPath[len(relPath)-1]
+	if w.opts.SkipHidden && strings.HasPrefix(name, ".") {
+		return nil
+	}
+	if matchGlobs(w.opts.Exclude, relPath) {
+		return nil
+	}
+	fi, err := os.Lstat(fsPath)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		switch w.opts.Symlinks {
+		case SymlinksSkip:
+			return nil
+		case SymlinksAttr:
+			target, ok, err := w.symlinkTarget(fsPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				w.addFile(relPath, FileInfo{
+					ExtendedFileAttrs: ExtendedFileAttrs{
+						Attr:        "l",
+						SymlinkPath: target,
+					},
+				})
+				return nil
+			}
+		}
+		fi, err = os.Stat(fsPath)
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case fi.IsDir():
+		return w.walkDir(fsPath, relPath)
+	case fi.Mode().IsRegular():
+		w.addFile(relPath, FileInfo{
+			Length:            fi.Size(),
+			ExtendedFileAttrs: w.opts.fileAttrs(name, fi.Mode()),
+		})
+	}
+	// Devices, sockets and the like have no data to share.
+	return nil
+}
+
+func (w *filePathWalker) addFile(relPath []string, fi FileInfo) {
+	if len(w.opts.Include) != 0 && !matchGlobs(w.opts.Include, relPath) {
+		return
+	}
+	fi.Path = relPath
+	w.files = append(w.files, fi)
+}
+
+// Returns the symlink's target as path components relative to the root, if it's inside it.
+func (w *filePathWalker) symlinkTarget(fsPath string) (target []string, ok bool, err error) {
+	dest, err := os.Readlink(fsPath)
+	if err != nil {
+		return
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(filepath.Dir(fsPath), dest)
+	}
+	rel, err := filepath.Rel(w.root, dest)
+	if err != nil {
+		// Not relative to the root at all, such as on another volume.
+		return nil, false, nil
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return
+	}
+	return strings.Split(rel, string(filepath.Separator)), true, nil
+}
+
+func (opts *BuildFromFilePathOpts) fileAttrs(name string, mode fs.FileMode) (ret ExtendedFileAttrs) {
+	if !opts.FileAttrs {
+		return
+	}
+	if mode&0o111 != 0 {
+		ret.Attr += "x"
+	}
+	if strings.HasPrefix(name, ".") {
+		ret.Attr += "h"
+	}
+	return
+}
+
+func matchGlobs(patterns []string, relPath []string) bool {
+	for _, pattern := range patterns {
+		subject := relPath[len(relPath)-1]
+		if strings.Contains(pattern, "/") {
+			subject = strings.Join(relPath, "/")
+		}
+		// Patterns were checked up front, so there are no errors.
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
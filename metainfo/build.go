@@ -0,0 +1,241 @@
+package metainfo
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent/merkle"
+)
+
+type BuildFromFilePathOpts struct {
+	// Create a BitTorrent v2 info (BEP 52), with a file tree and piece layers instead of v1 pieces.
+	V2 bool
+	// Create both the v1 and v2 fields, so that v1 and v2 clients share the swarm. Files in the v1
+	// file list are aligned to pieces with BEP 47 padding files.
+	Hybrid bool
+
+	// If any are given, only files matching one of these globs are included. Patterns without a
+	// slash match the base name, otherwise they match the slash-separated path relative to the root.
+	// See path.Match.
+	Include []string
+	// Files and directories matching any of these globs are left out. They're matched as for
+	// Include.
+	Exclude []string
+	// Leave out files and directories with names starting with a dot.
+	SkipHidden bool
+	Symlinks   SymlinkPolicy
+	// Set the BEP 47 executable ("x") and hidden ("h") attributes on files.
+	FileAttrs bool
+	// Align every file to a piece boundary with BEP 47 padding files. Hybrid infos are always
+	// aligned.
+	PadFiles bool
+	// Orders the v1 files. Sorts by path if nil. Ignored for v2 and hybrid infos, where the files
+	// must be in file tree order.
+	FileOrder func(l, r FileInfo) int
+
+	// Sets the private flag (BEP 27), if true.
+	Private bool
+	// Sets the source field, which is often used to make the infohash unique to a tracker.
+	Source string
+	// BEP 38 infohashes of torrents that likely share files with this one.
+	Similar []Hash
+	// BEP 38 collection names that torrents likely sharing files with this one also have.
+	Collections []string
+
+	// Options for hashing v1 pieces.
+	GeneratePiecesOpts
+	// Resumes hashing v1 pieces from a GeneratePiecesProgress.Checkpoint.
+	Checkpoint []byte
+}
+
+// Sets the Info from a root path and its children. v1 pieces are hashed concurrently, see
+// Info.GeneratePiecesContext. The returned piece layers are for MetaInfo.PieceLayers, and are nil
+// for v1 infos.
+func (info *Info) BuildFromFilePathOpts(ctx context.Context, root string, opts BuildFromFilePathOpts) (
+	pieceLayers map[string]string, err error,
+) {
+	err = info.setFilesFromFilePath(root, &opts)
+	if err != nil {
+		return
+	}
+	if opts.Private {
+		info.Private = new(bool)
+		*info.Private = true
+	}
+	if opts.Source != "" {
+		info.Source = opts.Source
+	}
+	if opts.Similar != nil {
+		info.Similar = opts.Similar
+	}
+	if opts.Collections != nil {
+		info.Collections = opts.Collections
+	}
+	v2 := opts.V2 || opts.Hybrid
+	if v2 {
+		// The v1 files must be in the same order as the v2 file tree.
+		slices.SortFunc(info.Files, func(l, r FileInfo) int {
+			return slices.Compare(l.Path, r.Path)
+		})
+	} else if opts.FileOrder != nil {
+		slices.SortStableFunc(info.Files, opts.FileOrder)
+	} else {
+		sort.Slice(info.Files, func(i, j int) bool {
+			l, r := info.Files[i], info.Files[j]
+			return strings.Join(l.BestPath(), "/") < strings.Join(r.BestPath(), "/")
+		})
+	}
+	if info.PieceLength == 0 {
+		info.PieceLength = ChoosePieceLength(info.TotalLength())
+	}
+	filePath := func(fi FileInfo) string {
+		return filepath.Join(root, strings.Join(fi.BestPath(), string(filepath.Separator)))
+	}
+	if v2 {
+		if info.PieceLength < merkle.BlockSize || info.PieceLength&(info.PieceLength-1) != 0 {
+			err = fmt.Errorf("v2 piece length %v is not a power of two of at least %v", info.PieceLength, merkle.BlockSize)
+			return
+		}
+		pieceLayers, err = info.GenerateV2(func(fi FileInfo) (io.ReadCloser, error) {
+			return os.Open(filePath(fi))
+		})
+		if err != nil {
+			err = fmt.Errorf("generating v2 hashes: %w", err)
+			return
+		}
+		if !opts.Hybrid {
+			info.Files = nil
+			info.Length = 0
+			info.Pieces = nil
+			return
+		}
+	}
+	if opts.Hybrid || opts.PadFiles {
+		info.Files = padFilesToPieces(info.Files, info.PieceLength)
+	}
+	info.Pieces = opts.Checkpoint
+	err = info.GeneratePiecesContext(ctx, func(fi FileInfo) (ReaderAtCloser, error) {
+		return os.Open(filePath(fi))
+	}, opts.GeneratePiecesOpts)
+	if err != nil {
+		err = fmt.Errorf("error generating pieces: %w", err)
+	}
+	return
+}
+
+// Sets MetaVersion and FileTree from the v1 file fields, by hashing the file data obtained with
+// open. Returns the piece layers for files longer than a piece. The PieceLength must already be
+// valid for v2. Padding files and symlinks are skipped, as file trees can't describe them.
+func (info *Info) GenerateV2(open func(fi FileInfo) (io.ReadCloser, error)) (
+	pieceLayers map[string]string, err error,
+) {
+	info.MetaVersion = 2
+	info.FileTree = FileTree{}
+	for fi := range info.UpvertedV1Files() {
+		if fi.IsPadding() || fi.IsSymlink() {
+			continue
+		}
+		path := fi.BestPath()
+		if len(path) == 0 {
+			// Single file infos use the name for the file tree.
+			path = []string{info.BestName()}
+		}
+		var ftf FileTreeFile
+		ftf.Length = fi.Length
+		if fi.Length != 0 {
+			var layer []byte
+			ftf.PiecesRoot, layer, err = hashFileV2(fi, info.PieceLength, open)
+			if err != nil {
+				return
+			}
+			if layer != nil {
+				if pieceLayers == nil {
+					pieceLayers = make(map[string]string)
+				}
+				pieceLayers[ftf.PiecesRoot] = string(layer)
+			}
+		}
+		info.FileTree.insert(path, ftf)
+	}
+	return
+}
+
+// Returns the file's pieces root, and the piece layer if it's longer than a piece.
+func hashFileV2(fi FileInfo, pieceLength int64, open func(fi FileInfo) (io.ReadCloser, error)) (
+	root string, layer []byte, err error,
+) {
+	r, err := open(fi)
+	if err != nil {
+		err = fmt.Errorf("error opening %v: %s", fi, err)
+		return
+	}
+	defer r.Close()
+	h := merkle.NewHash()
+	if fi.Length <= pieceLength {
+		_, err = io.CopyN(h, r, fi.Length)
+		if err != nil {
+			err = fmt.Errorf("hashing %v: %w", fi, err)
+			return
+		}
+		root = string(h.Sum(nil))
+		return
+	}
+	var layerHashes [][sha256.Size]byte
+	for remaining := fi.Length; remaining > 0; remaining -= pieceLength {
+		h.Reset()
+		_, err = io.CopyN(h, r, min(remaining, pieceLength))
+		if err != nil {
+			err = fmt.Errorf("hashing %v: %w", fi, err)
+			return
+		}
+		// The last piece is padded out with zero hashes to the piece length, like every other.
+		layer = h.SumMinLength(layer, int(pieceLength))
+		layerHashes = append(layerHashes, [sha256.Size]byte(layer[len(layer)-sha256.Size:]))
+	}
+	rootHash := merkle.RootWithPadHash(layerHashes, HashForPiecePad(pieceLength))
+	root = string(rootHash[:])
+	return
+}
+
+func (ft *FileTree) insert(path []string, file FileTreeFile) {
+	if len(path) == 0 {
+		ft.File = file
+		return
+	}
+	if ft.Dir == nil {
+		ft.Dir = make(map[string]FileTree)
+	}
+	sub := ft.Dir[path[0]]
+	sub.insert(path[1:], file)
+	ft.Dir[path[0]] = sub
+}
+
+// Inserts BEP 47 padding files so every file after the first starts on a piece boundary. Empty
+// files don't need aligning.
+func padFilesToPieces(files []FileInfo, pieceLength int64) (ret []FileInfo) {
+	var offset int64
+	for _, fi := range files {
+		if fi.Length != 0 && offset%pieceLength != 0 {
+			padLength := pieceLength - offset%pieceLength
+			ret = append(ret, FileInfo{
+				Length: padLength,
+				Path:   []string{".pad", strconv.FormatInt(padLength, 10)},
+				ExtendedFileAttrs: ExtendedFileAttrs{
+					Attr: "p",
+				},
+			})
+			offset += padLength
+		}
+		ret = append(ret, fi)
+		offset += fi.Length
+	}
+	return
+}
@@ -0,0 +1,206 @@
+package metainfo
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha1"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Files of various sizes relative to a 16 KiB piece: multiple pieces, a partial piece, and empty.
+func writeBuildTestFiles(t *testing.T) (root string) {
+	root = filepath.Join(t.TempDir(), "root")
+	r := rand.New(rand.NewSource(1))
+	for name, size := range map[string]int{
+		"a":     40000,
+		"b/c":   3*16384 + 5,
+		"b/d":   0,
+		"b/e/f": 100,
+		"g":     16384,
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		qt.Assert(t, qt.IsNil(os.MkdirAll(filepath.Dir(path), 0o755)))
+		b := make([]byte, size)
+		r.Read(b)
+		qt.Assert(t, qt.IsNil(os.WriteFile(path, b, 0o644)))
+	}
+	return
+}
+
+// Marshals and unmarshals the metainfo as a client would see it, and checks the piece layers.
+func roundTripV2(t *testing.T, info Info, pieceLayers map[string]string) Info {
+	var mi MetaInfo
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	qt.Assert(t, qt.IsNil(err))
+	mi.PieceLayers = pieceLayers
+	b, err := bencode.Marshal(mi)
+	qt.Assert(t, qt.IsNil(err))
+	mi = MetaInfo{}
+	qt.Assert(t, qt.IsNil(bencode.Unmarshal(b, &mi)))
+	info, err = mi.UnmarshalInfo()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsTrue(info.HasV2()))
+	qt.Assert(t, qt.IsNil(ValidatePieceLayers(mi.PieceLayers, &info.FileTree, info.PieceLength)))
+	return info
+}
+
+func TestBuildV2FromFilePath(t *testing.T) {
+	root := writeBuildTestFiles(t)
+	info := Info{PieceLength: 16384}
+	pieceLayers, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{V2: true})
+	qt.Assert(t, qt.IsNil(err))
+	// Only files longer than a piece have layers.
+	qt.Check(t, qt.HasLen(pieceLayers, 2))
+	info = roundTripV2(t, info, pieceLayers)
+	qt.Check(t, qt.HasLen(info.Pieces, 0))
+	qt.Check(t, qt.HasLen(info.Files, 0))
+	var paths []string
+	for fi := range info.UpvertedFilesIter() {
+		paths = append(paths, filepath.ToSlash(filepath.Join(fi.Path...)))
+	}
+	qt.Check(t, qt.DeepEquals(paths, []string{"a", "b/c", "b/d", "b/e/f", "g"}))
+	qt.Check(t, qt.Equals(info.NumPieces(), 3+4+0+1+1))
+}
+
+func TestBuildHybridFromFilePath(t *testing.T) {
+	root := writeBuildTestFiles(t)
+	info := Info{PieceLength: 16384}
+	pieceLayers, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Hybrid: true})
+	qt.Assert(t, qt.IsNil(err))
+	info = roundTripV2(t, info, pieceLayers)
+	// The v1 and v2 views agree on where files and pieces are.
+	qt.Check(t, qt.Equals(len(info.Pieces)/HashSize, info.NumPieces()))
+	var v1Files []FileInfo
+	for fi := range info.UpvertedV1Files() {
+		if !fi.IsPadding() {
+			v1Files = append(v1Files, fi)
+		}
+	}
+	v2Files := info.UpvertedFiles()
+	qt.Assert(t, qt.HasLen(v1Files, len(v2Files)))
+	for i, fi := range v2Files {
+		qt.Check(t, qt.DeepEquals(v1Files[i].Path, fi.Path))
+		// Empty files aren't padded, and have no data to locate.
+		if fi.Length != 0 {
+			qt.Check(t, qt.Equals(v1Files[i].TorrentOffset, fi.TorrentOffset))
+		}
+	}
+	// The last piece of a file is padded with zeroes in v1.
+	data, err := os.ReadFile(filepath.Join(root, "a"))
+	qt.Assert(t, qt.IsNil(err))
+	lastPiece := append(data[2*16384:], bytes.Repeat([]byte{0}, 3*16384-len(data))...)
+	h := sha1.Sum(lastPiece)
+	qt.Check(t, qt.IsTrue(slices.Equal(info.Piece(2).V1Hash().Unwrap().Bytes(), h[:])))
+}
+
+func TestBuildV2FromSingleFile(t *testing.T) {
+	root := writeBuildTestFiles(t)
+	info := Info{PieceLength: 16384}
+	pieceLayers, err := info.BuildFromFilePathOpts(context.Background(), filepath.Join(root, "a"), BuildFromFilePathOpts{Hybrid: true})
+	qt.Assert(t, qt.IsNil(err))
+	info = roundTripV2(t, info, pieceLayers)
+	qt.Check(t, qt.Equals(info.Length, 40000))
+	qt.Check(t, qt.Equals(info.FileTree.Dir["a"].File.Length, 40000))
+	qt.Check(t, qt.Equals(len(info.Pieces)/HashSize, 3))
+}
+
+func TestBuildV2BadPieceLength(t *testing.T) {
+	root := writeBuildTestFiles(t)
+	info := Info{PieceLength: 20000}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{V2: true})
+	qt.Check(t, qt.ErrorMatches(err, "v2 piece length 20000 is not a power of two.*"))
+}
+
+func TestBuildFromFilePathOptsFiltering(t *testing.T) {
+	root := writeBuildTestFiles(t)
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(root, ".hidden"), []byte("h"), 0o644)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(root, "b", "run"), []byte("#!"), 0o755)))
+	qt.Assert(t, qt.IsNil(os.Symlink("c", filepath.Join(root, "b", "link"))))
+	qt.Assert(t, qt.IsNil(os.Symlink("../../g", filepath.Join(root, "b", "e", "up"))))
+	outside := filepath.Join(t.TempDir(), "outside")
+	qt.Assert(t, qt.IsNil(os.WriteFile(outside, []byte("out"), 0o644)))
+	qt.Assert(t, qt.IsNil(os.Symlink(outside, filepath.Join(root, "out"))))
+	paths := func(info Info) (ret []string) {
+		for _, fi := range info.Files {
+			ret = append(ret, strings.Join(fi.Path, "/")+":"+fi.Attr)
+		}
+		return
+	}
+	build := func(opts BuildFromFilePathOpts) Info {
+		info := Info{PieceLength: 16384}
+		_, err := info.BuildFromFilePathOpts(context.Background(), root, opts)
+		qt.Assert(t, qt.IsNil(err))
+		return info
+	}
+	qt.Check(t, qt.DeepEquals(paths(build(BuildFromFilePathOpts{
+		FileAttrs: true,
+	})), []string{
+		".hidden:h", "a:", "b/c:", "b/d:", "b/e/f:", "b/e/up:", "b/link:", "b/run:x", "g:", "out:",
+	}))
+	qt.Check(t, qt.DeepEquals(paths(build(BuildFromFilePathOpts{
+		SkipHidden: true,
+		Symlinks:   SymlinksSkip,
+		Exclude:    []string{"e", "run"},
+	})), []string{"a:", "b/c:", "b/d:", "g:"}))
+	info := build(BuildFromFilePathOpts{
+		Symlinks: SymlinksAttr,
+		Include:  []string{"b/*", "out"},
+	})
+	qt.Check(t, qt.DeepEquals(paths(info), []string{"b/c:", "b/d:", "b/link:l", "b/run:", "out:"}))
+	qt.Check(t, qt.DeepEquals(info.Files[2].SymlinkPath, []string{"b", "c"}))
+	qt.Check(t, qt.Equals(info.Files[4].Length, 3))
+	qt.Check(t, qt.DeepEquals(paths(build(BuildFromFilePathOpts{
+		Symlinks: SymlinksSkip,
+		Include:  []string{"b/e/*"},
+	})), []string{"b/e/f:"}))
+	_, err := (&Info{}).BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+		Include: []string{"["},
+	})
+	qt.Check(t, qt.ErrorMatches(err, `bad pattern "\[".*`))
+}
+
+func TestBuildFromFilePathOptsOrderAndPadding(t *testing.T) {
+	root := writeBuildTestFiles(t)
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+		SkipHidden: true,
+		PadFiles:   true,
+		FileOrder: func(l, r FileInfo) int {
+			return cmp.Compare(r.Length, l.Length)
+		},
+		Private:     true,
+		Source:      "src",
+		Similar:     []Hash{{1}},
+		Collections: []string{"coll"},
+	})
+	qt.Assert(t, qt.IsNil(err))
+	var paths []string
+	for fi := range info.UpvertedV1Files() {
+		if fi.IsPadding() {
+			qt.Check(t, qt.Not(qt.Equals(fi.TorrentOffset%info.PieceLength, 0)))
+			continue
+		}
+		paths = append(paths, strings.Join(fi.Path, "/"))
+		qt.Check(t, qt.Equals(fi.Length == 0 || fi.TorrentOffset%info.PieceLength == 0, true))
+	}
+	qt.Check(t, qt.DeepEquals(paths, []string{"b/c", "a", "g", "b/e/f", "b/d"}))
+	b, err := bencode.Marshal(info)
+	qt.Assert(t, qt.IsNil(err))
+	var out Info
+	qt.Assert(t, qt.IsNil(bencode.Unmarshal(b, &out)))
+	qt.Check(t, qt.IsTrue(*out.Private))
+	qt.Check(t, qt.Equals(out.Source, "src"))
+	qt.Check(t, qt.DeepEquals(out.Similar, []Hash{{1}}))
+	qt.Check(t, qt.DeepEquals(out.Collections, []string{"coll"}))
+}
@@ -14,7 +14,7 @@ const FileTreePropertiesKey = ""
 
 type FileTreeFile struct {
 	Length     int64  `bencode:"length"`
-	PiecesRoot string `bencode:"pieces root"`
+	PiecesRoot string `bencode:"pieces root,omitempty"`
 }
 
 // The fields here don't need bencode tags as the marshalling is done manually.
@@ -50,7 +50,8 @@ func (ft *FileTree) UnmarshalBencode(bytes []byte) (err error) {
 
 var _ bencode.Unmarshaler = (*FileTree)(nil)
 
-func (ft *FileTree) MarshalBencode() (bytes []byte, err error) {
+// This has a value receiver so that FileTree is marshalled correctly when Info is passed by value.
+func (ft FileTree) MarshalBencode() (bytes []byte, err error) {
 	if ft.IsDir() {
 		dir := make(map[string]bencode.Bytes, len(ft.Dir))
 		for _, key := range ft.orderedKeys() {
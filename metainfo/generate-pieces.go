@@ -0,0 +1,176 @@
+package metainfo
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// A file opened for Info.GeneratePiecesContext. Reads can be concurrent.
+type ReaderAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+type GeneratePiecesOpts struct {
+	// The number of pieces hashed concurrently. Defaults to GOMAXPROCS.
+	Workers int
+	// Called each time a piece is hashed. Calls are not concurrent, and hashing waits on them.
+	Progress func(GeneratePiecesProgress)
+}
+
+type GeneratePiecesProgress struct {
+	PiecesDone int
+	NumPieces  int
+	BytesDone  int64
+	TotalBytes int64
+	// The hashes of the leading pieces that are done. Hashing can be resumed by setting Info.Pieces
+	// to this, given the same files and piece length. Don't retain it past the callback.
+	Checkpoint []byte
+}
+
+// Sets Pieces by hashing pieces concurrently, with data read from the files obtained with open.
+// Files are opened for each piece that needs them. Padding files are not opened. If Pieces is
+// already set, it's treated as a checkpoint, and only the pieces after it are hashed. If the
+// Context is cancelled, or there's an error, Pieces is left set to the leading pieces that were
+// completed, so the call can be repeated to resume.
+func (info *Info) GeneratePiecesContext(
+	ctx context.Context,
+	open func(fi FileInfo) (ReaderAtCloser, error),
+	opts GeneratePiecesOpts,
+) (err error) {
+	if info.PieceLength == 0 {
+		return errors.New("piece length must be non-zero")
+	}
+	var files []FileInfo
+	var totalBytes int64
+	for fi := range info.UpvertedV1Files() {
+		files = append(files, fi)
+		totalBytes += fi.Length
+	}
+	numPieces := int((totalBytes + info.PieceLength - 1) / info.PieceLength)
+	if len(info.Pieces)%HashSize != 0 || len(info.Pieces)/HashSize > numPieces {
+		return fmt.Errorf("bad checkpoint: %v bytes of hashes for %v pieces", len(info.Pieces), numPieces)
+	}
+	pieces := make([]byte, numPieces*HashSize)
+	copy(pieces, info.Pieces)
+	prefix := len(info.Pieces) / HashSize
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	pieceLength := func(i int) int64 {
+		return min(info.PieceLength, totalBytes-int64(i)*info.PieceLength)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var (
+		mu         sync.Mutex
+		done       = make([]bool, numPieces)
+		piecesDone = prefix
+		bytesDone  = min(int64(prefix)*info.PieceLength, totalBytes)
+		wg         sync.WaitGroup
+	)
+	indexes := make(chan int)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := sha1.New()
+			buf := make([]byte, info.PieceLength)
+			for i := range indexes {
+				h.Reset()
+				b := buf[:pieceLength(i)]
+				err := readPiece(files, int64(i)*info.PieceLength, b, open)
+				if err != nil {
+					cancel(fmt.Errorf("reading piece %v: %w", i, err))
+					return
+				}
+				h.Write(b)
+				mu.Lock()
+				h.Sum(pieces[i*HashSize : i*HashSize])
+				done[i] = true
+				for prefix < numPieces && done[prefix] {
+					prefix++
+				}
+				piecesDone++
+				bytesDone += int64(len(b))
+				if opts.Progress != nil {
+					opts.Progress(GeneratePiecesProgress{
+						PiecesDone: piecesDone,
+						NumPieces:  numPieces,
+						BytesDone:  bytesDone,
+						TotalBytes: totalBytes,
+						Checkpoint: pieces[:prefix*HashSize],
+					})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := prefix; i < numPieces; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	info.Pieces = pieces[:prefix*HashSize]
+	if prefix == numPieces {
+		return nil
+	}
+	return context.Cause(ctx)
+}
+
+// Fills b with the torrent data at offset, which may span several files.
+func readPiece(
+	files []FileInfo,
+	offset int64,
+	b []byte,
+	open func(fi FileInfo) (ReaderAtCloser, error),
+) error {
+	start := sort.Search(len(files), func(i int) bool {
+		return files[i].TorrentOffset+files[i].Length > offset
+	})
+	for _, fi := range files[start:] {
+		if len(b) == 0 {
+			break
+		}
+		if fi.Length == 0 {
+			continue
+		}
+		n := min(int64(len(b)), fi.TorrentOffset+fi.Length-offset)
+		err := readFileAt(fi, b[:n], offset-fi.TorrentOffset, open)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		offset += n
+	}
+	return nil
+}
+
+func readFileAt(fi FileInfo, b []byte, off int64, open func(fi FileInfo) (ReaderAtCloser, error)) error {
+	if fi.IsPadding() {
+		clear(b)
+		return nil
+	}
+	f, err := open(fi)
+	if err != nil {
+		return fmt.Errorf("error opening %v: %w", fi, err)
+	}
+	defer f.Close()
+	n, err := f.ReadAt(b, off)
+	if n != len(b) {
+		return fmt.Errorf("reading %v: %w", fi, err)
+	}
+	return nil
+}
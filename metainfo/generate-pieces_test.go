@@ -0,0 +1,113 @@
+package metainfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+type bytesReaderAtCloser struct {
+	*bytes.Reader
+}
+
+func (bytesReaderAtCloser) Close() error { return nil }
+
+// Random files of awkward sizes, and a function to open them.
+func generatePiecesTestInfo() (info Info, open func(fi FileInfo) (ReaderAtCloser, error)) {
+	r := rand.New(rand.NewSource(1))
+	data := make(map[string][]byte)
+	info.PieceLength = 1000
+	for i, size := range []int{2500, 0, 1, 999, 1000, 4321, 7} {
+		name := string(rune('a' + i))
+		b := make([]byte, size)
+		r.Read(b)
+		data[name] = b
+		info.Files = append(info.Files, FileInfo{Path: []string{name}, Length: int64(size)})
+	}
+	open = func(fi FileInfo) (ReaderAtCloser, error) {
+		return bytesReaderAtCloser{bytes.NewReader(data[fi.Path[0]])}, nil
+	}
+	return
+}
+
+func TestGeneratePiecesContextMatchesSequential(t *testing.T) {
+	info, open := generatePiecesTestInfo()
+	expected := info
+	qt.Assert(t, qt.IsNil(expected.GeneratePieces(func(fi FileInfo) (io.ReadCloser, error) {
+		r, err := open(fi)
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(r, 0, fi.Length), r}, err
+	})))
+	for _, workers := range []int{0, 1, 3, 100} {
+		var progress []GeneratePiecesProgress
+		info.Pieces = nil
+		qt.Assert(t, qt.IsNil(info.GeneratePiecesContext(context.Background(), open, GeneratePiecesOpts{
+			Workers: workers,
+			Progress: func(p GeneratePiecesProgress) {
+				progress = append(progress, p)
+			},
+		})))
+		qt.Check(t, qt.DeepEquals(info.Pieces, expected.Pieces))
+		qt.Assert(t, qt.HasLen(progress, 9))
+		last := progress[len(progress)-1]
+		qt.Check(t, qt.Equals(last.PiecesDone, 9))
+		qt.Check(t, qt.Equals(last.BytesDone, 8828))
+		qt.Check(t, qt.Equals(last.TotalBytes, 8828))
+		qt.Check(t, qt.HasLen(last.Checkpoint, 9*HashSize))
+	}
+}
+
+func TestGeneratePiecesContextResume(t *testing.T) {
+	info, open := generatePiecesTestInfo()
+	qt.Assert(t, qt.IsNil(info.GeneratePiecesContext(context.Background(), open, GeneratePiecesOpts{})))
+	expected := info.Pieces
+	// Fail partway through, and resume from where it stopped.
+	errBroken := errors.New("broken")
+	info.Pieces = nil
+	err := info.GeneratePiecesContext(context.Background(), func(fi FileInfo) (ReaderAtCloser, error) {
+		if fi.Path[0] == "f" {
+			return nil, errBroken
+		}
+		return open(fi)
+	}, GeneratePiecesOpts{Workers: 1})
+	qt.Assert(t, qt.ErrorIs(err, errBroken))
+	// File f starts in the fifth piece.
+	qt.Check(t, qt.DeepEquals(info.Pieces, expected[:4*HashSize]))
+	var opened []string
+	qt.Assert(t, qt.IsNil(info.GeneratePiecesContext(context.Background(), func(fi FileInfo) (ReaderAtCloser, error) {
+		opened = append(opened, fi.Path[0])
+		return open(fi)
+	}, GeneratePiecesOpts{Workers: 1})))
+	qt.Check(t, qt.DeepEquals(info.Pieces, expected))
+	qt.Check(t, qt.DeepEquals(opened, []string{"e", "f", "f", "f", "f", "f", "g"}))
+}
+
+func TestGeneratePiecesContextCancel(t *testing.T) {
+	info, open := generatePiecesTestInfo()
+	ctx, cancel := context.WithCancel(context.Background())
+	err := info.GeneratePiecesContext(ctx, open, GeneratePiecesOpts{
+		Workers: 1,
+		Progress: func(p GeneratePiecesProgress) {
+			if p.PiecesDone == 2 {
+				cancel()
+			}
+		},
+	})
+	qt.Check(t, qt.ErrorIs(err, context.Canceled))
+	qt.Check(t, qt.IsTrue(len(info.Pieces) >= 2*HashSize))
+	qt.Check(t, qt.IsTrue(len(info.Pieces) < 9*HashSize))
+}
+
+func TestGeneratePiecesContextBadCheckpoint(t *testing.T) {
+	info, open := generatePiecesTestInfo()
+	info.Pieces = make([]byte, 10*HashSize)
+	err := info.GeneratePiecesContext(context.Background(), open, GeneratePiecesOpts{})
+	qt.Check(t, qt.ErrorMatches(err, "bad checkpoint: .*"))
+}
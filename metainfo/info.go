@@ -1,15 +1,12 @@
 package metainfo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"iter"
-	"os"
-	"path/filepath"
 	"slices"
-	"sort"
-	"strings"
 
 	"github.com/anacrolix/torrent/segments"
 )
@@ -28,6 +25,10 @@ type Info struct {
 	Source string     `bencode:"source,omitempty"`
 	Files  []FileInfo `bencode:"files,omitempty"` // BEP3, mutually exclusive with Length
 
+	// BEP 38
+	Similar     []Hash   `bencode:"similar,omitempty"`
+	Collections []string `bencode:"collections,omitempty"`
+
 	// BEP 52 (BitTorrent v2)
 	MetaVersion int64    `bencode:"meta version,omitempty"`
 	FileTree    FileTree `bencode:"file tree,omitempty"`
@@ -45,61 +46,21 @@ const NoName = "-"
 
 // This is a helper that sets Files and Pieces from a root path and its children.
 func (info *Info) BuildFromFilePath(root string) (err error) {
-	info.Name = func() string {
-		b := filepath.Base(root)
-		switch b {
-		case ".", "..", string(filepath.Separator):
-			return NoName
-		default:
-			return b
-		}
-	}()
-	info.Files = nil
-	err = filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if fi.IsDir() {
-			// Directories are implicit in torrent files.
-			return nil
-		} else if path == root {
-			// The root is a file.
-			info.Length = fi.Size()
-			return nil
-		}
-		relPath, err := filepath.Rel(root, path)
-		if err != nil {
-			return fmt.Errorf("error getting relative path: %s", err)
-		}
-		info.Files = append(info.Files, FileInfo{
-			Path:   strings.Split(relPath, string(filepath.Separator)),
-			Length: fi.Size(),
-		})
-		return nil
-	})
-	if err != nil {
-		return
-	}
-	sort.Slice(info.Files, func(i, j int) bool {
-		l, r := info.Files[i], info.Files[j]
-		return strings.Join(l.BestPath(), "/") < strings.Join(r.BestPath(), "/")
-	})
-	if info.PieceLength == 0 {
-		info.PieceLength = ChoosePieceLength(info.TotalLength())
-	}
-	err = info.GeneratePieces(func(fi FileInfo) (io.ReadCloser, error) {
-		return os.Open(filepath.Join(root, strings.Join(fi.BestPath(), string(filepath.Separator))))
-	})
-	if err != nil {
-		err = fmt.Errorf("error generating pieces: %s", err)
-	}
+	_, err = info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{})
 	return
 }
 
 // Concatenates all the files in the torrent into w. open is a function that
-// gets at the contents of the given file.
+// gets at the contents of the given file. Padding files are written as zeroes, and aren't opened.
 func (info *Info) writeFiles(w io.Writer, open func(fi FileInfo) (io.ReadCloser, error)) error {
-	for _, fi := range info.UpvertedFiles() {
+	for fi := range info.UpvertedV1Files() {
+		if fi.IsPadding() {
+			_, err := io.CopyN(w, zeroReader{}, fi.Length)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		r, err := open(fi)
 		if err != nil {
 			return fmt.Errorf("error opening %v: %s", fi, err)
@@ -113,6 +74,14 @@ func (info *Info) writeFiles(w io.Writer, open func(fi FileInfo) (io.ReadCloser,
 	return nil
 }
 
+// Reads zeroes, for padding files.
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
 // Sets Pieces (the block of piece hashes in the Info) by using the passed
 // function to get at the torrent data.
 func (info *Info) GeneratePieces(open func(fi FileInfo) (io.ReadCloser, error)) (err error) {
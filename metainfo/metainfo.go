@@ -26,9 +26,13 @@ type MetaInfo struct {
 	CreatedBy    string  `bencode:"created by,omitempty"`
 	Encoding     string  `bencode:"encoding,omitempty"`
 	UrlList      UrlList `bencode:"url-list,omitempty"` // BEP 19 WebSeeds
+	// BEP 17 HTTP seeds. These are asked for pieces, rather than files like WebSeeds.
+	HttpSeeds UrlList `bencode:"httpseeds,omitempty"`
 	// BEP 52 (BitTorrent v2): Keys are file merkle roots ("pieces root"s), and the values are the
 	// concatenated hashes of the merkle tree layer that corresponds to the piece length.
 	PieceLayers map[string]string `bencode:"piece layers,omitempty"`
+	// Keys not handled above, such as extensions, kept so they're written back out.
+	Unknown map[string]bencode.Bytes `bencode:",unknown"`
 }
 
 // Load a MetaInfo from an io.Reader. Returns a non-nil error in case of failure.
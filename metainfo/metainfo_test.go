@@ -176,3 +176,14 @@ func TestUnmarshalV2Metainfo(t *testing.T) {
 	err = ValidatePieceLayers(mi.PieceLayers, &info.FileTree, info.PieceLength)
 	c.Check(err, qt.IsNil)
 }
+
+func TestUnknownKeysRoundTrip(t *testing.T) {
+	c := qt.New(t)
+	const input = "d8:announce3:url9:comment.x5:hello4:infod4:name1:aee"
+	var mi MetaInfo
+	c.Assert(bencode.Unmarshal([]byte(input), &mi), qt.IsNil)
+	c.Check(mi.Unknown, qt.DeepEquals, map[string]bencode.Bytes{"comment.x": bencode.Bytes("5:hello")})
+	b, err := bencode.Marshal(mi)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, input)
+}
@@ -0,0 +1,328 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Options for Torrent.MoveStorage. One of DataDir or Storage must be set.
+type MoveStorageOpts struct {
+	// Move data to file storage in this directory, as for AddTorrentOpts.DataDir. If the torrent
+	// is currently in a data directory, files are renamed where possible.
+	DataDir string
+	// Copy data into this storage. Data in the old storage is left in place, unless it was in a
+	// data directory.
+	Storage storage.ClientImpl
+	// Called as data is moved, with the bytes done and the total.
+	Progress func(done, total int64)
+}
+
+// Moves the torrent's data to other storage. Reads and writes of torrent data block until it's
+// done, and pieces aren't hashed. Complete pieces and dirty chunks are moved, and piece completion
+// is set in the new storage. If the torrent doesn't have its info yet, the new storage is used
+// when it does. On error, the torrent keeps using the old storage.
+func (t *Torrent) MoveStorage(ctx context.Context, opts MoveStorageOpts) error {
+	if opts.DataDir == "" && opts.Storage == nil {
+		return errors.New("no data dir or storage")
+	}
+	t.cl.lock()
+	if t.closed.IsSet() {
+		t.cl.unlock()
+		return errors.New("torrent closed")
+	}
+	if t.storageMoving {
+		t.cl.unlock()
+		return errors.New("storage is already being moved")
+	}
+	var newClient storage.ClientImpl
+	if opts.Storage != nil {
+		newClient = opts.Storage
+		opts.DataDir = ""
+	} else if opts.DataDir == t.dataDir {
+		t.cl.unlock()
+		return nil
+	} else {
+		newClient = t.cl.dataDirStorage(opts.DataDir)
+	}
+	if t.storage == nil {
+		t.storageOpener = storage.NewClient(newClient)
+		t.dataDir = opts.DataDir
+		t.cl.unlock()
+		return nil
+	}
+	t.storageMoving = true
+	for t.activePieceHashes != 0 {
+		t.cl.event.Wait()
+	}
+	t.cl.unlock()
+	defer func() {
+		t.cl.lock()
+		defer t.cl.unlock()
+		t.storageMoving = false
+		t.tryCreateMorePieceHashers()
+	}()
+
+	t.storageIoLock.Lock()
+	defer t.storageIoLock.Unlock()
+	oldDataDir := t.dataDir
+	newStorage, err := newClient.OpenTorrent(
+		log.ContextWithLogger(ctx, t.logger), t.info, *t.canonicalShortInfohash())
+	if err != nil {
+		return fmt.Errorf("opening new storage: %w", err)
+	}
+	move := t.storageMoveState()
+	renamed := false
+	if oldDataDir != "" && opts.DataDir != "" {
+		err = t.moveDataDirFiles(oldDataDir, opts.DataDir, opts.Progress)
+		if err == nil {
+			renamed = true
+		} else {
+			t.logger.Levelf(log.Info, "renaming files failed, copying instead: %v", err)
+		}
+	}
+	if !renamed {
+		err = t.copyStorage(ctx, newStorage, move, opts.Progress)
+		if err != nil {
+			closeTorrentStorage(newStorage)
+			return err
+		}
+	}
+
+	t.cl.lock()
+	if t.closed.IsSet() {
+		t.cl.unlock()
+		closeTorrentStorage(newStorage)
+		return errors.New("torrent closed")
+	}
+	oldStorage := t.storage.TorrentImpl
+	for i := range t.pieces {
+		p := t.piece(i)
+		if oldDataDir != "" && move.complete[i] {
+			// The data is gone from the old data dir.
+			p.Storage().MarkNotComplete()
+		}
+		if move.complete[i] {
+			err = p.storageFor(newStorage).MarkComplete()
+		} else {
+			err = p.storageFor(newStorage).MarkNotComplete()
+		}
+		if err != nil {
+			t.logger.Levelf(log.Warning, "setting piece %v completion in new storage: %v", i, err)
+		}
+	}
+	t.deletePieceRequestOrder()
+	t.storage = &storage.Torrent{TorrentImpl: newStorage}
+	t.storageOpener = storage.NewClient(newClient)
+	t.dataDir = opts.DataDir
+	t.initPieceRequestOrder()
+	for i := range t.pieces {
+		t.addRequestOrderPiece(i)
+		t.updatePieceCompletion(i)
+	}
+	t.cl.unlock()
+	err = closeTorrentStorage(oldStorage)
+	if err != nil {
+		t.logger.Levelf(log.Warning, "closing old storage: %v", err)
+	}
+	if oldDataDir != "" && !renamed {
+		t.removeDataDirFiles(oldDataDir)
+	}
+	return nil
+}
+
+// What needs to be copied from storage.
+type storageMoveState struct {
+	complete    []bool
+	dirtyChunks [][]ChunkSpec
+	total       int64
+}
+
+func (t *Torrent) storageMoveState() (ret storageMoveState) {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	ret.complete = make([]bool, t.numPieces())
+	ret.dirtyChunks = make([][]ChunkSpec, t.numPieces())
+	for i := range t.pieces {
+		p := t.piece(i)
+		if t.pieceComplete(i) {
+			ret.complete[i] = true
+			ret.total += p.Info().Length()
+			continue
+		}
+		for ci := chunkIndexType(0); ci < p.numChunks(); ci++ {
+			if p.chunkIndexDirty(ci) {
+				cs := p.chunkIndexSpec(ci)
+				ret.dirtyChunks[i] = append(ret.dirtyChunks[i], cs)
+				ret.total += int64(cs.Length)
+			}
+		}
+	}
+	return
+}
+
+// Copies complete pieces and dirty chunks from the current storage. The caller must hold
+// storageIoLock.
+func (t *Torrent) copyStorage(
+	ctx context.Context,
+	to storage.TorrentImpl,
+	move storageMoveState,
+	progress func(done, total int64),
+) error {
+	var done int64
+	var buf []byte
+	copyExtent := func(p *Piece, off, n int64) error {
+		buf = slices.Grow(buf[:0], int(n))[:n]
+		n1, err := p.Storage().ReadAt(buf, off)
+		if n1 == len(buf) {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading piece %v: %w", p.index, err)
+		}
+		_, err = p.storageFor(to).WriteAt(buf, off)
+		if err != nil {
+			return fmt.Errorf("writing piece %v: %w", p.index, err)
+		}
+		done += n
+		if progress != nil {
+			progress(done, move.total)
+		}
+		return nil
+	}
+	for i := range t.pieces {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p := t.piece(i)
+		if move.complete[i] {
+			err := copyExtent(p, 0, p.Info().Length())
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for _, cs := range move.dirtyChunks[i] {
+			err := copyExtent(p, int64(cs.Begin), int64(cs.Length))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if to.Flush != nil {
+		return to.Flush()
+	}
+	return nil
+}
+
+func closeTorrentStorage(ts storage.TorrentImpl) error {
+	if ts.Close == nil {
+		return nil
+	}
+	return ts.Close()
+}
+
+// The path of a file in file storage for dir, as laid out by storage.NewFile.
+func (t *Torrent) dataDirFilePath(dir string, f *File) string {
+	var parts []string
+	if t.info.BestName() != metainfo.NoName {
+		parts = append(parts, t.info.BestName())
+	}
+	return filepath.Join(dir, filepath.Join(append(parts, f.fi.BestPath()...)...))
+}
+
+// Renames the torrent's files from one data dir to another. If any rename fails, the files that
+// were renamed are moved back. This is expected when the dirs are on different filesystems.
+func (t *Torrent) moveDataDirFiles(from, to string, progress func(done, total int64)) (err error) {
+	files := t.Files()
+	var total, done int64
+	for _, f := range files {
+		total += f.Length()
+	}
+	var renamed []*File
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, f := range renamed {
+			os.Rename(t.dataDirFilePath(to, f), t.dataDirFilePath(from, f))
+		}
+	}()
+	for _, f := range files {
+		oldPath := t.dataDirFilePath(from, f)
+		newPath := t.dataDirFilePath(to, f)
+		err = os.MkdirAll(filepath.Dir(newPath), 0o777)
+		if err != nil {
+			return
+		}
+		err = os.Rename(oldPath, newPath)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		} else if err != nil {
+			return
+		} else {
+			renamed = append(renamed, f)
+		}
+		done += f.Length()
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+	t.removeEmptyTorrentDir(from)
+	return nil
+}
+
+// Removes the torrent's files from a data dir after they were copied elsewhere.
+func (t *Torrent) removeDataDirFiles(dir string) {
+	for _, f := range t.Files() {
+		err := os.Remove(t.dataDirFilePath(dir, f))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.logger.Levelf(log.Warning, "removing moved file: %v", err)
+		}
+	}
+	t.removeEmptyTorrentDir(dir)
+}
+
+// Removes the directories left behind by the torrent's files, if they're empty.
+func (t *Torrent) removeEmptyTorrentDir(dir string) {
+	for _, f := range t.Files() {
+		// File paths are within dir, so this stops at dir.
+		for d := filepath.Dir(t.dataDirFilePath(dir, f)); len(d) > len(dir); d = filepath.Dir(d) {
+			if os.Remove(d) != nil {
+				break
+			}
+		}
+	}
+}
+
+// Moves the torrent to the Client's CompleteDataDir once it's complete.
+func (t *Torrent) moveToDataDirWhenComplete(dir string) {
+	select {
+	case <-t.complete.On():
+	case <-t.closed.Done():
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-t.closed.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := t.MoveStorage(ctx, MoveStorageOpts{DataDir: dir})
+	if err != nil {
+		t.logger.Levelf(log.Warning, "moving complete torrent to %q: %v", dir, err)
+		return
+	}
+	t.logger.Levelf(log.Info, "moved complete torrent to %q", dir)
+}
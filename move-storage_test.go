@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestMoveStorage(t *testing.T) {
+	cfg := TestingConfig(t)
+	testutil.CreateDummyTorrentData(cfg.DataDir)
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(tor.VerifyData()))
+	qt.Assert(t, qt.IsTrue(tor.Complete().Bool()))
+
+	readAll := func() string {
+		r := tor.NewReader()
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		qt.Assert(t, qt.IsNil(err))
+		return string(b)
+	}
+
+	newDir := t.TempDir()
+	var lastDone, lastTotal int64
+	err = tor.MoveStorage(context.Background(), MoveStorageOpts{
+		DataDir: newDir,
+		Progress: func(done, total int64) {
+			lastDone, lastTotal = done, total
+		},
+	})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(lastDone, lastTotal))
+	_, err = os.Stat(filepath.Join(cfg.DataDir, testutil.GreetingFileName))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+	b, err := os.ReadFile(filepath.Join(newDir, testutil.GreetingFileName))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), testutil.GreetingFileContents))
+	qt.Check(t, qt.IsTrue(tor.Complete().Bool()))
+	rd, err := tor.ResumeData()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(rd.DataDir, newDir))
+	qt.Check(t, qt.Equals(readAll(), testutil.GreetingFileContents))
+
+	// Copying into other storage keeps the piece completion.
+	err = tor.MoveStorage(context.Background(), MoveStorageOpts{
+		Storage: storage.NewFileWithOpts(storage.NewFileClientOpts{
+			ClientBaseDir:   t.TempDir(),
+			PieceCompletion: storage.NewMapPieceCompletion(),
+		}),
+	})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(tor.Complete().Bool()))
+	qt.Check(t, qt.Equals(readAll(), testutil.GreetingFileContents))
+}
+
+func TestCompleteDataDir(t *testing.T) {
+	cfg := TestingConfig(t)
+	cfg.CompleteDataDir = t.TempDir()
+	testutil.CreateDummyTorrentData(cfg.DataDir)
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(tor.VerifyData()))
+	// The move happens in the background.
+	for {
+		rd, err := tor.ResumeData()
+		qt.Assert(t, qt.IsNil(err))
+		if rd.DataDir == cfg.CompleteDataDir {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = os.Stat(filepath.Join(cfg.CompleteDataDir, testutil.GreetingFileName))
+	qt.Check(t, qt.IsNil(err))
+}
@@ -7,4 +7,8 @@ type PeerStats struct {
 	LastWriteUploadRate float64
 	// How many pieces the peer has.
 	RemotePieceCount int
+	// How many pieces the peer allows us to request while it chokes us (BEP 6).
+	PeerAllowedFastCount int
+	// How many pieces we allow the peer to request while we choke it (BEP 6).
+	AllowedFastCount int
 }
@@ -94,6 +94,10 @@ type (
 		// Pieces we've accepted chunks for from the peer.
 		peerTouchedPieces map[pieceIndex]struct{}
 		peerAllowedFast   typedRoaring.Bitmap[pieceIndex]
+		// Pieces we've told the peer it may request while we choke it.
+		allowedFast typedRoaring.Bitmap[pieceIndex]
+		// Pieces the peer has suggested we request (BEP 6).
+		peerSuggested typedRoaring.Bitmap[pieceIndex]
 
 		PeerMaxRequests maxRequests // Maximum pending requests the peer allows.
 
@@ -123,6 +127,7 @@ const (
 	PeerSourceDhtGetPeers     = "Hg" // Peers we found by searching a DHT.
 	PeerSourceDhtAnnouncePeer = "Ha" // Peers that were announced to us by a DHT.
 	PeerSourcePex             = "X"
+	PeerSourceLsd             = "L" // Peers that announced themselves on the local network.
 	// The peer was given directly, such as through a magnet link.
 	PeerSourceDirect = "M"
 )
@@ -150,6 +155,8 @@ func (p *Peer) Stats() (ret PeerStats) {
 	ret.DownloadRate = p.downloadRate()
 	ret.LastWriteUploadRate = p.peerImpl.lastWriteUploadRate()
 	ret.RemotePieceCount = p.remotePieceCount()
+	ret.PeerAllowedFastCount = int(p.peerAllowedFast.GetCardinality())
+	ret.AllowedFastCount = int(p.allowedFast.GetCardinality())
 	return
 }
 
@@ -30,6 +30,7 @@ import (
 	"github.com/anacrolix/torrent/mse"
 	pp "github.com/anacrolix/torrent/peer_protocol"
 	utHolepunch "github.com/anacrolix/torrent/peer_protocol/ut-holepunch"
+	typedRoaring "github.com/anacrolix/torrent/typed-roaring"
 )
 
 type PeerStatus struct {
@@ -78,6 +79,19 @@ type PeerConn struct {
 	PeerClientName   atomic.Value
 	uploadTimer      *time.Timer
 	pex              pexConnState
+	choker           peerConnChokerState
+	// Pieces we've suggested to the peer.
+	sentSuggests typedRoaring.Bitmap[pieceIndex]
+	// We hid our pieces from the peer when it connected, and reveal them one at a time (BEP 16).
+	superSeeding bool
+	// The piece most recently revealed to the peer while super-seeding.
+	superSeedRevealed Option[pieceIndex]
+
+	// Per-peer limits, applied in addition to the Torrent and Client limiters.
+	uploadRateLimiter   *rate.Limiter
+	downloadRateLimiter *rate.Limiter
+	// The Torrent's download limiter, for the reader, which can't access the Torrent.
+	torrentDownloadRateLimiter atomic.Pointer[rate.Limiter]
 
 	// The pieces the peer has claimed to have.
 	_peerPieces roaring.Bitmap
@@ -128,6 +142,7 @@ func (cn *PeerConn) peerImplStatusLines() []string {
 		fmt.Sprintf("extensions: %v", cn.PeerExtensionBytes),
 		fmt.Sprintf("ltep extensions: %v", cn.PeerExtensionIDs),
 		fmt.Sprintf("pex: %s", cn.pexStatus()),
+		fmt.Sprintf("choker: %s", cn.chokerStatus()),
 	}
 }
 
@@ -171,6 +186,7 @@ func (cn *PeerConn) peerHasAllPieces() (all, known bool) {
 
 func (cn *PeerConn) onGotInfo(info *metainfo.Info) {
 	cn.setNumPieces(info.NumPieces())
+	cn.sendAllowedFastSet()
 }
 
 // Correct the PeerPieces slice length. Return false if the existing slice is invalid, such as by
@@ -283,6 +299,16 @@ func (cn *PeerConn) choke(msg messageWriter) (more bool) {
 	})
 	if !cn.fastEnabled() {
 		cn.deleteAllPeerRequests()
+		return
+	}
+	// BEP 6 requires that we reject outstanding requests, except those that are allowed fast.
+	for r, state := range cn.peerRequests {
+		if cn.requestAllowedFast(r) {
+			continue
+		}
+		more = msg(r.ToMsg(pp.Reject)) && more
+		state.allocReservation.Drop()
+		delete(cn.peerRequests, r)
 	}
 	return
 }
@@ -299,6 +325,8 @@ func (cn *PeerConn) unchoke(msg func(pp.Message) bool) bool {
 		return true
 	}
 	cn.choking = false
+	cn.choker.lastUnchoked = time.Now()
+	cn.choker.bytesWrittenAtUnchoke = cn._stats.BytesWrittenData.Int64()
 	return msg(pp.Message{
 		Type: pp.Unchoke,
 	})
@@ -418,6 +446,7 @@ func (cn *PeerConn) peerSentHave(piece pieceIndex) error {
 		cn.updateRequests("have")
 	}
 	cn.peerPiecesChanged()
+	cn.t.superSeedPieceSpread(cn, piece)
 	return nil
 }
 
@@ -573,11 +602,7 @@ func (c *PeerConn) reject(r Request) {
 }
 
 func (c *PeerConn) maximumPeerRequestChunkLength() (_ Option[int]) {
-	uploadRateLimiter := c.t.cl.config.UploadRateLimiter
-	if uploadRateLimiter.Limit() == rate.Inf {
-		return
-	}
-	return Some(uploadRateLimiter.Burst())
+	return c.uploadRateLimiters().maxBurst()
 }
 
 // startFetch is for testing purposes currently.
@@ -590,7 +615,7 @@ func (c *PeerConn) onReadRequest(r Request, startFetch bool) error {
 		}
 		return nil
 	}
-	if c.choking {
+	if c.choking && !c.requestAllowedFast(r) {
 		torrent.Add("requests received while choking", 1)
 		if c.fastEnabled() {
 			torrent.Add("requests rejected while choking", 1)
@@ -617,6 +642,15 @@ func (c *PeerConn) onReadRequest(r Request, startFetch bool) error {
 			return err
 		}
 	}
+	if c.superSeeding && !c.sentHaves.Get(bitmap.BitIndex(r.Index)) {
+		// We're hiding this piece from the peer, so we behave as if we don't have it.
+		torrent.Add("super-seeding requests for unrevealed pieces", 1)
+		if c.fastEnabled() {
+			c.reject(r)
+			return nil
+		}
+		return fmt.Errorf("peer requested piece we haven't revealed: %v", r.Index.Int())
+	}
 	if !c.t.havePiece(pieceIndex(r.Index)) {
 		// TODO: Tell the peer we don't have the piece, and reject this request.
 		requestsReceivedForMissingPieces.Add(1)
@@ -663,6 +697,7 @@ func (c *PeerConn) peerRequestDataReader(r Request, prs *peerRequestState) {
 		}
 		torrent.Add("peer request data read successes", 1)
 		prs.data = b
+		c.t.onPeerRequestDataRead(pieceIndex(r.Index), c)
 		// This might be required for the error case too (#752 and #753).
 		c.tickleWriter()
 	}
@@ -830,9 +865,11 @@ func (c *PeerConn) mainReadLoop() (err error) {
 			c.updateExpectingChunks()
 		case pp.Interested:
 			c.peerInterested = true
+			cl.maybeGrantUploadSlot(c)
 			c.tickleWriter()
 		case pp.NotInterested:
 			c.peerInterested = false
+			c.releaseUploadSlot()
 			// We don't clear their requests since it isn't clear in the spec.
 			// We'll probably choke them for this, which will clear them if
 			// appropriate, and is clearly specified.
@@ -840,6 +877,7 @@ func (c *PeerConn) mainReadLoop() (err error) {
 			err = c.peerSentHave(pieceIndex(msg.Index))
 		case pp.Bitfield:
 			err = c.peerSentBitfield(msg.Bitfield)
+			c.superSeedCheckRevealed()
 		case pp.Request:
 			r := newRequestFromMessage(&msg)
 			err = c.onReadRequest(r, true)
@@ -876,9 +914,10 @@ func (c *PeerConn) mainReadLoop() (err error) {
 		case pp.Suggest:
 			torrent.Add("suggests received", 1)
 			log.Fmsg("peer suggested piece %d", msg.Index).AddValues(c, msg.Index).LogLevel(log.Debug, c.t.logger)
-			c.updateRequests("suggested")
+			c.peerSentSuggest(pieceIndex(msg.Index))
 		case pp.HaveAll:
 			err = c.onPeerSentHaveAll()
+			c.superSeedCheckRevealed()
 		case pp.HaveNone:
 			err = c.peerSentHaveNone()
 		case pp.Reject:
@@ -890,7 +929,7 @@ func (c *PeerConn) mainReadLoop() (err error) {
 		case pp.AllowedFast:
 			torrent.Add("allowed fasts received", 1)
 			log.Fmsg("peer allowed fast: %d", msg.Index).AddValues(c).LogLevel(log.Debug, c.t.logger)
-			c.updateRequests("PeerConn.mainReadLoop allowed fast")
+			c.peerSentAllowedFast(pieceIndex(msg.Index))
 		case pp.Extended:
 			err = c.onReadExtendedMsg(msg.ExtendedID, msg.ExtendedPayload)
 		case pp.Hashes:
@@ -1026,24 +1065,12 @@ func (cn *PeerConn) rw() io.ReadWriter {
 	}{cn.r, cn.w}
 }
 
+// Whether the choker has given the peer an upload slot, and we're still able to upload.
 func (c *PeerConn) uploadAllowed() bool {
-	if c.t.cl.config.NoUpload {
-		return false
-	}
-	if c.t.dataUploadDisallowed {
+	if !c.uploadPossible() {
 		return false
 	}
-	if c.t.seeding() {
-		return true
-	}
-	if !c.peerHasWantedPieces() {
-		return false
-	}
-	// Don't upload more than 100 KiB more than we download.
-	if c._stats.BytesWrittenData.Int64() >= c._stats.BytesReadData.Int64()+100<<10 {
-		return false
-	}
-	return true
+	return c.choker.uploadSlot || c.choker.optimistic
 }
 
 func (c *PeerConn) setRetryUploadTimer(delay time.Duration) {
@@ -1056,39 +1083,57 @@ func (c *PeerConn) setRetryUploadTimer(delay time.Duration) {
 
 // Also handles choking and unchoking of the remote peer.
 func (c *PeerConn) upload(msg func(pp.Message) bool) bool {
-	// Breaking or completing this loop means we don't want to upload to the peer anymore, and we
-	// choke them.
-another:
-	for c.uploadAllowed() {
-		// We want to upload to the peer.
-		if !c.unchoke(msg) {
-			return false
-		}
-		for r, state := range c.peerRequests {
-			if state.data == nil {
-				continue
-			}
-			res := c.t.cl.config.UploadRateLimiter.ReserveN(time.Now(), int(r.Length))
-			if !res.OK() {
-				panic(fmt.Sprintf("upload rate limiter burst size < %d", r.Length))
-			}
-			delay := res.Delay()
-			if delay > 0 {
-				res.Cancel()
-				c.setRetryUploadTimer(delay)
-				// Hard to say what to return here.
-				return true
+	for {
+		var sent, more bool
+		if c.uploadAllowed() {
+			// We want to upload to the peer.
+			if !c.unchoke(msg) {
+				return false
 			}
-			more := c.sendChunk(r, msg, state)
-			delete(c.peerRequests, r)
-			if !more {
+			sent, more = c.sendReadyPeerRequest(msg, func(Request) bool { return true })
+		} else {
+			if !c.choke(msg) {
 				return false
 			}
-			goto another
+			// Requests for allowed fast pieces are still served while choking.
+			sent, more = c.sendReadyPeerRequest(msg, c.requestAllowedFast)
 		}
-		return true
+		if !sent || !more {
+			return more
+		}
+	}
+}
+
+// Sends the data for a peer request that has been read from storage and satisfies filter, if the
+// rate limits allow it.
+func (c *PeerConn) sendReadyPeerRequest(
+	msg func(pp.Message) bool,
+	filter func(Request) bool,
+) (sent, more bool) {
+	for r, state := range c.peerRequests {
+		if state.data == nil || !filter(r) {
+			continue
+		}
+		now := time.Now()
+		res, ok := c.uploadRateLimiters().reserveN(now, int(r.Length))
+		if !ok {
+			panic(fmt.Sprintf("upload rate limiter burst size < %d", r.Length))
+		}
+		delay := res.delayFrom(now)
+		if delay > 0 {
+			res.cancel()
+			c.setRetryUploadTimer(delay)
+			// Hard to say what to return here.
+			return false, true
+		}
+		if c.choking {
+			torrent.Add("allowed fast chunks sent", 1)
+		}
+		more = c.sendChunk(r, msg, state)
+		delete(c.peerRequests, r)
+		return true, more
 	}
-	return c.choke(msg)
+	return false, true
 }
 
 func (cn *PeerConn) drop() {
@@ -1125,6 +1170,11 @@ func (c *Peer) setTorrent(t *Torrent) {
 	t.reconcileHandshakeStats(c)
 }
 
+func (c *PeerConn) setTorrent(t *Torrent) {
+	c.Peer.setTorrent(t)
+	c.torrentDownloadRateLimiter.Store(t.downloadRateLimiter)
+}
+
 func (c *PeerConn) pexPeerFlags() pp.PexPeerFlags {
 	f := pp.PexPeerFlags(0)
 	if c.PeerPrefersEncryption {
@@ -63,6 +63,10 @@ func (p *Piece) Info() metainfo.Piece {
 }
 
 func (p *Piece) Storage() storage.Piece {
+	return p.storageFor(p.t.storage.TorrentImpl)
+}
+
+func (p *Piece) storageFor(ts storage.TorrentImpl) storage.Piece {
 	var pieceHash g.Option[[]byte]
 	if p.hash != nil {
 		pieceHash.Set(p.hash.Bytes())
@@ -71,7 +75,7 @@ func (p *Piece) Storage() storage.Piece {
 	} else if p.hashV2.Ok {
 		pieceHash.Set(p.hashV2.Value[:])
 	}
-	return p.t.storage.PieceWithHash(p.Info(), pieceHash)
+	return storage.Torrent{TorrentImpl: ts}.PieceWithHash(p.Info(), pieceHash)
 }
 
 func (p *Piece) Flush() {
@@ -37,7 +37,7 @@ func (cl *Client) addPortMapping(d upnp.Device, proto upnp.Protocol, internalPor
 func (cl *Client) forwardPort() {
 	cl.lock()
 	defer cl.unlock()
-	if cl.config.NoDefaultPortForwarding {
+	if cl.config.NoDefaultPortForwarding || cl.config.proxyAll() {
 		return
 	}
 	cl.unlock()
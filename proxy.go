@@ -0,0 +1,115 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/anacrolix/utp"
+
+	"github.com/anacrolix/torrent/dialer"
+)
+
+// Whether trackers and HTTP go through ClientConfig.Proxy, and not just peer connections.
+func (cfg *ClientConfig) proxyAll() bool {
+	return cfg.Proxy != nil && !cfg.ProxyPeersOnly
+}
+
+func (cl *Client) trackerDialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if cl.config.proxyAll() {
+		return cl.config.Proxy.DialContext
+	}
+	return cl.config.TrackerDialContext
+}
+
+func (cl *Client) trackerListenPacket() func(network, addr string) (net.PacketConn, error) {
+	if !cl.config.proxyAll() {
+		return cl.config.TrackerListenPacket
+	}
+	return func(network, _ string) (net.PacketConn, error) {
+		pl, ok := cl.config.Proxy.(dialer.PacketListener)
+		if !ok {
+			return nil, errors.New("proxy doesn't support UDP")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cl.config.NominalDialTimeout)
+		defer cancel()
+		return pl.ListenPacket(ctx, network)
+	}
+}
+
+// Makes outgoing uTP connections through a proxy's UDP relay. The relay is associated on the first
+// dial, and again if it's lost. This uses the pure Go uTP implementation, since libutp can't run
+// over an arbitrary PacketConn.
+type proxyUtpDialer struct {
+	proxy  dialer.PacketListener
+	mu     sync.Mutex
+	socket *utp.Socket
+	relay  *relayPacketConn
+	closed bool
+}
+
+func (me *proxyUtpDialer) DialerNetwork() string {
+	return "udp"
+}
+
+func (me *proxyUtpDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	s, err := me.getSocket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.DialContext(ctx, "udp", addr)
+}
+
+func (me *proxyUtpDialer) getSocket(ctx context.Context) (*utp.Socket, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.closed {
+		return nil, net.ErrClosed
+	}
+	if me.socket != nil && !me.relay.lost.Load() {
+		return me.socket, nil
+	}
+	if me.socket != nil {
+		me.socket.Close()
+		me.socket = nil
+	}
+	pc, err := me.proxy.ListenPacket(ctx, "udp")
+	if err != nil {
+		return nil, err
+	}
+	relay := &relayPacketConn{PacketConn: pc}
+	s, err := utp.NewSocketFromPacketConn(relay)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	me.socket = s
+	me.relay = relay
+	return s, nil
+}
+
+func (me *proxyUtpDialer) Close() error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.closed = true
+	if me.socket == nil {
+		return nil
+	}
+	return me.socket.Close()
+}
+
+// Notes when reading fails, which is how the end of a relay association shows up.
+type relayPacketConn struct {
+	net.PacketConn
+	lost atomic.Bool
+}
+
+func (me *relayPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	n, addr, err = me.PacketConn.ReadFrom(b)
+	if err != nil {
+		me.lost.Store(true)
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/dialer"
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestProxyDisablesListenersAndDht(t *testing.T) {
+	cfg := TestingConfig(t)
+	cfg.NoDHT = false
+	cfg.LocalServiceDiscovery = true
+	cfg.Proxy = dialer.Socks5{Addr: "localhost:1080"}
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	qt.Check(t, qt.HasLen(cl.Listeners(), 0))
+	qt.Check(t, qt.HasLen(cl.DhtServers(), 0))
+	qt.Check(t, qt.IsNil(cl.lsd))
+	// uTP goes through the SOCKS5 UDP relay.
+	qt.Assert(t, qt.HasLen(cl.dialers, 2))
+	qt.Check(t, qt.Equals(cl.dialers[0].DialerNetwork(), "tcp"))
+	qt.Check(t, qt.Equals(cl.dialers[1].DialerNetwork(), "udp"))
+	qt.Check(t, qt.IsNotNil(cl.trackerDialContext()))
+	cfg.ProxyPeersOnly = true
+	qt.Check(t, qt.IsNil(cl.trackerDialContext()))
+}
+
+// Only outgoing peer connections go through the proxy, so listeners and DHT are kept.
+func TestProxyPeersOnlyKeepsListenersAndDht(t *testing.T) {
+	cfg := TestingConfig(t)
+	cfg.NoDHT = false
+	cfg.Proxy = dialer.Socks5{Addr: "localhost:1080"}
+	cfg.ProxyPeersOnly = true
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	qt.Check(t, qt.Not(qt.HasLen(cl.Listeners(), 0)))
+	qt.Check(t, qt.Not(qt.HasLen(cl.DhtServers(), 0)))
+	// The listeners would dial around the proxy.
+	qt.Assert(t, qt.HasLen(cl.dialers, 2))
+	qt.Check(t, qt.Equals(cl.dialers[0].DialerNetwork(), "tcp"))
+	qt.Check(t, qt.Equals(cl.dialers[1].DialerNetwork(), "udp"))
+}
+
+// A proxy that can't make TCP connections, and relays UDP without any encapsulation.
+type udpOnlyProxy struct{}
+
+func (udpOnlyProxy) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, errors.New("no TCP")
+}
+
+func (udpOnlyProxy) ListenPacket(_ context.Context, network string) (net.PacketConn, error) {
+	return net.ListenPacket(network, "127.0.0.1:0")
+}
+
+func TestProxyUtp(t *testing.T) {
+	seederDataDir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(seederDataDir)
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = seederDataDir
+	seeder, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer seeder.Close()
+	seederTorrent, _, _ := seeder.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	qt.Assert(t, qt.IsNil(seederTorrent.VerifyData()))
+
+	cfg = TestingConfig(t)
+	cfg.Proxy = udpOnlyProxy{}
+	leecher, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer leecher.Close()
+	leecherTorrent, _, _ := leecher.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	leecherTorrent.DownloadAll()
+	leecherTorrent.AddClientPeer(seeder)
+	select {
+	case <-leecherTorrent.Complete().On():
+	case <-time.After(10 * time.Second):
+		t.Fatal("leecher didn't complete")
+	}
+}
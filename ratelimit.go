@@ -0,0 +1,140 @@
+package torrent
+
+import (
+	"fmt"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"golang.org/x/time/rate"
+)
+
+// The burst for Torrent and peer download limiters. 64 KiB used to be a rough default buffer for
+// sockets on Windows.
+const defaultDownloadRateLimiterBurst = 1 << 16
+
+// Limiters that must all have capacity for data to be transferred, such as the Client, Torrent and
+// peer limits. Nil limiters are ignored.
+type rateLimiters []*rate.Limiter
+
+// The smallest burst of the limiters that are actually limiting.
+func (me rateLimiters) maxBurst() (ret g.Option[int]) {
+	for _, l := range me {
+		if l == nil || l.Limit() == rate.Inf {
+			continue
+		}
+		if !ret.Ok || l.Burst() < ret.Value {
+			ret = g.Some(l.Burst())
+		}
+	}
+	return
+}
+
+// Reserves n tokens from every limiter. If any limiter can never provide n tokens, nothing is
+// reserved.
+func (me rateLimiters) reserveN(now time.Time, n int) (ret rateReservations, ok bool) {
+	for _, l := range me {
+		if l == nil {
+			continue
+		}
+		r := l.ReserveN(now, n)
+		if !r.OK() {
+			ret.cancel()
+			return nil, false
+		}
+		ret = append(ret, r)
+	}
+	return ret, true
+}
+
+type rateReservations []*rate.Reservation
+
+// How long until all the reservations can be acted on.
+func (me rateReservations) delayFrom(now time.Time) (ret time.Duration) {
+	for _, r := range me {
+		ret = max(ret, r.DelayFrom(now))
+	}
+	return
+}
+
+func (me rateReservations) cancel() {
+	for _, r := range me {
+		r.Cancel()
+	}
+}
+
+// Torrent and peer limiters keep a fixed burst so their limits can be changed without racing
+// readers and writers. Upload reservations are made for whole chunks, so the burst must fit the
+// largest request we'll allocate for.
+func (cfg *ClientConfig) newUploadRateLimiter(r rate.Limit) *rate.Limiter {
+	return rate.NewLimiter(r, cfg.MaxAllocPeerRequestDataPerConn)
+}
+
+func newDownloadRateLimiter(r rate.Limit) *rate.Limiter {
+	return rate.NewLimiter(r, defaultDownloadRateLimiterBurst)
+}
+
+// Treats zero as unlimited, for config fields.
+func rateLimitOrInf(r rate.Limit) rate.Limit {
+	if r == 0 {
+		return rate.Inf
+	}
+	return r
+}
+
+// The limiters can't pause transfers: a zero limit would never have capacity for the data waiting
+// on it. Torrent.DisallowDataUpload and Torrent.DisallowDataDownload do that instead.
+func checkRateLimit(r rate.Limit) error {
+	if r <= 0 {
+		return fmt.Errorf("rate limit must be positive, got %v", r)
+	}
+	return nil
+}
+
+// Limits the rate of chunk data uploaded to the torrent's peers, in bytes per second. This applies
+// in addition to ClientConfig.UploadRateLimiter. Pass rate.Inf to remove the limit.
+func (t *Torrent) SetUploadRateLimit(r rate.Limit) error {
+	if err := checkRateLimit(r); err != nil {
+		return err
+	}
+	t.uploadRateLimiter.SetLimit(r)
+	return nil
+}
+
+// Limits the rate data is read from the torrent's peers and webseeds, in bytes per second. This
+// applies in addition to ClientConfig.DownloadRateLimiter. Pass rate.Inf to remove the limit.
+func (t *Torrent) SetDownloadRateLimit(r rate.Limit) error {
+	if err := checkRateLimit(r); err != nil {
+		return err
+	}
+	t.downloadRateLimiter.SetLimit(r)
+	return nil
+}
+
+// Returns the limits set by SetUploadRateLimit and SetDownloadRateLimit.
+func (t *Torrent) RateLimits() (upload, download rate.Limit) {
+	return t.uploadRateLimiter.Limit(), t.downloadRateLimiter.Limit()
+}
+
+// Limits the rate of chunk data uploaded to the peer, in bytes per second. This applies in addition
+// to the Torrent and Client limits. Pass rate.Inf to remove the limit.
+func (c *PeerConn) SetUploadRateLimit(r rate.Limit) error {
+	if err := checkRateLimit(r); err != nil {
+		return err
+	}
+	c.uploadRateLimiter.SetLimit(r)
+	return nil
+}
+
+// Limits the rate data is read from the peer, in bytes per second. This applies in addition to the
+// Torrent and Client limits. Pass rate.Inf to remove the limit.
+func (c *PeerConn) SetDownloadRateLimit(r rate.Limit) error {
+	if err := checkRateLimit(r); err != nil {
+		return err
+	}
+	c.downloadRateLimiter.SetLimit(r)
+	return nil
+}
+
+func (c *PeerConn) uploadRateLimiters() rateLimiters {
+	return rateLimiters{c.t.cl.config.UploadRateLimiter, c.t.uploadRateLimiter, c.uploadRateLimiter}
+}
@@ -0,0 +1,71 @@
+package torrent
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	qt "github.com/go-quicktest/qt"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitersCompose(t *testing.T) {
+	client := rate.NewLimiter(rate.Inf, 0)
+	torrent := rate.NewLimiter(100, 50)
+	peer := rate.NewLimiter(20, 40)
+	ls := rateLimiters{client, nil, torrent, peer}
+	qt.Check(t, qt.DeepEquals(ls.maxBurst(), g.Some(40)))
+	now := time.Now()
+	res, ok := ls.reserveN(now, 40)
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(res.delayFrom(now), 0))
+	// The slowest limiter determines the delay.
+	res, ok = ls.reserveN(now, 10)
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(res.delayFrom(now), 500*time.Millisecond))
+	// Exceeds the peer's burst.
+	_, ok = ls.reserveN(now, 41)
+	qt.Check(t, qt.IsFalse(ok))
+	peer.SetLimit(rate.Inf)
+	qt.Check(t, qt.DeepEquals(ls.maxBurst(), g.Some(50)))
+}
+
+func TestTorrentUploadRateLimitBoundsRequests(t *testing.T) {
+	cl := newTestingClient(t)
+	tor := cl.newTorrentForTesting()
+	c := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	c.setTorrent(tor)
+	qt.Check(t, qt.IsFalse(c.maximumPeerRequestChunkLength().Ok))
+	qt.Assert(t, qt.IsNil(tor.SetUploadRateLimit(1000)))
+	qt.Check(t, qt.DeepEquals(
+		c.maximumPeerRequestChunkLength(),
+		g.Some(cl.config.MaxAllocPeerRequestDataPerConn)))
+	qt.Assert(t, qt.IsNil(tor.SetUploadRateLimit(rate.Inf)))
+	qt.Assert(t, qt.IsNil(c.SetUploadRateLimit(1000)))
+	qt.Check(t, qt.IsTrue(c.maximumPeerRequestChunkLength().Ok))
+}
+
+// A zero limit would leave data that's been read or requested with no way through the limiters.
+func TestZeroRateLimitsRejected(t *testing.T) {
+	cl := newTestingClient(t)
+	tor := cl.newTorrentForTesting()
+	c := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	c.setTorrent(tor)
+	qt.Check(t, qt.IsNotNil(tor.SetUploadRateLimit(0)))
+	qt.Check(t, qt.IsNotNil(tor.SetDownloadRateLimit(0)))
+	qt.Check(t, qt.IsNotNil(c.SetUploadRateLimit(0)))
+	qt.Check(t, qt.IsNotNil(c.SetDownloadRateLimit(-1)))
+	up, down := tor.RateLimits()
+	qt.Check(t, qt.Equals(up, rate.Inf))
+	qt.Check(t, qt.Equals(down, rate.Inf))
+	// Reads still get through.
+	r := rateLimitedReader{
+		limiters: func() rateLimiters { return rateLimiters{tor.downloadRateLimiter, c.downloadRateLimiter} },
+		r:        strings.NewReader("hello"),
+	}
+	b, err := io.ReadAll(&r)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "hello"))
+}
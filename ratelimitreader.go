@@ -5,13 +5,12 @@ import (
 	"fmt"
 	"io"
 	"time"
-
-	"golang.org/x/time/rate"
 )
 
 type rateLimitedReader struct {
-	l *rate.Limiter
-	r io.Reader
+	// Called for each Read, as the limiters that apply can change.
+	limiters func() rateLimiters
+	r        io.Reader
 
 	// This is the time of the last Read's reservation.
 	lastRead time.Time
@@ -19,35 +18,41 @@ type rateLimitedReader struct {
 
 func (me *rateLimitedReader) Read(b []byte) (n int, err error) {
 	const oldStyle = false // Retained for future reference.
+	ls := me.limiters()
 	if oldStyle {
 		// Wait until we can read at all.
-		if err := me.l.WaitN(context.Background(), 1); err != nil {
-			panic(err)
+		for _, l := range ls {
+			if l == nil {
+				continue
+			}
+			if err := l.WaitN(context.Background(), 1); err != nil {
+				panic(err)
+			}
 		}
 		// Limit the read to within the burst.
-		if me.l.Limit() != rate.Inf && len(b) > me.l.Burst() {
-			b = b[:me.l.Burst()]
+		if burst := ls.maxBurst(); burst.Ok && len(b) > burst.Value {
+			b = b[:burst.Value]
 		}
 		n, err = me.r.Read(b)
 		// Pay the piper.
 		now := time.Now()
 		me.lastRead = now
-		if !me.l.ReserveN(now, n-1).OK() {
+		if _, ok := ls.reserveN(now, n-1); !ok {
 			panic(fmt.Sprintf("burst exceeded?: %d", n-1))
 		}
 	} else {
 		// Limit the read to within the burst.
-		if me.l.Limit() != rate.Inf && len(b) > me.l.Burst() {
-			b = b[:me.l.Burst()]
+		if burst := ls.maxBurst(); burst.Ok && len(b) > burst.Value {
+			b = b[:burst.Value]
 		}
 		n, err = me.r.Read(b)
 		now := time.Now()
-		r := me.l.ReserveN(now, n)
-		if !r.OK() {
+		r, ok := ls.reserveN(now, n)
+		if !ok {
 			panic(n)
 		}
 		me.lastRead = now
-		time.Sleep(r.Delay())
+		time.Sleep(r.delayFrom(now))
 	}
 	return
 }
@@ -263,6 +263,8 @@ func (r *reader) readOnceAt(ctx context.Context, b []byte, pos int64) (n int, er
 		err = io.EOF
 		return
 	}
+	// Don't read past the end of the reader, which may be followed by data of other files.
+	b = b[:min(int64(len(b)), r.length-pos)]
 	var avail int64
 	avail, err = r.waitAvailable(ctx, pos, int64(len(b)), n == 0)
 	if avail == 0 || err != nil {
@@ -149,6 +149,10 @@ func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex
 		// it will be served and therefore is the best candidate to cancel.
 		ml = ml.CmpInt64(rightLast.Sub(leftLast).Nanoseconds())
 	}
+	// Prefer pieces the peer suggested, as it can probably serve them cheaply.
+	ml = ml.Bool(
+		!p.peer.peerSuggested.Contains(leftPieceIndex),
+		!p.peer.peerSuggested.Contains(rightPieceIndex))
 	ml = ml.Int(
 		leftPiece.Availability,
 		rightPiece.Availability)
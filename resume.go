@@ -0,0 +1,312 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	infohash_v2 "github.com/anacrolix/torrent/types/infohash-v2"
+)
+
+// The file extension of resume files written by Client.SaveSession.
+const resumeFileExt = ".resume"
+
+// The state of a Torrent needed to add it again after a restart without losing progress. It's
+// bencoded into resume files, in the manner of libtorrent.
+type ResumeData struct {
+	InfoHash   metainfo.Hash `bencode:"info-hash"`
+	InfoHashV2 []byte        `bencode:"info-hash2,omitempty"`
+	// The raw info dict, if it was known.
+	Info        bencode.Bytes `bencode:"info,omitempty"`
+	DisplayName string        `bencode:"name,omitempty"`
+	Trackers    [][]string    `bencode:"trackers,omitempty"`
+	WebSeeds    []string      `bencode:"url-list,omitempty"`
+	HttpSeeds   []string      `bencode:"httpseeds,omitempty"`
+	// Known peers, as host:port.
+	Peers []string `bencode:"peers,omitempty"`
+	// The file storage directory. Empty if the storage isn't file storage in a known directory.
+	DataDir   string     `bencode:"save_path,omitempty"`
+	ChunkSize pp.Integer `bencode:"chunk-size,omitempty"`
+	// Per File.Priority, in info file order.
+	FilePriorities []PiecePriority `bencode:"file_priority,omitempty"`
+	// Priorities set directly on pieces, such as with Torrent.DownloadAll. One byte per piece.
+	PiecePriorities []byte `bencode:"piece_priority,omitempty"`
+	// Chunks written to storage in pieces that are not yet verified, as a serialized roaring
+	// bitmap of request indexes.
+	DirtyChunks []byte `bencode:"dirty-chunks,omitempty"`
+	// Torrent data totals, see ConnStats.
+	Uploaded   int64 `bencode:"total_uploaded"`
+	Downloaded int64 `bencode:"total_downloaded"`
+
+	DisallowDataUpload   bool `bencode:"disallow-upload,omitempty"`
+	DisallowDataDownload bool `bencode:"disallow-download,omitempty"`
+}
+
+// Returns the current state of the Torrent for adding it again later with
+// Client.AddTorrentFromResumeData.
+func (t *Torrent) ResumeData() (rd ResumeData, err error) {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	t.nameMu.RLock()
+	displayName := t.displayName
+	t.nameMu.RUnlock()
+	rd = ResumeData{
+		InfoHash:             t.infoHash.UnwrapOrZeroValue(),
+		DisplayName:          displayName,
+		Trackers:             t.metainfo.UpvertedAnnounceList().Clone(),
+		DataDir:              t.dataDir,
+		ChunkSize:            t.chunkSize,
+		Uploaded:             t.connStats.BytesWrittenData.Int64(),
+		Downloaded:           t.connStats.BytesReadUsefulData.Int64(),
+		DisallowDataUpload:   t.dataUploadDisallowed,
+		DisallowDataDownload: t.dataDownloadDisallowed.Bool(),
+	}
+	if t.infoHashV2.Ok {
+		rd.InfoHashV2 = t.infoHashV2.Value.Bytes()
+	}
+	for url := range t.webSeeds {
+		rd.WebSeeds = append(rd.WebSeeds, url)
+	}
+	for url := range t.httpSeeds {
+		rd.HttpSeeds = append(rd.HttpSeeds, url)
+	}
+	peers := make(map[string]struct{})
+	t.peers.Each(func(p PeerInfo) {
+		peers[p.Addr.String()] = struct{}{}
+	})
+	for c := range t.conns {
+		if c.outgoing {
+			peers[c.RemoteAddr.String()] = struct{}{}
+		}
+	}
+	for p := range peers {
+		rd.Peers = append(rd.Peers, p)
+	}
+	if !t.haveInfo() {
+		return
+	}
+	rd.Info = t.metadataBytes
+	for _, f := range *t.files {
+		rd.FilePriorities = append(rd.FilePriorities, f.prio)
+	}
+	rd.PiecePriorities = make([]byte, t.numPieces())
+	for i := range t.pieces {
+		rd.PiecePriorities[i] = byte(t.pieces[i].priority)
+	}
+	if !t.dirtyChunks.IsEmpty() {
+		rd.DirtyChunks, err = t.dirtyChunks.ToBytes()
+		if err != nil {
+			err = fmt.Errorf("serializing dirty chunks: %w", err)
+		}
+	}
+	return
+}
+
+// Adds a Torrent with the state saved by Torrent.ResumeData. If the Torrent is already in the
+// Client, the trackers, web seeds and peers are merged as for Torrent.MergeSpec, and no other
+// state is applied.
+func (cl *Client) AddTorrentFromResumeData(rd ResumeData) (t *Torrent, err error) {
+	opts := AddTorrentOpts{
+		InfoHash:  rd.InfoHash,
+		InfoBytes: rd.Info,
+		DataDir:   rd.DataDir,
+		ChunkSize: rd.ChunkSize,
+	}
+	if rd.InfoHashV2 != nil {
+		if len(rd.InfoHashV2) != infohash_v2.Size {
+			err = fmt.Errorf("bad v2 infohash length %v", len(rd.InfoHashV2))
+			return
+		}
+		opts.InfoHashV2.Set(infohash_v2.T(rd.InfoHashV2))
+	}
+	t, new := cl.AddTorrentOpt(opts)
+	err = t.MergeSpec(&TorrentSpec{
+		Trackers:             rd.Trackers,
+		DisplayName:          rd.DisplayName,
+		Webseeds:             rd.WebSeeds,
+		HttpSeeds:            rd.HttpSeeds,
+		PeerAddrs:            rd.Peers,
+		DisallowDataUpload:   rd.DisallowDataUpload,
+		DisallowDataDownload: rd.DisallowDataDownload,
+	})
+	if err != nil {
+		if new {
+			t.Drop()
+		}
+		return
+	}
+	if !new {
+		return
+	}
+	cl.lock()
+	defer cl.unlock()
+	t.connStats.BytesWrittenData.Add(rd.Uploaded)
+	t.connStats.BytesReadUsefulData.Add(rd.Downloaded)
+	if !t.haveInfo() {
+		return
+	}
+	t.applyResumePriorities(rd)
+	if rd.DirtyChunks != nil {
+		var dirty roaring.Bitmap
+		err = dirty.UnmarshalBinary(rd.DirtyChunks)
+		if err != nil {
+			err = fmt.Errorf("deserializing dirty chunks: %w", err)
+			return
+		}
+		t.restoreDirtyChunks(&dirty)
+	}
+	return
+}
+
+func (t *Torrent) applyResumePriorities(rd ResumeData) {
+	files := *t.files
+	if len(rd.FilePriorities) == len(files) {
+		for i, f := range files {
+			f.prio = rd.FilePriorities[i]
+		}
+	}
+	if len(rd.PiecePriorities) == len(t.pieces) {
+		for i := range t.pieces {
+			t.pieces[i].priority = PiecePriority(rd.PiecePriorities[i])
+		}
+	}
+	t.updateAllPiecePriorities("Client.AddTorrentFromResumeData")
+}
+
+// Marks chunks as already written, for pieces that storage doesn't have. Pieces that were entirely
+// written are queued for hashing.
+func (t *Torrent) restoreDirtyChunks(dirty *roaring.Bitmap) {
+	var touched []pieceIndex
+	dirty.Iterate(func(x uint32) bool {
+		ri := RequestIndex(x)
+		if ri >= t.numChunks() {
+			return false
+		}
+		piece := t.pieceIndexOfRequestIndex(ri)
+		if t.pieceComplete(piece) {
+			return true
+		}
+		t.dirtyChunks.Add(ri)
+		if len(touched) == 0 || touched[len(touched)-1] != piece {
+			touched = append(touched, piece)
+		}
+		return true
+	})
+	for _, piece := range touched {
+		t.updatePieceRequestOrderPiece(piece)
+		if t.pieceAllDirty(piece) {
+			t.queuePieceCheck(piece)
+		}
+	}
+}
+
+// Writes a resume file for each Torrent to the directory, and removes resume files for Torrents
+// no longer in the Client.
+func (cl *Client) SaveSession(dir string) (err error) {
+	err = os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return
+	}
+	keep := make(map[string]struct{})
+	var errs []error
+	for _, t := range cl.Torrents() {
+		name := t.InfoHash().HexString() + resumeFileExt
+		keep[name] = struct{}{}
+		err := writeResumeFile(filepath.Join(dir, name), t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saving %v: %w", t, err))
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, e := range entries {
+		if _, ok := keep[e.Name()]; ok || !strings.HasSuffix(e.Name(), resumeFileExt) {
+			continue
+		}
+		err := os.Remove(filepath.Join(dir, e.Name()))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeResumeFile(path string, t *Torrent) error {
+	rd, err := t.ResumeData()
+	if err != nil {
+		return err
+	}
+	b, err := bencode.Marshal(rd)
+	if err != nil {
+		return err
+	}
+	// Replace any existing file atomically so a crash doesn't leave a truncated one behind.
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		// Otherwise the rename can reach the disk before the data does.
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Adds the Torrents from the resume files written by Client.SaveSession. Torrents that are
+// restored are returned even if there are errors for others. A missing directory is not an error.
+func (cl *Client) RestoreSession(dir string) (ts []*Torrent, err error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var errs []error
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), resumeFileExt) {
+			continue
+		}
+		t, err := cl.restoreResumeFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restoring %q: %w", e.Name(), err))
+			continue
+		}
+		ts = append(ts, t)
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+func (cl *Client) restoreResumeFile(path string) (*Torrent, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rd ResumeData
+	err = bencode.Unmarshal(b, &rd)
+	if err != nil {
+		return nil, err
+	}
+	return cl.AddTorrentFromResumeData(rd)
+}
@@ -0,0 +1,76 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestSessionSaveRestore(t *testing.T) {
+	sessionDir := t.TempDir()
+	dataDir := t.TempDir()
+	stale := filepath.Join(sessionDir, "stale"+resumeFileExt)
+	qt.Assert(t, qt.IsNil(os.WriteFile(stale, nil, 0o640)))
+	_, mi := testutil.GreetingTestTorrent()
+	trackers := metainfo.AnnounceList{{"http://example.com/announce"}}
+
+	cl, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	tor, _ := cl.AddTorrentOpt(AddTorrentOpts{
+		InfoHash:  mi.HashInfoBytes(),
+		InfoBytes: mi.InfoBytes,
+		DataDir:   dataDir,
+		ChunkSize: 2,
+	})
+	tor.AddTrackers(trackers)
+	tor.Files()[0].SetPriority(PiecePriorityHigh)
+	cl.lock()
+	tor.piece(1).unpendChunkIndex(1)
+	cl.unlock()
+	qt.Assert(t, qt.IsNil(cl.SaveSession(sessionDir)))
+	cl.Close()
+	_, err = os.Stat(stale)
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+
+	cl, err = NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	ts, err := cl.RestoreSession(sessionDir)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.HasLen(ts, 1))
+	tor = ts[0]
+	qt.Check(t, qt.Equals(tor.InfoHash(), mi.HashInfoBytes()))
+	qt.Check(t, qt.IsTrue(tor.haveInfo()))
+	qt.Check(t, qt.Equals(tor.dataDir, dataDir))
+	qt.Check(t, qt.Equals(tor.chunkSize, 2))
+	qt.Check(t, qt.Equals(tor.Files()[0].Priority(), PiecePriorityHigh))
+	restoredMi := tor.Metainfo()
+	qt.Check(t, qt.DeepEquals(restoredMi.UpvertedAnnounceList(), trackers))
+	cl.lock()
+	qt.Check(t, qt.IsTrue(tor.piece(1).chunkIndexDirty(1)))
+	qt.Check(t, qt.Equals(tor.dirtyChunks.GetCardinality(), 1))
+	cl.unlock()
+}
+
+func TestResumeDataBencodeRoundTrip(t *testing.T) {
+	rd := ResumeData{
+		Info:            bencode.Bytes("d4:name5:helloe"),
+		Trackers:        [][]string{{"udp://a"}, {"udp://b", "udp://c"}},
+		Peers:           []string{"1.2.3.4:5"},
+		FilePriorities:  []PiecePriority{PiecePriorityNone, PiecePriorityNow},
+		PiecePriorities: []byte{1, 0},
+		Uploaded:        3,
+	}
+	rd.InfoHash[0] = 1
+	b, err := bencode.Marshal(rd)
+	qt.Assert(t, qt.IsNil(err))
+	var out ResumeData
+	qt.Assert(t, qt.IsNil(bencode.Unmarshal(b, &out)))
+	qt.Check(t, qt.DeepEquals(out, rd))
+}
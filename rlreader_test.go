@@ -66,8 +66,8 @@ func TestRateLimitReaders(t *testing.T) {
 		go func() {
 			defer wg.Done()
 			r := rateLimitedReader{
-				l: shared,
-				r: r,
+				limiters: func() rateLimiters { return rateLimiters{shared} },
+				r:        r,
 			}
 			b := make([]byte, readSize)
 			for {
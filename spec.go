@@ -28,6 +28,8 @@ type TorrentSpec struct {
 	Webseeds  []string
 	DhtNodes  []string
 	PeerAddrs []string
+	// BEP 17 HTTP seed URLs.
+	HttpSeeds []string
 	// The combination of the "xs" and "as" fields in magnet links, for now.
 	Sources []string
 	// BEP 52 "piece layers" from metainfo
@@ -88,6 +90,7 @@ func TorrentSpecFromMetaInfoErr(mi *metainfo.MetaInfo) (*TorrentSpec, error) {
 		InfoBytes:   mi.InfoBytes,
 		DisplayName: info.BestName(),
 		Webseeds:    mi.UrlList,
+		HttpSeeds:   mi.HttpSeeds,
 		DhtNodes: func() (ret []string) {
 			ret = make([]string, 0, len(mi.Nodes))
 			for _, node := range mi.Nodes {
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/internal/clonefile"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/segments"
+)
+
+type NewContentAddressedOpts struct {
+	NewFileClientOpts
+	// Complete files are added here, named by a key derived from their content. It must be on the
+	// same filesystem as the torrent data. Defaults to ".objects" in ClientBaseDir.
+	ObjectsDir string
+}
+
+// File storage that deduplicates files across torrents. Complete files are added to a store keyed
+// by their v2 pieces root, or their v1 piece hashes when they're aligned to pieces. When a torrent
+// is opened, files that are already in the store are put in place and their pieces are complete
+// immediately. Data is never copied to do this: reflinks are used where the filesystem supports
+// them, and otherwise hard links. Hard linked files are read-only, and are replaced with a copy
+// before they're written, so writes never change the store or other torrents' files.
+func NewContentAddressed(opts NewContentAddressedOpts) ClientImplCloser {
+	if opts.ObjectsDir == "" {
+		opts.ObjectsDir = filepath.Join(opts.ClientBaseDir, ".objects")
+	}
+	return contentAddressedClientImpl{
+		fileClientImpl: newFileClientImpl(opts.NewFileClientOpts),
+		objectsDir:     opts.ObjectsDir,
+	}
+}
+
+type contentAddressedClientImpl struct {
+	fileClientImpl
+	objectsDir string
+}
+
+func (me contentAddressedClientImpl) OpenTorrent(
+	ctx context.Context,
+	info *metainfo.Info,
+	infoHash metainfo.Hash,
+) (TorrentImpl, error) {
+	fts, err := me.openTorrent(ctx, info, infoHash)
+	if err != nil {
+		return TorrentImpl{}, err
+	}
+	fts.copyOnWrite = true
+	t := &contentAddressedTorrent{
+		fts:        fts,
+		info:       info,
+		objectsDir: me.objectsDir,
+	}
+	t.init()
+	return TorrentImpl{
+		Piece: func(p metainfo.Piece) PieceImpl {
+			return contentAddressedPiece{fts.Piece(p), t, p.Index()}
+		},
+		Close: func() error {
+			t.storing.Wait()
+			return fts.Close()
+		},
+		Flush:         fts.Flush,
+		SetFileWanted: fts.setFileWanted,
+	}, nil
+}
+
+type contentAddressedTorrent struct {
+	fts        *fileTorrentImpl
+	info       *metainfo.Info
+	objectsDir string
+	// Per file. Empty if the file content can't be identified from the info.
+	keys    []string
+	extents []segments.Extent
+
+	mu            sync.Mutex
+	pieceComplete []bool
+	// Incomplete pieces per file.
+	fileRemaining []int
+	// Files are added to the store in the background, so marking pieces complete doesn't wait on
+	// it.
+	storing sync.WaitGroup
+}
+
+func (me *contentAddressedTorrent) init() {
+	files := me.info.UpvertedFiles()
+	me.extents = fileExtents(me.info, files)
+	me.keys = make([]string, len(files))
+	for i := range files {
+		me.keys[i] = fileContentKey(me.info, files, me.extents, i)
+	}
+	me.pieceComplete = make([]bool, me.info.NumPieces())
+	for i := range me.pieceComplete {
+		me.pieceComplete[i] = me.fts.Piece(me.info.Piece(i)).Completion().Complete
+	}
+	linked := make([]bool, len(files))
+	for i := range files {
+		linked[i] = me.linkFromStore(i)
+	}
+	// Pieces made up of files from the store and padding are complete.
+	for i := range me.pieceComplete {
+		if me.pieceComplete[i] {
+			continue
+		}
+		all := true
+		me.pieceFiles(i, func(fileIndex int) {
+			all = all && (linked[fileIndex] || me.fts.files[fileIndex].padding)
+		})
+		if !all {
+			continue
+		}
+		err := me.fts.completion.Set(metainfo.PieceKey{InfoHash: me.fts.infoHash, Index: i}, true)
+		if err != nil {
+			log.Levelf(log.Warning, "marking deduplicated piece %v complete: %v", i, err)
+			continue
+		}
+		me.pieceComplete[i] = true
+	}
+	me.fileRemaining = make([]int, len(files))
+	for i := range me.pieceComplete {
+		if !me.pieceComplete[i] {
+			me.pieceFiles(i, func(fileIndex int) {
+				me.fileRemaining[fileIndex]++
+			})
+		}
+	}
+	// Files completed before this storage was used still get stored.
+	for i := range files {
+		if me.fileRemaining[i] == 0 {
+			me.startAddToStore(i)
+		}
+	}
+}
+
+// Calls f with the index of each file with data in the piece.
+func (me *contentAddressedTorrent) pieceFiles(piece int, f func(fileIndex int)) {
+	p := me.info.Piece(piece)
+	me.fts.segmentLocater.Locate(segments.Extent{Start: p.Offset(), Length: p.Length()}, func(i int, _ segments.Extent) bool {
+		f(i)
+		return true
+	})
+}
+
+func (me *contentAddressedTorrent) objectPath(fileIndex int) string {
+	return filepath.Join(me.objectsDir, me.keys[fileIndex])
+}
+
+// Links the file into place from the store if it's there and the file doesn't exist yet.
+func (me *contentAddressedTorrent) linkFromStore(fileIndex int) bool {
+	if me.keys[fileIndex] == "" {
+		return false
+	}
+	f := me.fts.files[fileIndex]
+	fi, err := os.Stat(me.objectPath(fileIndex))
+	if err != nil || fi.Size() != f.length {
+		return false
+	}
+	if _, err := os.Lstat(f.path); !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	os.MkdirAll(filepath.Dir(f.path), 0o777)
+	err = clonefile.Reflink(me.objectPath(fileIndex), f.path)
+	if err == nil {
+		err = os.Chmod(f.path, 0o644)
+	} else {
+		// The file shares the read-only object, and is replaced by a copy when it's written.
+		err = os.Link(me.objectPath(fileIndex), f.path)
+	}
+	if err != nil {
+		log.Levelf(log.Warning, "linking %q from store: %v", f.path, err)
+		return false
+	}
+	return true
+}
+
+// Adds a complete file to the store in the background. Must be called with mu held, or before the
+// torrent is in use.
+func (me *contentAddressedTorrent) startAddToStore(fileIndex int) {
+	if me.keys[fileIndex] == "" {
+		return
+	}
+	me.storing.Add(1)
+	go func() {
+		defer me.storing.Done()
+		me.addToStore(fileIndex)
+	}()
+}
+
+// Adds a complete file to the store, if it isn't there already. The object is a reflink of the
+// file if possible. Otherwise it's a hard link, and it and the file are made read-only, so that the
+// file is replaced with a copy before it's written.
+func (me *contentAddressedTorrent) addToStore(fileIndex int) {
+	objectPath := me.objectPath(fileIndex)
+	if _, err := os.Stat(objectPath); err == nil {
+		return
+	}
+	me.fts.mu.RLock()
+	defer me.fts.mu.RUnlock()
+	f := me.fts.files[fileIndex]
+	if f.inPart || !me.fileComplete(fileIndex) {
+		return
+	}
+	os.MkdirAll(me.objectsDir, 0o777)
+	err := clonefile.Reflink(f.path, objectPath)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		err = os.Link(f.path, objectPath)
+	}
+	if err == nil {
+		err = os.Chmod(objectPath, 0o444)
+	}
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		log.Levelf(log.Warning, "adding %q to store: %v", f.path, err)
+	}
+}
+
+// Whether all the file's pieces are still complete.
+func (me *contentAddressedTorrent) fileComplete(fileIndex int) bool {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.fileRemaining[fileIndex] == 0
+}
+
+func (me *contentAddressedTorrent) setPieceComplete(piece int, complete bool) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.pieceComplete[piece] == complete {
+		return
+	}
+	me.pieceComplete[piece] = complete
+	me.pieceFiles(piece, func(fileIndex int) {
+		if complete {
+			me.fileRemaining[fileIndex]--
+			if me.fileRemaining[fileIndex] == 0 {
+				me.startAddToStore(fileIndex)
+			}
+		} else {
+			me.fileRemaining[fileIndex]++
+		}
+	})
+}
+
+type contentAddressedPiece struct {
+	PieceImpl
+	t     *contentAddressedTorrent
+	index int
+}
+
+func (me contentAddressedPiece) MarkComplete() error {
+	err := me.PieceImpl.MarkComplete()
+	if err == nil {
+		me.t.setPieceComplete(me.index, true)
+	}
+	return err
+}
+
+func (me contentAddressedPiece) MarkNotComplete() error {
+	me.t.setPieceComplete(me.index, false)
+	return me.PieceImpl.MarkNotComplete()
+}
+
+// The extent of each file within the torrent data.
+func fileExtents(info *metainfo.Info, files []metainfo.FileInfo) (ret []segments.Extent) {
+	var offset int64
+	for _, fi := range files {
+		ret = append(ret, segments.Extent{Start: offset, Length: fi.Length})
+		offset += fi.Length
+		if info.FilesArePieceAligned() {
+			offset = (offset + info.PieceLength - 1) / info.PieceLength * info.PieceLength
+		}
+	}
+	return
+}
+
+// Returns a key that identifies the file's content, or "" if it can't be determined from the info.
+// v1 piece hashes only identify a file's content if the file's pieces don't contain data from
+// other files.
+func fileContentKey(info *metainfo.Info, files []metainfo.FileInfo, extents []segments.Extent, i int) string {
+	fi := &files[i]
+	if fi.Length == 0 || fi.IsPadding() {
+		return ""
+	}
+	if fi.PiecesRoot.Ok {
+		return fmt.Sprintf("v2-%x-%d", fi.PiecesRoot.Value, fi.Length)
+	}
+	if !info.HasV1() || extents[i].Start%info.PieceLength != 0 {
+		return ""
+	}
+	end := extents[i].End()
+	pieceEnd := (end + info.PieceLength - 1) / info.PieceLength * info.PieceLength
+	for j := i + 1; j < len(files) && extents[j].Start < pieceEnd; j++ {
+		if files[j].Length != 0 && !files[j].IsPadding() {
+			return ""
+		}
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "%d:%d:", info.PieceLength, fi.Length)
+	for p := extents[i].Start / info.PieceLength; p < pieceEnd/info.PieceLength; p++ {
+		h.Write(info.Pieces[p*metainfo.HashSize : (p+1)*metainfo.HashSize])
+	}
+	return fmt.Sprintf("v1-%x", h.Sum(nil))
+}
@@ -32,13 +32,18 @@ func (fs *filePieceImpl) Completion() Completion {
 
 	verified := true
 	if c.Complete {
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
 		// If it's allegedly complete, check that its constituent files have the necessary length.
 		if !fs.segmentLocater.Locate(segments.Extent{
 			Start:  fs.p.Offset(),
 			Length: fs.p.Length(),
 		}, func(i int, extent segments.Extent) bool {
 			file := fs.files[i]
-			s, err := os.Stat(file.path)
+			if file.padding {
+				return true
+			}
+			s, err := os.Stat(file.dataPath())
 			if err != nil || s.Size() < extent.Start+extent.Length {
 				verified = false
 				return false
@@ -2,14 +2,19 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/anacrolix/torrent/storage/internal/shared"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 
 	"github.com/anacrolix/log"
+	"github.com/anacrolix/missinggo/v2"
+
+	"github.com/anacrolix/torrent/internal/clonefile"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/segments"
 )
@@ -41,6 +46,10 @@ type NewFileClientOpts struct {
 
 // NewFileWithOpts creates a new ClientImplCloser that stores files using the OS native filesystem.
 func NewFileWithOpts(opts NewFileClientOpts) ClientImplCloser {
+	return newFileClientImpl(opts)
+}
+
+func newFileClientImpl(opts NewFileClientOpts) fileClientImpl {
 	if opts.TorrentDirMaker == nil {
 		opts.TorrentDirMaker = defaultPathMaker
 	}
@@ -67,12 +76,26 @@ func (me fileClientImpl) Close() error {
 	return me.opts.PieceCompletion.Close()
 }
 
-func (fs fileClientImpl) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (shared.TorrentImpl, error) {
+func (fs fileClientImpl) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (TorrentImpl, error) {
+	t, err := fs.openTorrent(ctx, info, infoHash)
+	if err != nil {
+		return TorrentImpl{}, err
+	}
+	return TorrentImpl{
+		Piece:         t.Piece,
+		Close:         t.Close,
+		Flush:         t.Flush,
+		SetFileWanted: t.setFileWanted,
+	}, nil
+}
+
+func (fs fileClientImpl) openTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (*fileTorrentImpl, error) {
 	dir := fs.opts.TorrentDirMaker(fs.opts.ClientBaseDir, info, infoHash)
 	logger := log.ContextLogger(ctx).Slogger()
 	logger.DebugContext(ctx, "opened file torrent storage", slog.String("dir", dir))
 	upvertedFiles := info.UpvertedFiles()
 	files := make([]file, 0, len(upvertedFiles))
+	partsDir := filepath.Join(dir, "."+infoHash.HexString()+".parts")
 	for i, fileInfo := range upvertedFiles {
 		filePath := filepath.Join(dir, fs.opts.FilePathMaker(FilePathMakerOpts{
 			Info: info,
@@ -83,19 +106,60 @@ func (fs fileClientImpl) OpenTorrent(ctx context.Context, info *metainfo.Info, i
 			return nil, err
 		}
 		f := file{
-			path:   filePath,
-			length: fileInfo.Length,
+			path:     filePath,
+			partPath: filepath.Join(partsDir, strconv.Itoa(i)),
+			length:   fileInfo.Length,
+			padding:  fileInfo.IsPadding(),
+		}
+		if f.padding {
+			files = append(files, f)
+			continue
+		}
+		// Data for a file that wasn't wanted when it was last open might still be in its part
+		// file.
+		if _, err := os.Stat(f.path); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Stat(f.partPath); err == nil {
+				f.inPart = true
+			}
 		}
 		if f.length == 0 {
 			err := CreateNativeZeroLengthFile(f.path)
 			if err != nil {
 				return nil, err
 			}
+		}
+		files = append(files, f)
+	}
+	t := &fileTorrentImpl{
+		files:          files,
+		segmentLocater: info.FileSegmentsIndex(),
+		infoHash:       infoHash,
+		completion:     fs.opts.PieceCompletion,
+		partsDir:       partsDir,
+	}
+	return t, nil
+}
 
 type file struct {
 	// The safe, OS-local file path.
 	path   string
 	length int64
+	// Where data is kept instead of path while the file isn't wanted, so that it doesn't appear
+	// in the user-visible tree. Pieces on the boundary with wanted files still need somewhere to
+	// be stored.
+	partPath string
+	// Data is currently in partPath.
+	inPart bool
+	// BEP 47 padding files are never stored. They're read as zeroes.
+	padding bool
+}
+
+// The path where the file's data is currently kept.
+func (f *file) dataPath() string {
+	if f.inPart {
+		return f.partPath
+	}
+	return f.path
 }
 
 type fileTorrentImpl struct {
@@ -103,6 +167,16 @@ type fileTorrentImpl struct {
 	segmentLocater segments.Index
 	infoHash       metainfo.Hash
 	completion     PieceCompletion
+	// Holds part files, which are named by file index.
+	partsDir string
+	// Read-locked while using files, and write-locked while moving them between part files and
+	// their paths.
+	mu sync.RWMutex
+	// Files without write permission share their data with other files, and are replaced with a
+	// copy before they're written. See NewContentAddressed.
+	copyOnWrite bool
+	// Serializes replacing shared files, so that a copy doesn't replace one that's been written.
+	unshareMu sync.Mutex
 }
 
 func (fts *fileTorrentImpl) Piece(p metainfo.Piece) PieceImpl {
@@ -110,10 +184,10 @@ func (fts *fileTorrentImpl) Piece(p metainfo.Piece) PieceImpl {
 	_io := fileTorrentImplIO{fts}
 	// Return the appropriate segments of this.
 	return &filePieceImpl{
-		fts: fts,
-		p: p,
-		w: missinggo.NewSectionWriter(_io, p.Offset(), p.Length()),
-		r: io.NewSectionReader(_io, p.Offset(), p.Length()),
+		fileTorrentImpl: fts,
+		p:               p,
+		WriterAt:        missinggo.NewSectionWriter(_io, p.Offset(), p.Length()),
+		ReaderAt:        io.NewSectionReader(_io, p.Offset(), p.Length()),
 	}
 }
 
@@ -121,10 +195,55 @@ func (fs *fileTorrentImpl) Close() error {
 	return nil
 }
 
+// Unwanted files that don't exist yet have their data kept in a part file. When a file becomes
+// wanted, its part file is moved into place. If the file was created in the meantime, the part
+// file is discarded.
+func (fts *fileTorrentImpl) setFileWanted(index int, wanted bool) error {
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+	f := &fts.files[index]
+	if f.padding {
+		return nil
+	}
+	if !wanted {
+		if _, err := os.Stat(f.path); errors.Is(err, os.ErrNotExist) {
+			f.inPart = true
+		}
+		return nil
+	}
+	if !f.inPart {
+		return nil
+	}
+	f.inPart = false
+	_, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.MkdirAll(filepath.Dir(f.path), 0o777)
+		if err == nil {
+			err = os.Rename(f.partPath, f.path)
+		}
+	} else if err == nil {
+		err = os.Remove(f.partPath)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing was written to the part file.
+		err = nil
+	}
+	if err != nil {
+		f.inPart = true
+		return fmt.Errorf("moving part file into place: %w", err)
+	}
+	// Only succeeds if there are no more part files.
+	os.Remove(fts.partsDir)
+	return nil
+}
+
 func fsync(filePath string) (err error) {
-	_ = os.MkdirAll(filepath.Dir(filePath), 0o777)
 	var f *os.File
-	f, err = os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0o666)
+	f, err = os.OpenFile(filePath, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing has been written to it.
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -136,14 +255,53 @@ func fsync(filePath string) (err error) {
 }
 
 func (fts *fileTorrentImpl) Flush() error {
+	fts.mu.RLock()
+	defer fts.mu.RUnlock()
 	for _, f := range fts.files {
-		if err := fsync(f.path); err != nil {
+		if f.padding {
+			continue
+		}
+		if fts.copyOnWrite && readOnlyFile(f.dataPath()) {
+			// Shared data is never written.
+			continue
+		}
+		if err := fsync(f.dataPath()); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Whether the file exists without write permission.
+func readOnlyFile(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().Perm()&0o200 == 0
+}
+
+// Replaces a read-only file with a writable copy, so that writing it doesn't change the data it
+// shares with other files.
+func (fts *fileTorrentImpl) unshare(name string) error {
+	fts.unshareMu.Lock()
+	defer fts.unshareMu.Unlock()
+	if !readOnlyFile(name) {
+		return nil
+	}
+	tmp := name + ".unshare"
+	os.Remove(tmp)
+	err := clonefile.Clone(name, tmp)
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying shared file before writing: %w", err)
+	}
+	return nil
+}
+
 // A helper to create zero-length files which won't appear for file-orientated storage since no
 // writes will ever occur to them (no torrent data is associated with a zero-length file). The
 // caller should make sure the file name provided is safe/sanitized.
@@ -164,7 +322,15 @@ type fileTorrentImplIO struct {
 
 // Returns EOF on short or missing file.
 func (fst fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int, err error) {
-	f, err := os.Open(file.path)
+	// Limit the read to within the expected bounds of this file.
+	if int64(len(b)) > file.length-off {
+		b = b[:file.length-off]
+	}
+	if file.padding {
+		clear(b)
+		return len(b), nil
+	}
+	f, err := os.Open(file.dataPath())
 	if os.IsNotExist(err) {
 		// File missing is treated the same as a short file.
 		err = io.EOF
@@ -174,10 +340,6 @@ func (fst fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int,
 		return
 	}
 	defer f.Close()
-	// Limit the read to within the expected bounds of this file.
-	if int64(len(b)) > file.length-off {
-		b = b[:file.length-off]
-	}
 	for off < file.length && len(b) != 0 {
 		n1, err1 := f.ReadAt(b, off)
 		b = b[n1:]
@@ -193,6 +355,8 @@ func (fst fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int,
 
 // Only returns EOF at the end of the torrent. Premature EOF is ErrUnexpectedEOF.
 func (fst fileTorrentImplIO) ReadAt(b []byte, off int64) (n int, err error) {
+	fst.fts.mu.RLock()
+	defer fst.fts.mu.RUnlock()
 	fst.fts.segmentLocater.Locate(segments.Extent{off, int64(len(b))}, func(i int, e segments.Extent) bool {
 		n1, err1 := fst.readFileAt(fst.fts.files[i], b[:e.Length], e.Start)
 		n += n1
@@ -207,10 +371,25 @@ func (fst fileTorrentImplIO) ReadAt(b []byte, off int64) (n int, err error) {
 }
 
 func (fst fileTorrentImplIO) WriteAt(p []byte, off int64) (n int, err error) {
+	fst.fts.mu.RLock()
+	defer fst.fts.mu.RUnlock()
 	// log.Printf("write at %v: %v bytes", off, len(p))
 	fst.fts.segmentLocater.Locate(segments.Extent{off, int64(len(p))}, func(i int, e segments.Extent) bool {
-		name := fst.fts.files[i].path
+		file := fst.fts.files[i]
+		if file.padding {
+			// Padding is all zeroes, and isn't stored.
+			n += int(e.Length)
+			p = p[e.Length:]
+			return true
+		}
+		name := file.dataPath()
 		os.MkdirAll(filepath.Dir(name), 0o777)
+		if fst.fts.copyOnWrite {
+			err = fst.fts.unshare(name)
+			if err != nil {
+				return false
+			}
+		}
 		var f *os.File
 		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0o666)
 		if err != nil {
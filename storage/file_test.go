@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
 	"io"
 	"os"
 	"path/filepath"
@@ -41,3 +42,107 @@ func TestShortFile(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestPartFiles(t *testing.T) {
+	td := t.TempDir()
+	s := NewFile(td)
+	defer s.Close()
+	info := &metainfo.Info{
+		Name: "t",
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 3},
+			{Path: []string{"pad"}, Length: 1, ExtendedFileAttrs: metainfo.ExtendedFileAttrs{Attr: "p"}},
+			{Path: []string{"b"}, Length: 4},
+		},
+		PieceLength: 8,
+		Pieces:      make([]byte, 20),
+	}
+	ts, err := s.OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(ts.SetFileWanted(0, false)))
+	p := ts.Piece(info.Piece(0))
+	_, err = p.WriteAt([]byte("abc\x00defg"), 0)
+	qt.Assert(t, qt.IsNil(err))
+	// Only the wanted file is in the tree.
+	_, err = os.Stat(filepath.Join(td, "t", "a"))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+	_, err = os.Stat(filepath.Join(td, "t", "pad"))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+	b, err := os.ReadFile(filepath.Join(td, "t", "b"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "defg"))
+	buf := make([]byte, 8)
+	_, err = p.ReadAt(buf, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(buf), "abc\x00defg"))
+
+	qt.Assert(t, qt.IsNil(ts.SetFileWanted(0, true)))
+	b, err = os.ReadFile(filepath.Join(td, "t", "a"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "abc"))
+	_, err = os.Stat(filepath.Join(td, "."+metainfo.Hash{}.HexString()+".parts"))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+}
+
+func TestContentAddressed(t *testing.T) {
+	td := t.TempDir()
+	s := NewContentAddressed(NewContentAddressedOpts{
+		NewFileClientOpts: NewFileClientOpts{
+			ClientBaseDir:   td,
+			PieceCompletion: NewMapPieceCompletion(),
+		},
+	})
+	defer s.Close()
+	pieceHash := sha1.Sum([]byte("abcd"))
+	newInfo := func(name string) *metainfo.Info {
+		return &metainfo.Info{
+			Name:        name,
+			Length:      4,
+			PieceLength: 4,
+			Pieces:      pieceHash[:],
+		}
+	}
+	info1 := newInfo("a")
+	ts1, err := s.OpenTorrent(context.Background(), info1, metainfo.Hash{1})
+	qt.Assert(t, qt.IsNil(err))
+	p := ts1.Piece(info1.Piece(0))
+	_, err = p.WriteAt([]byte("abcd"), 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(p.MarkComplete()))
+	// Closing waits for the file to be added to the store.
+	qt.Assert(t, qt.IsNil(ts1.Close()))
+	entries, err := os.ReadDir(filepath.Join(td, ".objects"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.HasLen(entries, 1))
+	fi, err := entries[0].Info()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(fi.Mode().Perm()&0o222, 0))
+
+	// A torrent with the same file content completes immediately.
+	info2 := newInfo("b")
+	ts2, err := s.OpenTorrent(context.Background(), info2, metainfo.Hash{2})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(ts2.Piece(info2.Piece(0)).Completion().Complete))
+	b, err := os.ReadFile(filepath.Join(td, "b"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "abcd"))
+
+	// Writing one torrent's copy doesn't change the others, or the store.
+	p2 := ts2.Piece(info2.Piece(0))
+	qt.Assert(t, qt.IsNil(p2.MarkNotComplete()))
+	_, err = p2.WriteAt([]byte("efgh"), 0)
+	qt.Assert(t, qt.IsNil(err))
+	b, err = os.ReadFile(filepath.Join(td, "b"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "efgh"))
+	b, err = os.ReadFile(filepath.Join(td, "a"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "abcd"))
+	info3 := newInfo("c")
+	ts3, err := s.OpenTorrent(context.Background(), info3, metainfo.Hash{3})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(ts3.Piece(info3.Piece(0)).Completion().Complete))
+	b, err = os.ReadFile(filepath.Join(td, "c"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "abcd"))
+}
@@ -38,6 +38,10 @@ type TorrentImpl struct {
 	// to determine the storage for torrents sharing the same function pointer, and mutated in
 	// place.
 	Capacity TorrentCapacity
+	// Optional. Called when a file is given PiecePriorityNone, or is given another priority, so
+	// storage can keep data for unwanted files out of the way. The index is into
+	// Info.UpvertedFiles.
+	SetFileWanted func(fileIndex int, wanted bool) error
 }
 
 // Interacts with torrent piece data. Optional interfaces to implement include:
@@ -0,0 +1,85 @@
+package torrent
+
+import (
+	"time"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+const (
+	// How long a piece read from storage for a peer is considered to remain in the storage cache.
+	hotPieceTimeout = 30 * time.Second
+	// Bounds the hot pieces tracked per torrent, which is roughly how much we expect to be cached.
+	maxHotPieces = 64
+)
+
+func (c *PeerConn) peerSentSuggest(piece pieceIndex) {
+	if c.t.haveInfo() && piece >= c.t.numPieces() {
+		// Suggestions are advisory, so ignore bad ones like BEP 6 says to for allowed fast.
+		torrent.Add("invalid suggests received", 1)
+		return
+	}
+	if c.peerSuggested.CheckedAdd(piece) {
+		c.updateRequests("suggested")
+	}
+}
+
+// Called when piece data has been read from storage to serve a request from a peer. If enabled,
+// other interested peers are told about the piece while it's likely to be cached.
+func (t *Torrent) onPeerRequestDataRead(piece pieceIndex, reader *PeerConn) {
+	if !t.cl.config.SuggestHotPieces {
+		return
+	}
+	now := time.Now()
+	if last, ok := t.hotPieces[piece]; ok && now.Sub(last) < hotPieceTimeout {
+		t.hotPieces[piece] = now
+		return
+	}
+	t.addHotPiece(piece, now)
+	for c := range t.conns {
+		if c == reader {
+			continue
+		}
+		c.maybeSuggest(piece)
+	}
+}
+
+func (t *Torrent) addHotPiece(piece pieceIndex, now time.Time) {
+	if t.hotPieces == nil {
+		t.hotPieces = make(map[pieceIndex]time.Time)
+	}
+	t.hotPieces[piece] = now
+	if len(t.hotPieces) <= maxHotPieces {
+		return
+	}
+	var oldest pieceIndex
+	var oldestTime time.Time
+	for i, when := range t.hotPieces {
+		if oldestTime.IsZero() || when.Before(oldestTime) {
+			oldest = i
+			oldestTime = when
+		}
+	}
+	delete(t.hotPieces, oldest)
+}
+
+func (c *PeerConn) maybeSuggest(piece pieceIndex) {
+	if !c.fastEnabled() || !c.peerInterested || c.peerHasPiece(piece) {
+		return
+	}
+	// Super-seeded peers are only shown pieces one at a time.
+	if c.superSeeding && !c.sentHaves.Get(bitmap.BitIndex(piece)) {
+		return
+	}
+	// Don't repeat ourselves. The peer can remember.
+	if !c.sentSuggests.CheckedAdd(piece) {
+		return
+	}
+	torrent.Add("suggests sent", 1)
+	c.write(pp.Message{
+		Type:  pp.Suggest,
+		Index: pp.Integer(piece),
+	})
+}
@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestSuggestHotPieces(t *testing.T) {
+	cl := newTestingClient(t)
+	cl.config.SuggestHotPieces = true
+	tor := cl.newTorrentForTesting()
+	newConn := func() *PeerConn {
+		pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+		pc.setTorrent(tor)
+		pc.PeerExtensionBytes.SetBit(pp.ExtensionBitFast, true)
+		pc.peerInterested = true
+		pc.initMessageWriter()
+		tor.conns[pc] = struct{}{}
+		return pc
+	}
+	reader := newConn()
+	other := newConn()
+	tor.onPeerRequestDataRead(3, reader)
+	qt.Check(t, qt.Equals(reader.messageWriter.writeBuffer.Len(), 0))
+	// Length prefix, type and index.
+	qt.Check(t, qt.Equals(other.messageWriter.writeBuffer.Len(), 9))
+	qt.Check(t, qt.IsTrue(other.sentSuggests.Contains(3)))
+	// Still hot, so nothing more is sent.
+	tor.onPeerRequestDataRead(3, other)
+	qt.Check(t, qt.Equals(reader.messageWriter.writeBuffer.Len(), 0))
+	for i := range maxHotPieces + 1 {
+		tor.addHotPiece(pieceIndex(i+10), tor.hotPieces[3].Add(1))
+	}
+	qt.Check(t, qt.HasLen(tor.hotPieces, maxHotPieces))
+	qt.Check(t, qt.IsFalse(func() bool { _, ok := tor.hotPieces[3]; return ok }()))
+
+	// Super-seeded peers aren't told about pieces that haven't been revealed to them.
+	superSeeded := newConn()
+	superSeeded.superSeeding = true
+	superSeeded.maybeSuggest(4)
+	qt.Check(t, qt.Equals(superSeeded.messageWriter.writeBuffer.Len(), 0))
+	superSeeded.sentHaves.Add(4)
+	superSeeded.maybeSuggest(4)
+	qt.Check(t, qt.IsTrue(superSeeded.sentSuggests.Contains(4)))
+}
+
+func TestPeerSentSuggest(t *testing.T) {
+	cl := newTestingClient(t)
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	pc.setTorrent(cl.newTorrentForTesting())
+	pc.peerSentSuggest(2)
+	qt.Check(t, qt.IsTrue(pc.peerSuggested.Contains(2)))
+	qt.Check(t, qt.Not(qt.Equals(pc.needRequestUpdate, "")))
+}
@@ -0,0 +1,105 @@
+package torrent
+
+import (
+	"github.com/anacrolix/missinggo/v2/bitmap"
+	"github.com/anacrolix/multiless"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// Enables BEP 16 super-seeding, which is intended for initial seeders. Peers that connect while
+// it's enabled are told we have no pieces, and are then shown pieces one at a time, rarest first.
+// Another piece is revealed to a peer once the last is seen announced by a different peer, so that
+// our upload isn't spent on duplicates. It only applies to peers connecting while we have all the
+// pieces. Disabling it reveals all pieces to peers that were being super-seeded.
+func (t *Torrent) SetSuperSeeding(on bool) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.superSeeding = on
+	if on {
+		return
+	}
+	for c := range t.conns {
+		c.stopSuperSeeding()
+	}
+}
+
+func (t *Torrent) superSeedingActive() bool {
+	return t.superSeeding && t.haveInfo() && t.haveAllPieces()
+}
+
+// Picks the next piece to reveal to a super-seeded peer. Pieces being revealed to the fewest other
+// peers are preferred, and then the rarest.
+func (t *Torrent) superSeedPieceFor(c *PeerConn) (ret pieceIndex, ok bool) {
+	revealing := make(map[pieceIndex]int)
+	for o := range t.conns {
+		if o.superSeedRevealed.Ok {
+			revealing[o.superSeedRevealed.Value]++
+		}
+	}
+	for i := range t.numPieces() {
+		if c.sentHaves.Get(bitmap.BitIndex(i)) || c.peerHasPiece(i) {
+			continue
+		}
+		if ok && !multiless.New().Int(
+			revealing[i], revealing[ret],
+		).Int(
+			t.piece(i).availability(), t.piece(ret).availability(),
+		).Less() {
+			continue
+		}
+		ret, ok = i, true
+	}
+	return
+}
+
+// Another peer announced the piece, so peers we revealed it to have passed it on and can be shown
+// another.
+func (t *Torrent) superSeedPieceSpread(from *PeerConn, piece pieceIndex) {
+	for c := range t.conns {
+		if c == from || !c.superSeedRevealed.Ok || c.superSeedRevealed.Value != piece {
+			continue
+		}
+		c.superSeedRevealNext()
+	}
+}
+
+// Used in place of the bitfield in the initial messages.
+func (c *PeerConn) startSuperSeeding() {
+	c.superSeeding = true
+	if c.fastEnabled() {
+		c.write(pp.Message{Type: pp.HaveNone})
+	}
+	c.superSeedRevealNext()
+}
+
+func (c *PeerConn) superSeedRevealNext() {
+	i, ok := c.t.superSeedPieceFor(c)
+	if !ok {
+		c.superSeedRevealed.SetNone()
+		return
+	}
+	torrent.Add("super-seeding pieces revealed", 1)
+	c.superSeedRevealed.Set(i)
+	c.have(i)
+}
+
+// The peer told us what it has after we picked a piece to reveal, and it turns out it doesn't need
+// it.
+func (c *PeerConn) superSeedCheckRevealed() {
+	if c.superSeeding && c.superSeedRevealed.Ok && c.peerHasPiece(c.superSeedRevealed.Value) {
+		c.superSeedRevealNext()
+	}
+}
+
+func (c *PeerConn) stopSuperSeeding() {
+	if !c.superSeeding {
+		return
+	}
+	c.superSeeding = false
+	c.superSeedRevealed.SetNone()
+	c.t._completedPieces.Iterate(func(x uint32) bool {
+		c.have(pieceIndex(x))
+		return true
+	})
+}
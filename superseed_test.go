@@ -0,0 +1,67 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestSuperSeeding(t *testing.T) {
+	cl := newTestingClient(t)
+	tor := cl.newTorrentForTesting()
+	qt.Assert(t, qt.IsNil(tor.setInfo(&metainfo.Info{
+		Name:        "test",
+		PieceLength: 1,
+		Length:      3,
+		Pieces:      make([]byte, metainfo.HashSize*3),
+	})))
+	tor.onSetInfo()
+	tor._completedPieces.AddRange(0, 3)
+	tor.superSeeding = true
+	newConn := func() *PeerConn {
+		pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+		pc.setTorrent(tor)
+		pc.PeerExtensionBytes.SetBit(pp.ExtensionBitFast, true)
+		pc.initMessageWriter()
+		tor.conns[pc] = struct{}{}
+		qt.Assert(t, qt.IsTrue(tor.superSeedingActive()))
+		pc.startSuperSeeding()
+		return pc
+	}
+	a := newConn()
+	qt.Assert(t, qt.IsTrue(a.superSeedRevealed.Ok))
+	first := a.superSeedRevealed.Value
+	qt.Check(t, qt.Equals(a.sentHaves.Len(), 1))
+	b := newConn()
+	// Spread pieces out between peers.
+	qt.Assert(t, qt.IsTrue(b.superSeedRevealed.Ok))
+	qt.Check(t, qt.Not(qt.Equals(b.superSeedRevealed.Value, first)))
+	// A peer announcing the piece it was given doesn't earn it another.
+	qt.Assert(t, qt.IsNil(a.peerSentHave(first)))
+	qt.Check(t, qt.Equals(a.superSeedRevealed.Value, first))
+	// Once it's seen elsewhere, the next piece is revealed.
+	qt.Assert(t, qt.IsNil(b.peerSentHave(first)))
+	qt.Check(t, qt.Not(qt.Equals(a.superSeedRevealed.Value, first)))
+	qt.Check(t, qt.Equals(a.sentHaves.Len(), 2))
+	// Requests for hidden pieces are rejected.
+	var hidden pieceIndex
+	for i := range tor.numPieces() {
+		if !a.sentHaves.Get(bitmap.BitIndex(i)) {
+			hidden = i
+		}
+	}
+	a.peerRequests = nil
+	a.choking = false
+	qt.Check(t, qt.IsNil(a.onReadRequest(Request{Index: pp.Integer(hidden), ChunkSpec: ChunkSpec{Length: 1}}, false)))
+	qt.Check(t, qt.HasLen(a.peerRequests, 0))
+	// Revealed pieces are served.
+	qt.Check(t, qt.IsNil(a.onReadRequest(Request{Index: pp.Integer(first), ChunkSpec: ChunkSpec{Length: 1}}, false)))
+	qt.Check(t, qt.HasLen(a.peerRequests, 1))
+	tor.SetSuperSeeding(false)
+	qt.Check(t, qt.Equals(a.sentHaves.Len(), 3))
+	qt.Check(t, qt.IsFalse(a.superSeeding))
+}
@@ -35,8 +35,10 @@ import (
 	"github.com/anacrolix/sync"
 	"github.com/pion/webrtc/v4"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 
 	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/httpseed"
 	"github.com/anacrolix/torrent/internal/check"
 	"github.com/anacrolix/torrent/internal/nestedmaps"
 	"github.com/anacrolix/torrent/merkle"
@@ -70,6 +72,13 @@ type Torrent struct {
 	dataDownloadDisallowed chansync.Flag
 	dataUploadDisallowed   bool
 	userOnWriteChunkErr    func(error)
+	// See Torrent.SetSuperSeeding.
+	superSeeding bool
+	// Pieces recently read from storage for peers, and when. See Torrent.onPeerRequestDataRead.
+	hotPieces map[pieceIndex]time.Time
+	// Applied in addition to the Client limiters. Unlimited by default.
+	uploadRateLimiter   *rate.Limiter
+	downloadRateLimiter *rate.Limiter
 
 	closed  chansync.SetOnce
 	onClose []func()
@@ -93,10 +102,16 @@ type Torrent struct {
 
 	// The storage to open when the info dict becomes available.
 	storageOpener *storage.Client
+	// The file storage directory, if the storage is known to be one. See Torrent.ResumeData.
+	dataDir string
 	// Storage for torrent data.
 	storage *storage.Torrent
 	// Read-locked for using storage, and write-locked for Closing.
 	storageLock sync.RWMutex
+	// Read-locked for reading and writing chunks, and write-locked while storage is moved.
+	storageIoLock sync.RWMutex
+	// Set while storage is being moved. Pieces aren't hashed until it's done.
+	storageMoving bool
 
 	// TODO: Only announce stuff is used?
 	metainfo metainfo.MetaInfo
@@ -108,6 +123,10 @@ type Torrent struct {
 	_chunksPerRegularPiece chunkIndexType
 
 	webSeeds map[string]*Peer
+
+	// BEP 17 HTTP seeds, by URL.
+	httpSeeds map[string]*Peer
+
 	// Active peer connections, running message stream loops. TODO: Make this
 	// open (not-closed) connections only.
 	conns               map[*PeerConn]struct{}
@@ -196,6 +215,16 @@ func (t *Torrent) length() int64 {
 	return t._length.Value
 }
 
+// The offset after the last byte of torrent data. When files are piece aligned, this includes the
+// implicit padding between files, and so can exceed the length.
+func (t *Torrent) endOffset() int64 {
+	if !t.info.FilesArePieceAligned() || t.numPieces() == 0 {
+		return t.length()
+	}
+	lastPiece := t.numPieces() - 1
+	return int64(lastPiece)*t.info.PieceLength + int64(t.pieceLength(lastPiece))
+}
+
 func (t *Torrent) selectivePieceAvailabilityFromPeers(i pieceIndex) (count int) {
 	// This could be done with roaring.BitSliceIndexing.
 	t.iterPeers(func(peer *Peer) {
@@ -570,6 +599,11 @@ func (t *Torrent) onSetInfo() {
 		p.onGotInfo(t.info)
 		p.updateRequests("onSetInfo")
 	})
+	// Now that it's known whether the torrent is private.
+	t.cl.lsdAnnounceTorrent(t)
+	if dir := t.cl.config.CompleteDataDir; dir != "" && t.dataDir != "" && t.dataDir == t.cl.config.DataDir {
+		go t.moveToDataDirWhenComplete(dir)
+	}
 }
 
 // Checks the info bytes hash to expected values. Fills in any missing infohashes.
@@ -902,6 +936,11 @@ func (t *Torrent) writeStatus(w io.Writer) {
 	fmt.Fprintf(w, "webseeds:\n")
 	t.writePeerStatuses(w, maps.Values(t.webSeeds))
 
+	if len(t.httpSeeds) != 0 {
+		fmt.Fprintf(w, "httpseeds:\n")
+		t.writePeerStatuses(w, maps.Values(t.httpSeeds))
+	}
+
 	// Peers without priorities first, then those with. I'm undecided about how to order peers
 	// without priorities.
 	peerConns := slices.SortedFunc(maps.Keys(t.conns), func(l, r *PeerConn) int {
@@ -962,6 +1001,7 @@ func (t *Torrent) newMetaInfo() metainfo.MetaInfo {
 			}
 			return ret
 		}(),
+		HttpSeeds:   slices.Collect(maps.Keys(t.httpSeeds)),
 		PieceLayers: t.pieceLayers(),
 	}
 }
@@ -1071,16 +1111,35 @@ func (t *Torrent) assertAllPiecesRelativeAvailabilityZero() {
 }
 
 func (t *Torrent) requestOffset(r Request) int64 {
-	return torrentRequestOffset(t.length(), int64(t.usualPieceSize()), r)
+	return torrentRequestOffset(t.endOffset(), int64(t.usualPieceSize()), r)
 }
 
 // Return the request that would include the given offset into the torrent data. Returns !ok if
 // there is no such request.
 func (t *Torrent) offsetRequest(off int64) (req Request, ok bool) {
-	return torrentOffsetRequest(t.length(), t.info.PieceLength, int64(t.chunkSize), off)
+	return torrentOffsetRequest(t.endOffset(), t.info.PieceLength, int64(t.chunkSize), off)
+}
+
+// Tells storage whether the file is wanted, if it cares.
+func (t *Torrent) setStorageFileWanted(f *File, wanted bool) {
+	t.storageIoLock.RLock()
+	defer t.storageIoLock.RUnlock()
+	if t.storage == nil {
+		return
+	}
+	ts := t.storage.TorrentImpl
+	if ts.SetFileWanted == nil {
+		return
+	}
+	err := ts.SetFileWanted(slices.Index(t.Files(), f), wanted)
+	if err != nil {
+		t.logger.Levelf(log.Warning, "setting file %q wanted in storage: %v", f, err)
+	}
 }
 
 func (t *Torrent) writeChunk(piece int, begin int64, data []byte) (err error) {
+	t.storageIoLock.RLock()
+	defer t.storageIoLock.RUnlock()
 	n, err := t.pieces[piece].Storage().WriteAt(data, begin)
 	if err == nil && n != len(data) {
 		err = io.ErrShortWrite
@@ -1539,7 +1598,7 @@ func (t *Torrent) logPieceRequestOrder() {
 
 // Returns the range of pieces [begin, end) that contains the extent of bytes.
 func (t *Torrent) byteRegionPieces(off, size int64) (begin, end pieceIndex) {
-	if off >= t.length() {
+	if off >= t.endOffset() {
 		return
 	}
 	if off < 0 {
@@ -1684,7 +1743,9 @@ func (t *Torrent) readAt(b []byte, off int64) (n int, err error) {
 		p := &t.pieces[off/t.info.PieceLength]
 		p.waitNoPendingWrites()
 		var n1 int
+		t.storageIoLock.RLock()
 		n1, err = p.Storage().ReadAt(b, off-p.Info().Offset())
+		t.storageIoLock.RUnlock()
 		if n1 == 0 {
 			break
 		}
@@ -2029,7 +2090,8 @@ func (t *Torrent) startScrapingTrackerWithInfohash(u *url.URL, urlStr string, sh
 	sl := func() torrentTrackerAnnouncer {
 		switch u.Scheme {
 		case "ws", "wss":
-			if t.cl.config.DisableWebtorrent {
+			// WebRTC connects to peers directly.
+			if t.cl.config.DisableWebtorrent || t.cl.config.Proxy != nil {
 				return nil
 			}
 			return t.startWebsocketAnnouncer(*u, shortInfohash)
@@ -2607,7 +2669,7 @@ func (t *Torrent) tryCreateMorePieceHashers() error {
 }
 
 func (t *Torrent) tryCreatePieceHasher() bool {
-	if t.storage == nil {
+	if t.storage == nil || t.storageMoving {
 		return false
 	}
 	pi, ok := t.getPieceToHash()
@@ -2689,6 +2751,10 @@ func (t *Torrent) pieceHasher(index pieceIndex) {
 	t.pieceHashed(index, correct, copyErr)
 	t.updatePiecePriority(index, "Torrent.pieceHasher")
 	t.activePieceHashes--
+	if t.activePieceHashes == 0 {
+		// MoveStorage waits for hashing to finish.
+		t.cl.event.Broadcast()
+	}
 	t.tryCreateMorePieceHashers()
 }
 
@@ -2892,6 +2958,18 @@ func (t *Torrent) AllowDataDownload() {
 	})
 }
 
+// Whether data download has been disallowed with DisallowDataDownload, or due to a storage error.
+func (t *Torrent) DataDownloadDisallowed() bool {
+	return t.dataDownloadDisallowed.Bool()
+}
+
+// Whether data upload has been disallowed with DisallowDataUpload.
+func (t *Torrent) DataUploadDisallowed() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.dataUploadDisallowed
+}
+
 // Enables uploading data, if it was disabled.
 func (t *Torrent) AllowDataUpload() {
 	t.cl.lock()
@@ -2928,6 +3006,9 @@ func (t *Torrent) iterPeers(f func(p *Peer)) {
 	for _, ws := range t.webSeeds {
 		f(ws)
 	}
+	for _, hs := range t.httpSeeds {
+		f(hs)
+	}
 }
 
 func (t *Torrent) callbacks() *Callbacks {
@@ -2988,7 +3069,9 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) bool {
 			MaxRequests: defaultMaxRequests,
 			ResponseBodyWrapper: func(r io.Reader) io.Reader {
 				return &rateLimitedReader{
-					l: t.cl.config.DownloadRateLimiter,
+					limiters: func() rateLimiters {
+						return rateLimiters{t.cl.config.DownloadRateLimiter, t.downloadRateLimiter}
+					},
 					r: r,
 				}
 			},
@@ -2998,17 +3081,13 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) bool {
 	for _, opt := range opts {
 		opt(&ws.client)
 	}
-	g.MakeMapWithCap(&ws.activeRequests, ws.client.MaxRequests)
 	// This should affect how often we have to recompute requests for this peer. Note that
 	// because we can request more than 1 thing at a time over HTTP, we will hit the low
 	// requests mark more often, so recomputation is probably sooner than with regular peer
 	// conns. ~4x maxRequests would be about right.
 	ws.peer.PeerMaxRequests = 4 * ws.client.MaxRequests
 	ws.peer.initUpdateRequestsTimer()
-	ws.requesterCond.L = t.cl.locker()
-	for i := 0; i < ws.client.MaxRequests; i += 1 {
-		go ws.requester(i)
-	}
+	ws.httpRequester.init(&ws.peer, &ws, ws.client.MaxRequests)
 	for _, f := range t.callbacks().NewPeer {
 		f(&ws.peer)
 	}
@@ -3024,6 +3103,71 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) bool {
 	return true
 }
 
+// Adds BEP 17 HTTP seeds. See also AddWebSeeds.
+func (t *Torrent) AddHttpSeeds(urls []string) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	for _, u := range urls {
+		t.addHttpSeed(u)
+	}
+}
+
+// Returns true if the HTTP seed was newly added.
+func (t *Torrent) addHttpSeed(url string) bool {
+	if t.cl.config.DisableWebseeds {
+		return false
+	}
+	if _, ok := t.httpSeeds[url]; ok {
+		return false
+	}
+	if !t.infoHash.Ok {
+		// BEP 17 requests are by v1 infohash.
+		t.logger.Levelf(log.Debug, "ignoring http seed %q for torrent without v1 infohash", url)
+		return false
+	}
+	// The same as for webseeds. Each request is for at most a piece.
+	const maxRequests = 16
+	hs := httpSeedPeer{
+		peer: Peer{
+			t:                        t,
+			outgoing:                 true,
+			Network:                  "http",
+			reconciledHandshakeStats: true,
+			RemoteAddr:               remoteAddrFromUrl(url),
+			callbacks:                t.callbacks(),
+		},
+		client: httpseed.Client{
+			HttpClient: t.cl.httpClient,
+			Url:        url,
+			InfoHash:   t.infoHash.Value,
+			ResponseBodyWrapper: func(r io.Reader) io.Reader {
+				return &rateLimitedReader{
+					limiters: func() rateLimiters {
+						return rateLimiters{t.cl.config.DownloadRateLimiter, t.downloadRateLimiter}
+					},
+					r: r,
+				}
+			},
+		},
+	}
+	hs.peer.initRequestState()
+	hs.peer.PeerMaxRequests = 4 * maxRequests
+	hs.peer.initUpdateRequestsTimer()
+	hs.httpRequester.init(&hs.peer, &hs, maxRequests)
+	for _, f := range t.callbacks().NewPeer {
+		f(&hs.peer)
+	}
+	hs.peer.logger = t.logger.WithContextValue(&hs).WithNames("httpseed")
+	hs.peer.legacyPeerImpl = &hs
+	hs.peer.peerImpl = &hs
+	if t.haveInfo() {
+		hs.onGotInfo(t.info)
+	}
+	t.httpSeeds[url] = &hs.peer
+	hs.peer.updateRequests("Torrent.addHttpSeed")
+	return true
+}
+
 func (t *Torrent) peerIsActive(p *Peer) (active bool) {
 	t.iterPeers(func(p1 *Peer) {
 		if p1 == p {
@@ -3085,7 +3229,7 @@ func (t *Torrent) deleteConnWithAllPieces(p *Peer) bool {
 }
 
 func (t *Torrent) numActivePeers() int {
-	return len(t.conns) + len(t.webSeeds)
+	return len(t.conns) + len(t.webSeeds) + len(t.httpSeeds)
 }
 
 // Specifically, whether we can expect data to vanish while trying to read.
@@ -0,0 +1,52 @@
+package httpTrackerServer
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/bencode"
+	trackerServer "github.com/anacrolix/torrent/tracker/server"
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+// ScrapeHandler serves BEP 48 scrapes. It's conventionally mounted at the path of the announce
+// Handler with "announce" replaced by "scrape".
+type ScrapeHandler struct {
+	AnnounceTracker trackerServer.AnnounceTracker
+}
+
+type scrapeResponse struct {
+	Files map[string]udp.ScrapeInfohashResult `bencode:"files"`
+}
+
+func (me ScrapeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	strs := r.URL.Query()["info_hash"]
+	ihs := make([]trackerServer.InfoHash, 0, len(strs))
+	for _, str := range strs {
+		var ih trackerServer.InfoHash
+		if len(str) != len(ih) {
+			http.Error(w, fmt.Sprintf("info_hash %q has wrong length", str), http.StatusBadRequest)
+			return
+		}
+		copy(ih[:], str)
+		ihs = append(ihs, ih)
+	}
+	results, err := me.AnnounceTracker.Scrape(r.Context(), ihs)
+	if err != nil {
+		log.Printf("error scraping: %v", err)
+		http.Error(w, "error handling scrape", http.StatusInternalServerError)
+		return
+	}
+	resp := scrapeResponse{
+		Files: make(map[string]udp.ScrapeInfohashResult, len(results)),
+	}
+	for i, res := range results {
+		resp.Files[string(ihs[i][:])] = res
+	}
+	err = bencode.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Printf("error encoding and writing response body: %v", err)
+	}
+}
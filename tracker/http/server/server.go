@@ -94,13 +94,18 @@ func (me Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			MaxCount: generics.Some[uint](200),
 		},
 	)
+	var resp httpTracker.HttpResponse
 	err = res.Err
 	if err != nil {
 		log.Printf("error serving announce: %v", err)
-		http.Error(w, "error handling announce", http.StatusInternalServerError)
+		// BEP 3 failure reasons are for the announcer. Errors can be internal, so don't pass them on.
+		resp.FailureReason = "error handling announce"
+		err = bencode.NewEncoder(w).Encode(resp)
+		if err != nil {
+			log.Printf("error encoding and writing response body: %v", err)
+		}
 		return
 	}
-	var resp httpTracker.HttpResponse
 	resp.Incomplete = res.Leechers.Value
 	resp.Complete = res.Seeders.Value
 	resp.Interval = res.Interval.UnwrapOr(5 * 60)
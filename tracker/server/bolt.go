@@ -0,0 +1,177 @@
+//go:build !noboltdb && !wasm
+// +build !noboltdb,!wasm
+
+package trackerServer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	swarmsBucketKey    = []byte("swarms")
+	peersBucketKey     = []byte("peers")
+	completedRecordKey = []byte("completed")
+)
+
+// A SwarmStore backed by a bolt database. Each swarm is a bucket keyed by info-hash, containing the
+// completed count and a bucket of peers keyed by their binary AnnounceAddr.
+type BoltSwarmStore struct {
+	db *bbolt.DB
+}
+
+var _ SwarmStore = (*BoltSwarmStore)(nil)
+
+func NewBoltSwarmStore(path string) (_ *BoltSwarmStore, err error) {
+	db, err := bbolt.Open(path, 0o660, &bbolt.Options{
+		Timeout: time.Second,
+	})
+	if err != nil {
+		return
+	}
+	// Losing the last few announces in a crash isn't a big deal, peers will reannounce.
+	db.NoSync = true
+	return &BoltSwarmStore{db}, nil
+}
+
+func (me *BoltSwarmStore) Close() error {
+	return me.db.Close()
+}
+
+// peerId, left, last announce unix nanos.
+const boltPeerRecordLen = 20 + 8 + 8
+
+func marshalBoltPeerRecord(rec PeerRecord) []byte {
+	b := make([]byte, boltPeerRecordLen)
+	copy(b, rec.PeerId[:])
+	binary.BigEndian.PutUint64(b[20:], uint64(rec.Left))
+	binary.BigEndian.PutUint64(b[28:], uint64(rec.LastAnnounce.UnixNano()))
+	return b
+}
+
+func unmarshalBoltPeerRecord(b []byte) (rec PeerRecord, err error) {
+	if len(b) != boltPeerRecordLen {
+		err = fmt.Errorf("peer record has unexpected length %v", len(b))
+		return
+	}
+	copy(rec.PeerId[:], b)
+	rec.Left = int64(binary.BigEndian.Uint64(b[20:]))
+	rec.LastAnnounce = time.Unix(0, int64(binary.BigEndian.Uint64(b[28:])))
+	return
+}
+
+func (me *BoltSwarmStore) Load() (ret map[InfoHash]SwarmRecord, err error) {
+	ret = make(map[InfoHash]SwarmRecord)
+	err = me.db.View(func(tx *bbolt.Tx) error {
+		swarms := tx.Bucket(swarmsBucketKey)
+		if swarms == nil {
+			return nil
+		}
+		return swarms.ForEach(func(k, v []byte) error {
+			var ih InfoHash
+			if v != nil || len(k) != len(ih) {
+				return fmt.Errorf("unexpected swarm key %x", k)
+			}
+			copy(ih[:], k)
+			swarmBucket := swarms.Bucket(k)
+			swarm := SwarmRecord{
+				Peers: make(map[AnnounceAddr]PeerRecord),
+			}
+			if b := swarmBucket.Get(completedRecordKey); len(b) == 4 {
+				swarm.Completed = int32(binary.BigEndian.Uint32(b))
+			}
+			if peers := swarmBucket.Bucket(peersBucketKey); peers != nil {
+				err := peers.ForEach(func(k, v []byte) error {
+					var addr AnnounceAddr
+					err := addr.UnmarshalBinary(k)
+					if err != nil {
+						return fmt.Errorf("unmarshalling peer addr: %w", err)
+					}
+					rec, err := unmarshalBoltPeerRecord(v)
+					if err != nil {
+						return err
+					}
+					swarm.Peers[addr] = rec
+					return nil
+				})
+				if err != nil {
+					return fmt.Errorf("loading swarm %x: %w", ih, err)
+				}
+			}
+			ret[ih] = swarm
+			return nil
+		})
+	})
+	return
+}
+
+func (me *BoltSwarmStore) swarmBucket(tx *bbolt.Tx, infoHash InfoHash) (*bbolt.Bucket, error) {
+	swarms, err := tx.CreateBucketIfNotExists(swarmsBucketKey)
+	if err != nil {
+		return nil, err
+	}
+	return swarms.CreateBucketIfNotExists(infoHash[:])
+}
+
+func (me *BoltSwarmStore) PutPeer(infoHash InfoHash, addr AnnounceAddr, rec PeerRecord) error {
+	key, err := addr.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return me.db.Update(func(tx *bbolt.Tx) error {
+		swarm, err := me.swarmBucket(tx, infoHash)
+		if err != nil {
+			return err
+		}
+		peers, err := swarm.CreateBucketIfNotExists(peersBucketKey)
+		if err != nil {
+			return err
+		}
+		return peers.Put(key, marshalBoltPeerRecord(rec))
+	})
+}
+
+func (me *BoltSwarmStore) DeletePeer(infoHash InfoHash, addr AnnounceAddr) error {
+	key, err := addr.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return me.db.Update(func(tx *bbolt.Tx) error {
+		swarms := tx.Bucket(swarmsBucketKey)
+		if swarms == nil {
+			return nil
+		}
+		swarm := swarms.Bucket(infoHash[:])
+		if swarm == nil {
+			return nil
+		}
+		peers := swarm.Bucket(peersBucketKey)
+		if peers == nil {
+			return nil
+		}
+		err := peers.Delete(key)
+		if err != nil {
+			return err
+		}
+		// Drop swarms that have no peers left, like InMemory does.
+		if k, _ := peers.Cursor().First(); k == nil {
+			return swarms.DeleteBucket(infoHash[:])
+		}
+		return nil
+	})
+}
+
+func (me *BoltSwarmStore) SetCompleted(infoHash InfoHash, completed int32) error {
+	return me.db.Update(func(tx *bbolt.Tx) error {
+		swarm, err := me.swarmBucket(tx, infoHash)
+		if err != nil {
+			return err
+		}
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(completed))
+		return swarm.Put(completedRecordKey, b[:])
+	})
+}
@@ -0,0 +1,290 @@
+package trackerServer
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+// The interval handed out to announcers when InMemory.AnnounceInterval is zero.
+const DefaultAnnounceInterval = 5 * time.Minute
+
+// PeerRecord is what the tracker remembers about each announcing peer.
+type PeerRecord struct {
+	PeerId [20]byte
+	// Bytes left as reported by the peer. Negative if unknown, such as for peers learned from
+	// upstream trackers.
+	Left         int64
+	LastAnnounce time.Time
+}
+
+func (me PeerRecord) seeder() bool {
+	return me.Left == 0
+}
+
+// SwarmRecord is the state for a single info-hash.
+type SwarmRecord struct {
+	// Number of completed events seen. This is reported as "downloaded" in scrapes.
+	Completed int32
+	Peers     map[AnnounceAddr]PeerRecord
+}
+
+// SwarmStore persists swarm state for an InMemory tracker, so a restarted tracker doesn't lose its
+// swarms. Writes are made while the tracker holds its lock, so implementations should be quick.
+type SwarmStore interface {
+	Load() (map[InfoHash]SwarmRecord, error)
+	PutPeer(infoHash InfoHash, addr AnnounceAddr, rec PeerRecord) error
+	DeletePeer(infoHash InfoHash, addr AnnounceAddr) error
+	SetCompleted(infoHash InfoHash, completed int32) error
+}
+
+// InMemory is an AnnounceTracker that keeps swarms in memory. Peers are forgotten if they don't
+// reannounce in time, and swarms are dropped when they have no peers left. The zero value is ready
+// to use. Set Store before first use to persist swarms.
+type InMemory struct {
+	// The interval returned to announcers.
+	AnnounceInterval time.Duration
+	// Peers that haven't announced for this long are dropped. Defaults to twice the announce
+	// interval.
+	PeerTimeout time.Duration
+	// Optional persistence for swarm state.
+	Store SwarmStore
+
+	mu        sync.Mutex
+	loaded    bool
+	swarms    map[InfoHash]*SwarmRecord
+	lastSweep time.Time
+	// For tests.
+	clock func() time.Time
+}
+
+var _ AnnounceTracker = (*InMemory)(nil)
+
+func (me *InMemory) now() time.Time {
+	if me.clock != nil {
+		return me.clock()
+	}
+	return time.Now()
+}
+
+func (me *InMemory) announceInterval() time.Duration {
+	if me.AnnounceInterval != 0 {
+		return me.AnnounceInterval
+	}
+	return DefaultAnnounceInterval
+}
+
+func (me *InMemory) peerTimeout() time.Duration {
+	if me.PeerTimeout != 0 {
+		return me.PeerTimeout
+	}
+	return 2 * me.announceInterval()
+}
+
+// Loads swarms from the Store if that hasn't been done yet. Must be called with the lock held.
+func (me *InMemory) lazyInit() error {
+	if me.loaded {
+		return nil
+	}
+	if me.Store != nil {
+		stored, err := me.Store.Load()
+		if err != nil {
+			return err
+		}
+		for ih, swarm := range stored {
+			generics.MakeMapIfNilAndSet(&me.swarms, ih, &swarm)
+		}
+	}
+	me.loaded = true
+	return nil
+}
+
+func (me *InMemory) expired(rec PeerRecord, now time.Time) bool {
+	return now.Sub(rec.LastAnnounce) > me.peerTimeout()
+}
+
+// Removes expired peers from a swarm, and the swarm itself if it's left empty. Must be called with
+// the lock held.
+func (me *InMemory) pruneSwarm(ih InfoHash, swarm *SwarmRecord, now time.Time) (err error) {
+	for addr, rec := range swarm.Peers {
+		if !me.expired(rec, now) {
+			continue
+		}
+		delete(swarm.Peers, addr)
+		if me.Store != nil {
+			err = me.Store.DeletePeer(ih, addr)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if len(swarm.Peers) == 0 {
+		delete(me.swarms, ih)
+	}
+	return
+}
+
+// Prunes every swarm at most once an announce interval, so swarms that are no longer queried don't
+// accumulate. Must be called with the lock held.
+func (me *InMemory) maybeSweep(now time.Time) error {
+	if now.Sub(me.lastSweep) < me.announceInterval() {
+		return nil
+	}
+	me.lastSweep = now
+	for ih, swarm := range me.swarms {
+		err := me.pruneSwarm(ih, swarm, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *InMemory) TrackAnnounce(ctx context.Context, req udp.AnnounceRequest, addr AnnounceAddr) (err error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	err = me.lazyInit()
+	if err != nil {
+		return
+	}
+	now := me.now()
+	err = me.maybeSweep(now)
+	if err != nil {
+		return
+	}
+	ih := InfoHash(req.InfoHash)
+	swarm := me.swarms[ih]
+	if req.Event == tracker.Stopped {
+		if swarm == nil {
+			return
+		}
+		delete(swarm.Peers, addr)
+		if len(swarm.Peers) == 0 {
+			delete(me.swarms, ih)
+		}
+		if me.Store != nil {
+			err = me.Store.DeletePeer(ih, addr)
+		}
+		return
+	}
+	if swarm == nil {
+		swarm = &SwarmRecord{}
+		generics.MakeMapIfNilAndSet(&me.swarms, ih, swarm)
+	}
+	rec := PeerRecord{
+		PeerId:       req.PeerId,
+		Left:         req.Left,
+		LastAnnounce: now,
+	}
+	if req.Event == tracker.Completed {
+		// Some clients send completed without left=0.
+		rec.Left = 0
+		swarm.Completed++
+		if me.Store != nil {
+			err = me.Store.SetCompleted(ih, swarm.Completed)
+			if err != nil {
+				return
+			}
+		}
+	}
+	generics.MakeMapIfNilAndSet(&swarm.Peers, addr, rec)
+	if me.Store != nil {
+		err = me.Store.PutPeer(ih, addr, rec)
+	}
+	return
+}
+
+// Returns seeder and leecher counts for a swarm. Must be called with the lock held.
+func swarmCounts(swarm *SwarmRecord) (seeders, leechers int32) {
+	if swarm == nil {
+		return
+	}
+	for _, rec := range swarm.Peers {
+		if rec.seeder() {
+			seeders++
+		} else {
+			leechers++
+		}
+	}
+	return
+}
+
+func (me *InMemory) Scrape(ctx context.Context, infoHashes []InfoHash) (ret []udp.ScrapeInfohashResult, err error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	err = me.lazyInit()
+	if err != nil {
+		return
+	}
+	now := me.now()
+	ret = make([]udp.ScrapeInfohashResult, 0, len(infoHashes))
+	for _, ih := range infoHashes {
+		var res udp.ScrapeInfohashResult
+		swarm := me.swarms[ih]
+		if swarm != nil {
+			res.Completed = swarm.Completed
+			err = me.pruneSwarm(ih, swarm, now)
+			if err != nil {
+				return
+			}
+			res.Seeders, res.Leechers = swarmCounts(swarm)
+		}
+		ret = append(ret, res)
+	}
+	return
+}
+
+func (me *InMemory) GetPeers(
+	ctx context.Context,
+	infoHash InfoHash,
+	opts GetPeersOpts,
+	remote AnnounceAddr,
+) (ret ServerAnnounceResult) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	ret.Err = me.lazyInit()
+	if ret.Err != nil {
+		return
+	}
+	ret.Interval = generics.Some(int32(me.announceInterval() / time.Second))
+	swarm := me.swarms[infoHash]
+	if swarm != nil {
+		ret.Err = me.pruneSwarm(infoHash, swarm, me.now())
+		if ret.Err != nil {
+			return
+		}
+	}
+	seeders, leechers := swarmCounts(swarm)
+	ret.Seeders = generics.Some(seeders)
+	ret.Leechers = generics.Some(leechers)
+	if swarm == nil {
+		return
+	}
+	// Seeders have no use for other seeders.
+	remoteRec, remoteKnown := swarm.Peers[remote]
+	remoteSeeding := remoteKnown && remoteRec.seeder()
+	candidates := make([]PeerInfo, 0, len(swarm.Peers))
+	for addr, rec := range swarm.Peers {
+		if addr == remote {
+			continue
+		}
+		if remoteSeeding && rec.seeder() {
+			continue
+		}
+		candidates = append(candidates, PeerInfo{addr})
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if opts.MaxCount.Ok && uint(len(candidates)) > opts.MaxCount.Value {
+		candidates = candidates[:opts.MaxCount.Value]
+	}
+	ret.Peers = candidates
+	return
+}
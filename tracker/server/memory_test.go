@@ -0,0 +1,93 @@
+package trackerServer
+
+import (
+	"context"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/generics"
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func testAnnounce(t *testing.T, me AnnounceTracker, ih InfoHash, addr string, left int64, event tracker.AnnounceEvent) {
+	err := me.TrackAnnounce(context.Background(), AnnounceRequest{
+		InfoHash: ih,
+		Left:     left,
+		Event:    event,
+	}, netip.MustParseAddrPort(addr))
+	qt.Assert(t, qt.IsNil(err))
+}
+
+func TestInMemorySeedersLeechersAndExpiry(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	me := &InMemory{
+		AnnounceInterval: time.Minute,
+		clock:            func() time.Time { return now },
+	}
+	ih := InfoHash{1}
+	testAnnounce(t, me, ih, "1.2.3.4:1", 0, tracker.Started)
+	testAnnounce(t, me, ih, "1.2.3.4:2", 10, tracker.Started)
+	testAnnounce(t, me, ih, "1.2.3.4:3", 10, tracker.Started)
+	testAnnounce(t, me, ih, "1.2.3.4:3", 10, tracker.Completed)
+	ctx := context.Background()
+	res, err := me.Scrape(ctx, []InfoHash{ih, {2}})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(res[0].Seeders, 2))
+	qt.Check(t, qt.Equals(res[0].Leechers, 1))
+	qt.Check(t, qt.Equals(res[0].Completed, 1))
+	qt.Check(t, qt.Equals(res[1].Seeders, 0))
+
+	// The leecher gets both seeders but not itself.
+	leecher := netip.MustParseAddrPort("1.2.3.4:2")
+	peers := me.GetPeers(ctx, ih, GetPeersOpts{}, leecher)
+	qt.Assert(t, qt.IsNil(peers.Err))
+	qt.Check(t, qt.HasLen(peers.Peers, 2))
+	qt.Check(t, qt.Equals(peers.Interval.Value, 60))
+	// A seeder only gets the leecher.
+	peers = me.GetPeers(ctx, ih, GetPeersOpts{}, netip.MustParseAddrPort("1.2.3.4:1"))
+	qt.Check(t, qt.SliceContains(peers.Peers, PeerInfo{leecher}))
+	qt.Check(t, qt.HasLen(peers.Peers, 1))
+	peers = me.GetPeers(ctx, ih, GetPeersOpts{MaxCount: generics.Some[uint](1)}, netip.AddrPort{})
+	qt.Check(t, qt.HasLen(peers.Peers, 1))
+
+	testAnnounce(t, me, ih, "1.2.3.4:1", 0, tracker.Stopped)
+	now = now.Add(time.Minute)
+	testAnnounce(t, me, ih, "1.2.3.4:2", 10, tracker.None)
+	now = now.Add(90 * time.Second)
+	peers = me.GetPeers(ctx, ih, GetPeersOpts{}, netip.AddrPort{})
+	qt.Check(t, qt.SliceContains(peers.Peers, PeerInfo{leecher}))
+	qt.Check(t, qt.HasLen(peers.Peers, 1))
+	qt.Check(t, qt.Equals(peers.Seeders.Value, 0))
+	now = now.Add(time.Minute)
+	peers = me.GetPeers(ctx, ih, GetPeersOpts{}, netip.AddrPort{})
+	qt.Check(t, qt.HasLen(peers.Peers, 0))
+	qt.Check(t, qt.HasLen(me.swarms, 0))
+}
+
+func TestInMemoryBoltPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	store, err := NewBoltSwarmStore(path)
+	qt.Assert(t, qt.IsNil(err))
+	me := &InMemory{Store: store}
+	ih := InfoHash{1}
+	testAnnounce(t, me, ih, "1.2.3.4:1", 0, tracker.Completed)
+	testAnnounce(t, me, ih, "[::1]:2", 10, tracker.Started)
+	testAnnounce(t, me, ih, "1.2.3.4:3", 10, tracker.Started)
+	testAnnounce(t, me, ih, "1.2.3.4:3", 10, tracker.Stopped)
+	testAnnounce(t, me, InfoHash{2}, "1.2.3.4:3", 10, tracker.Stopped)
+	qt.Assert(t, qt.IsNil(store.Close()))
+
+	store, err = NewBoltSwarmStore(path)
+	qt.Assert(t, qt.IsNil(err))
+	defer store.Close()
+	me = &InMemory{Store: store}
+	res, err := me.Scrape(context.Background(), []InfoHash{ih})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(res[0].Seeders, 1))
+	qt.Check(t, qt.Equals(res[0].Leechers, 1))
+	qt.Check(t, qt.Equals(res[0].Completed, 1))
+}
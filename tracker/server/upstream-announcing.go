@@ -2,7 +2,10 @@ package trackerServer
 
 import (
 	"context"
+	"sync"
 	"time"
+
+	"github.com/anacrolix/generics"
 )
 
 type UpstreamAnnounceGater interface {
@@ -16,3 +19,51 @@ type UpstreamAnnounceGater interface {
 		interval int32,
 	) error
 }
+
+// InMemoryUpstreamAnnounceGate is an UpstreamAnnounceGater that blocks repeat announces in memory.
+// The zero value is ready to use.
+type InMemoryUpstreamAnnounceGate struct {
+	mu       sync.Mutex
+	blockers map[upstreamAnnounceKey]time.Time
+}
+
+type upstreamAnnounceKey struct {
+	tracker  string
+	infoHash InfoHash
+}
+
+var _ UpstreamAnnounceGater = (*InMemoryUpstreamAnnounceGate)(nil)
+
+// Sets the time until which announces are blocked, and drops any expired blocks. Must be called
+// with the lock held.
+func (me *InMemoryUpstreamAnnounceGate) block(key upstreamAnnounceKey, until time.Time) {
+	now := time.Now()
+	for k, t := range me.blockers {
+		if !t.After(now) {
+			delete(me.blockers, k)
+		}
+	}
+	generics.MakeMapIfNilAndSet(&me.blockers, key, until)
+}
+
+func (me *InMemoryUpstreamAnnounceGate) Start(
+	ctx context.Context, tracker string, infoHash InfoHash, timeout time.Duration,
+) (bool, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	key := upstreamAnnounceKey{tracker, infoHash}
+	if me.blockers[key].After(time.Now()) {
+		return false, nil
+	}
+	me.block(key, time.Now().Add(timeout))
+	return true, nil
+}
+
+func (me *InMemoryUpstreamAnnounceGate) Completed(
+	ctx context.Context, tracker string, infoHash InfoHash, interval int32,
+) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.block(upstreamAnnounceKey{tracker, infoHash}, time.Now().Add(time.Duration(interval)*time.Second))
+	return nil
+}
@@ -0,0 +1,62 @@
+package udpTrackerServer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+// BEP 15 says connection IDs may be used by clients for a minute, and accepted by servers for two.
+const DefaultConnectionIdLifetime = 2 * time.Minute
+
+// InMemoryConnectionTracker is a ConnectionTracker that remembers issued connection IDs in memory.
+// The zero value is ready to use.
+type InMemoryConnectionTracker struct {
+	// How long an issued connection ID remains valid. Defaults to DefaultConnectionIdLifetime.
+	Lifetime time.Duration
+
+	mu        sync.Mutex
+	issued    map[inMemoryConnKey]time.Time
+	lastSweep time.Time
+}
+
+type inMemoryConnKey struct {
+	addr ConnectionTrackerAddr
+	id   udp.ConnectionId
+}
+
+var _ ConnectionTracker = (*InMemoryConnectionTracker)(nil)
+
+func (me *InMemoryConnectionTracker) lifetime() time.Duration {
+	if me.Lifetime != 0 {
+		return me.Lifetime
+	}
+	return DefaultConnectionIdLifetime
+}
+
+func (me *InMemoryConnectionTracker) Add(ctx context.Context, addr ConnectionTrackerAddr, id udp.ConnectionId) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	now := time.Now()
+	if now.Sub(me.lastSweep) >= me.lifetime() {
+		for k, issued := range me.issued {
+			if now.Sub(issued) >= me.lifetime() {
+				delete(me.issued, k)
+			}
+		}
+		me.lastSweep = now
+	}
+	generics.MakeMapIfNilAndSet(&me.issued, inMemoryConnKey{addr, id}, now)
+	return nil
+}
+
+func (me *InMemoryConnectionTracker) Check(ctx context.Context, addr ConnectionTrackerAddr, id udp.ConnectionId) (bool, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	issued, ok := me.issued[inMemoryConnKey{addr, id}]
+	return ok && time.Since(issued) < me.lifetime(), nil
+}
@@ -70,6 +70,8 @@ func (me *Server) HandleRequest(
 		err = me.handleConnect(ctx, source, h.TransactionId)
 	case udp.ActionAnnounce:
 		err = me.handleAnnounce(ctx, family, source, h.ConnectionId, h.TransactionId, &r)
+	case udp.ActionScrape:
+		err = me.handleScrape(ctx, source, h.ConnectionId, h.TransactionId, &r)
 	default:
 		err = fmt.Errorf("unimplemented")
 	}
@@ -115,6 +117,9 @@ func (me *Server) handleAnnounce(
 	}
 	res := me.Announce.Serve(ctx, req, announceAddr, opts)
 	if res.Err != nil {
+		// Let the announcer know it's not getting peers. The error can be internal, so it's only
+		// returned to be logged.
+		me.sendError(ctx, source, tid, "error handling announce")
 		return res.Err
 	}
 	nodeAddrs := make([]krpc.NodeAddr, 0, len(res.Peers))
@@ -170,6 +175,76 @@ func (me *Server) handleAnnounce(
 	return err
 }
 
+func (me *Server) handleScrape(
+	ctx context.Context,
+	source RequestSourceAddr,
+	connId udp.ConnectionId,
+	tid udp.TransactionId,
+	r *bytes.Reader,
+) error {
+	ok, err := me.ConnTracker.Check(ctx, source.String(), connId)
+	if err != nil {
+		err = fmt.Errorf("checking conn id: %w", err)
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("incorrect connection id: %x", connId)
+	}
+	// BEP 15 limits a scrape to about 74 info-hashes, which is what fits in a response packet.
+	var ihs []InfoHash
+	for r.Len() >= len(InfoHash{}) && len(ihs) < maxScrapeInfoHashes {
+		var ih InfoHash
+		err = udp.Read(r, &ih)
+		if err != nil {
+			return err
+		}
+		ihs = append(ihs, ih)
+	}
+	results, err := me.Announce.AnnounceTracker.Scrape(ctx, ihs)
+	if err != nil {
+		me.sendError(ctx, source, tid, "error handling scrape")
+		return fmt.Errorf("scraping: %w", err)
+	}
+	var buf bytes.Buffer
+	err = udp.Write(&buf, udp.ResponseHeader{
+		Action:        udp.ActionScrape,
+		TransactionId: tid,
+	})
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		err = udp.Write(&buf, res)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := me.SendResponse(ctx, buf.Bytes(), source)
+	if err != nil {
+		return err
+	}
+	if n < buf.Len() {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+const maxScrapeInfoHashes = 74
+
+// Sends an error response. Failing to do so isn't worth reporting over the original error.
+func (me *Server) sendError(ctx context.Context, source RequestSourceAddr, tid udp.TransactionId, msg string) {
+	var buf bytes.Buffer
+	udp.Write(&buf, udp.ResponseHeader{
+		Action:        udp.ActionError,
+		TransactionId: tid,
+	})
+	buf.WriteString(msg)
+	_, err := me.SendResponse(ctx, buf.Bytes(), source)
+	if err != nil {
+		log.Levelf(log.Debug, "error sending error response to %v: %v", source, err)
+	}
+}
+
 func (me *Server) handleConnect(ctx context.Context, source RequestSourceAddr, tid udp.TransactionId) error {
 	connId := randomConnectionId()
 	err := me.ConnTracker.Add(ctx, source.String(), connId)
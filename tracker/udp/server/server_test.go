@@ -0,0 +1,95 @@
+package udpTrackerServer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	trackerServer "github.com/anacrolix/torrent/tracker/server"
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+func TestAnnounceAndScrape(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	defer pc.Close()
+	server := &Server{
+		ConnTracker: &InMemoryConnectionTracker{},
+		SendResponse: func(ctx context.Context, data []byte, addr net.Addr) (int, error) {
+			return pc.WriteTo(data, addr)
+		},
+		Announce: &trackerServer.AnnounceHandler{
+			AnnounceTracker: &trackerServer.InMemory{},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- RunSimple(ctx, server, pc, udp.AddrFamilyIpv4)
+	}()
+	cc, err := udp.NewConnClient(udp.NewConnClientOpts{
+		Network: "udp4",
+		Host:    pc.LocalAddr().String(),
+	})
+	qt.Assert(t, qt.IsNil(err))
+	defer cc.Close()
+	seeded := udp.InfoHash{1}
+	for i, left := range []int64{0, 0, 1} {
+		_, _, err = cc.Announce(ctx, udp.AnnounceRequest{
+			InfoHash: seeded,
+			Left:     left,
+			NumWant:  -1,
+			Port:     uint16(i + 1),
+		}, udp.Options{})
+		qt.Assert(t, qt.IsNil(err))
+	}
+	res, err := cc.Client.Scrape(ctx, []udp.InfoHash{seeded, {2}})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(res, udp.ScrapeResponse{
+		{Seeders: 2, Leechers: 1},
+		{},
+	}))
+	pc.Close()
+	qt.Check(t, qt.IsTrue(errors.Is(<-serveErr, net.ErrClosed)))
+}
+
+type failingScrapes struct {
+	trackerServer.InMemory
+}
+
+func (*failingScrapes) Scrape(context.Context, []udp.InfoHash) ([]udp.ScrapeInfohashResult, error) {
+	return nil, errors.New("opening /var/lib/tracker/peers.db: permission denied")
+}
+
+// Internal errors are logged, and not sent to the client.
+func TestScrapeErrorNotSent(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	defer pc.Close()
+	server := &Server{
+		ConnTracker: &InMemoryConnectionTracker{},
+		SendResponse: func(ctx context.Context, data []byte, addr net.Addr) (int, error) {
+			return pc.WriteTo(data, addr)
+		},
+		Announce: &trackerServer.AnnounceHandler{
+			AnnounceTracker: &failingScrapes{},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RunSimple(ctx, server, pc, udp.AddrFamilyIpv4)
+	cc, err := udp.NewConnClient(udp.NewConnClientOpts{
+		Network: "udp4",
+		Host:    pc.LocalAddr().String(),
+	})
+	qt.Assert(t, qt.IsNil(err))
+	defer cc.Close()
+	_, err = cc.Client.Scrape(ctx, []udp.InfoHash{{1}})
+	var errResp udp.ErrorResponse
+	qt.Assert(t, qt.ErrorAs(err, &errResp))
+	qt.Check(t, qt.Equals(errResp.Message, "error handling scrape"))
+}
@@ -151,10 +151,15 @@ func (me *trackerScraper) announce(
 		}
 	}()
 
-	ip, err := me.getIp()
-	if err != nil {
-		ret.Err = fmt.Errorf("error getting ip: %s", err)
-		return
+	trackerUrl := me.u.String()
+	// The proxy resolves the tracker's name otherwise.
+	if !me.t.cl.config.proxyAll() {
+		ip, err := me.getIp()
+		if err != nil {
+			ret.Err = fmt.Errorf("error getting ip: %s", err)
+			return
+		}
+		trackerUrl = me.trackerUrl(ip)
 	}
 	me.t.cl.rLock()
 	req := me.t.announceRequest(event, me.shortInfohash)
@@ -170,10 +175,10 @@ func (me *trackerScraper) announce(
 		Context:             ctx,
 		HttpProxy:           me.t.cl.config.HTTPProxy,
 		HttpRequestDirector: me.t.cl.config.HttpRequestDirector,
-		DialContext:         me.t.cl.config.TrackerDialContext,
-		ListenPacket:        me.t.cl.config.TrackerListenPacket,
+		DialContext:         me.t.cl.trackerDialContext(),
+		ListenPacket:        me.t.cl.trackerListenPacket(),
 		UserAgent:           me.t.cl.config.HTTPUserAgent,
-		TrackerUrl:          me.trackerUrl(ip),
+		TrackerUrl:          trackerUrl,
 		Request:             req,
 		HostHeader:          me.u.Host,
 		ServerName:          me.u.Hostname(),
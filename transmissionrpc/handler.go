@@ -0,0 +1,183 @@
+// Package transmissionrpc implements the core of the Transmission RPC protocol over a
+// torrent.Client, so tools written for Transmission can control it. See
+// https://github.com/transmission/transmission/blob/main/docs/rpc-spec.md.
+package transmissionrpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	sessionIdHeader = "X-Transmission-Session-Id"
+	// The RPC version whose methods and fields are implemented, from Transmission 3.00.
+	rpcVersion        = 16
+	rpcVersionMinimum = 14
+)
+
+// Handles Transmission RPC requests, which are usually made to /transmission/rpc. The zero value
+// is not usable, Client must be set.
+type Handler struct {
+	Client *torrent.Client
+	// Reported as the session's download-dir. It doesn't affect where data is stored.
+	DownloadDir string
+	// Fetches .torrent files given as URLs to torrent-add. Defaults to http.DefaultClient.
+	HttpClient *http.Client
+
+	mu        sync.Mutex
+	sessionId string
+	// Transmission identifies torrents by small integers. They're assigned as torrents are seen,
+	// and aren't reused after a torrent is removed.
+	ids      map[metainfo.Hash]int
+	torrents map[int]*torrentState
+	lastId   int
+}
+
+// What's tracked by the handler for each torrent.
+type torrentState struct {
+	id        int
+	infoHash  metainfo.Hash
+	addedDate time.Time
+	// For calculating transfer rates between torrent-get calls.
+	lastSample   time.Time
+	lastRead     int64
+	lastWritten  int64
+	downloadRate int64
+	uploadRate   int64
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+type request struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       *int64          `json:"tag,omitempty"`
+}
+
+type response struct {
+	// "success", or an error message.
+	Result    string `json:"result"`
+	Arguments any    `json:"arguments"`
+	Tag       *int64 `json:"tag,omitempty"`
+}
+
+func (me *Handler) getSessionId() string {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.sessionId == "" {
+		var b [24]byte
+		rand.Read(b[:])
+		me.sessionId = hex.EncodeToString(b[:])
+	}
+	return me.sessionId
+}
+
+func (me *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Clients are expected to retry with the session ID from a 409 response. This protects
+	// against cross-site request forgery.
+	sessionId := me.getSessionId()
+	w.Header().Set(sessionIdHeader, sessionId)
+	if r.Header.Get(sessionIdHeader) != sessionId {
+		http.Error(w, "invalid session id", http.StatusConflict)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := response{
+		Result: "success",
+		Tag:    req.Tag,
+	}
+	resp.Arguments, err = me.call(req.Method, req.Arguments)
+	if err != nil {
+		resp.Result = err.Error()
+	}
+	if resp.Arguments == nil {
+		resp.Arguments = struct{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (me *Handler) call(method string, args json.RawMessage) (any, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	switch method {
+	case "torrent-add":
+		return me.torrentAdd(args)
+	case "torrent-get":
+		return me.torrentGet(args)
+	case "torrent-set":
+		return nil, me.torrentSet(args)
+	case "torrent-remove":
+		return nil, me.torrentRemove(args)
+	case "torrent-start", "torrent-start-now":
+		return nil, me.forTorrents(args, startTorrent)
+	case "torrent-stop":
+		return nil, me.forTorrents(args, stopTorrent)
+	case "session-get":
+		return me.sessionGet(), nil
+	default:
+		return nil, fmt.Errorf("method name not recognized: %q", method)
+	}
+}
+
+// Returns the state for a torrent, assigning it an ID if it's new.
+func (me *Handler) torrentState(t *torrent.Torrent) *torrentState {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	ih := t.InfoHash()
+	if id, ok := me.ids[ih]; ok {
+		return me.torrents[id]
+	}
+	if me.ids == nil {
+		me.ids = make(map[metainfo.Hash]int)
+		me.torrents = make(map[int]*torrentState)
+	}
+	me.lastId++
+	ts := &torrentState{
+		id:        me.lastId,
+		infoHash:  ih,
+		addedDate: time.Now(),
+	}
+	me.ids[ih] = ts.id
+	me.torrents[ts.id] = ts
+	return ts
+}
+
+// Returns the torrents in the Client that match ids.
+func (me *Handler) selectTorrents(ids ids) (ret []*torrent.Torrent) {
+	for _, t := range me.Client.Torrents() {
+		if ids.matches(me.torrentState(t).id, t.InfoHash().HexString()) {
+			ret = append(ret, t)
+		}
+	}
+	return
+}
+
+func (me *Handler) sessionGet() map[string]any {
+	return map[string]any{
+		"version":             "3.00 (anacrolix/torrent)",
+		"rpc-version":         rpcVersion,
+		"rpc-version-minimum": rpcVersionMinimum,
+		"download-dir":        me.DownloadDir,
+		"session-id":          me.getSessionId(),
+	}
+}
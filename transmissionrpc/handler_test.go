@@ -0,0 +1,159 @@
+package transmissionrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestHandler(t *testing.T) {
+	cfg := torrent.TestingConfig(t)
+	testutil.CreateDummyTorrentData(cfg.DataDir)
+	cl, err := torrent.NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	s := httptest.NewServer(&Handler{Client: cl, DownloadDir: cfg.DataDir})
+	defer s.Close()
+
+	post := func(sessionId string, body any) *http.Response {
+		b, err := json.Marshal(body)
+		qt.Assert(t, qt.IsNil(err))
+		req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(b))
+		qt.Assert(t, qt.IsNil(err))
+		req.Header.Set(sessionIdHeader, sessionId)
+		resp, err := s.Client().Do(req)
+		qt.Assert(t, qt.IsNil(err))
+		return resp
+	}
+
+	// Requests without the session ID are rejected, and the response provides it.
+	resp := post("", request{Method: "session-get"})
+	resp.Body.Close()
+	qt.Assert(t, qt.Equals(resp.StatusCode, http.StatusConflict))
+	sessionId := resp.Header.Get(sessionIdHeader)
+	qt.Assert(t, qt.Not(qt.Equals(sessionId, "")))
+
+	call := func(method string, args any) (result string, ret map[string]json.RawMessage) {
+		b, err := json.Marshal(args)
+		qt.Assert(t, qt.IsNil(err))
+		resp := post(sessionId, request{Method: method, Arguments: b})
+		defer resp.Body.Close()
+		qt.Assert(t, qt.Equals(resp.StatusCode, http.StatusOK))
+		var r struct {
+			Result    string                     `json:"result"`
+			Arguments map[string]json.RawMessage `json:"arguments"`
+		}
+		qt.Assert(t, qt.IsNil(json.NewDecoder(resp.Body).Decode(&r)))
+		return r.Result, r.Arguments
+	}
+
+	result, args := call("session-get", nil)
+	qt.Assert(t, qt.Equals(result, "success"))
+	qt.Check(t, qt.JSONEquals([]byte(args["rpc-version"]), rpcVersion))
+	qt.Check(t, qt.JSONEquals([]byte(args["download-dir"]), cfg.DataDir))
+
+	var mi bytes.Buffer
+	qt.Assert(t, qt.IsNil(testutil.GreetingMetaInfo().Write(&mi)))
+	result, args = call("torrent-add", map[string]any{
+		"metainfo": base64.StdEncoding.EncodeToString(mi.Bytes()),
+	})
+	qt.Assert(t, qt.Equals(result, "success"))
+	var added struct {
+		Id         int    `json:"id"`
+		HashString string `json:"hashString"`
+	}
+	qt.Assert(t, qt.IsNil(json.Unmarshal(args["torrent-added"], &added)))
+	tor, ok := cl.Torrent(testutil.GreetingMetaInfo().HashInfoBytes())
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(added.HashString, tor.InfoHash().HexString()))
+	qt.Assert(t, qt.IsNil(tor.VerifyData()))
+
+	_, args = call("torrent-add", map[string]any{
+		"metainfo": base64.StdEncoding.EncodeToString(mi.Bytes()),
+	})
+	qt.Check(t, qt.IsNotNil(args["torrent-duplicate"]))
+
+	type getTorrent struct {
+		Id          int     `json:"id"`
+		Name        string  `json:"name"`
+		Status      int     `json:"status"`
+		TotalSize   int64   `json:"totalSize"`
+		PercentDone float64 `json:"percentDone"`
+		Wanted      []int   `json:"wanted"`
+	}
+	get := func() getTorrent {
+		result, args := call("torrent-get", map[string]any{
+			"ids":    []any{added.Id},
+			"fields": []string{"id", "name", "status", "totalSize", "percentDone", "wanted", "unknown"},
+		})
+		qt.Assert(t, qt.Equals(result, "success"))
+		var torrents []getTorrent
+		qt.Assert(t, qt.IsNil(json.Unmarshal(args["torrents"], &torrents)))
+		qt.Assert(t, qt.HasLen(torrents, 1))
+		return torrents[0]
+	}
+	got := get()
+	qt.Check(t, qt.Equals(got.Name, "greeting"))
+	qt.Check(t, qt.Equals(got.TotalSize, int64(len(testutil.GreetingFileContents))))
+	qt.Check(t, qt.Equals(got.Status, statusSeed))
+	qt.Check(t, qt.Equals(got.PercentDone, 1.0))
+	qt.Check(t, qt.DeepEquals(got.Wanted, []int{1}))
+
+	result, _ = call("torrent-stop", map[string]any{"ids": added.HashString})
+	qt.Assert(t, qt.Equals(result, "success"))
+	qt.Check(t, qt.Equals(get().Status, statusStopped))
+	call("torrent-start", map[string]any{"ids": added.Id})
+	qt.Check(t, qt.Equals(get().Status, statusSeed))
+
+	result, _ = call("torrent-set", map[string]any{"files-unwanted": []int{0}})
+	qt.Assert(t, qt.Equals(result, "success"))
+	qt.Check(t, qt.DeepEquals(get().Wanted, []int{0}))
+	result, _ = call("torrent-set", map[string]any{"files-wanted": []int{1}})
+	qt.Check(t, qt.Not(qt.Equals(result, "success")))
+
+	result, _ = call("torrent-remove", map[string]any{"ids": []any{added.Id}, "delete-local-data": true})
+	qt.Check(t, qt.Not(qt.Equals(result, "success")))
+	result, _ = call("torrent-remove", map[string]any{"ids": []any{added.Id}})
+	qt.Assert(t, qt.Equals(result, "success"))
+	qt.Check(t, qt.HasLen(cl.Torrents(), 0))
+
+	result, _ = call("no-such-method", nil)
+	qt.Check(t, qt.Not(qt.Equals(result, "success")))
+}
+
+// A removed torrent's ID isn't given to a torrent added later.
+func TestTorrentIdsNotReused(t *testing.T) {
+	cl, err := torrent.NewClient(torrent.TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	h := &Handler{Client: cl}
+	call := func(method string, args any) map[string]any {
+		b, err := json.Marshal(args)
+		qt.Assert(t, qt.IsNil(err))
+		ret, err := h.call(method, b)
+		qt.Assert(t, qt.IsNil(err))
+		m, _ := ret.(map[string]any)
+		return m
+	}
+	add := func(ih string) int {
+		ret := call("torrent-add", map[string]any{"filename": "magnet:?xt=urn:btih:" + ih})
+		return ret["torrent-added"].(map[string]any)["id"].(int)
+	}
+	a := add("0000000000000000000000000000000000000001")
+	b := add("0000000000000000000000000000000000000002")
+	call("torrent-remove", map[string]any{"ids": []any{a}})
+	c := add("0000000000000000000000000000000000000003")
+	qt.Check(t, qt.Not(qt.Equals(c, a)))
+	qt.Check(t, qt.Not(qt.Equals(c, b)))
+	ts := h.selectTorrents(ids{set: true, nums: map[int]bool{b: true}})
+	qt.Assert(t, qt.HasLen(ts, 1))
+	qt.Check(t, qt.Equals(ts[0].InfoHash().HexString(), "0000000000000000000000000000000000000002"))
+}
@@ -0,0 +1,524 @@
+package transmissionrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/types"
+)
+
+// Torrent status values.
+const (
+	statusStopped      = 0
+	statusCheckWait    = 1
+	statusCheck        = 2
+	statusDownloadWait = 3
+	statusDownload     = 4
+	statusSeedWait     = 5
+	statusSeed         = 6
+)
+
+// File priority values.
+const (
+	priorityLow    = -1
+	priorityNormal = 0
+	priorityHigh   = 1
+)
+
+// The ids argument. It can be absent for all torrents, a single ID, a list of IDs and infohashes
+// in hex, or "recently-active", which is treated as all torrents.
+type ids struct {
+	set    bool
+	nums   map[int]bool
+	hashes map[string]bool
+}
+
+func (me *ids) UnmarshalJSON(b []byte) error {
+	var v any
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	me.set = true
+	me.nums = make(map[int]bool)
+	me.hashes = make(map[string]bool)
+	add := func(v any) error {
+		switch v := v.(type) {
+		case float64:
+			me.nums[int(v)] = true
+		case string:
+			me.hashes[strings.ToLower(v)] = true
+		default:
+			return fmt.Errorf("bad id: %v", v)
+		}
+		return nil
+	}
+	switch v := v.(type) {
+	case nil:
+		me.set = false
+	case string:
+		if v == "recently-active" {
+			me.set = false
+			return nil
+		}
+		return add(v)
+	case []any:
+		for _, id := range v {
+			err := add(id)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return add(v)
+	}
+	return nil
+}
+
+func (me ids) matches(id int, hash string) bool {
+	return !me.set || me.nums[id] || me.hashes[hash]
+}
+
+type torrentAddArgs struct {
+	// A path or URL of a .torrent file, or a magnet link.
+	Filename string `json:"filename"`
+	// A base64 encoded .torrent file.
+	Metainfo string `json:"metainfo"`
+	Paused   bool   `json:"paused"`
+}
+
+func (me *Handler) torrentAdd(b json.RawMessage) (any, error) {
+	var args torrentAddArgs
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := me.torrentAddSpec(args)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := me.Client.Torrent(spec.InfoHash); ok {
+		return map[string]any{"torrent-duplicate": me.torrentBrief(t)}, nil
+	}
+	t, _, err := me.Client.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if args.Paused {
+		stopTorrent(t)
+	}
+	if t.Info() != nil {
+		wantAllFiles(t)
+	} else {
+		go func() {
+			select {
+			case <-t.GotInfo():
+				wantAllFiles(t)
+			case <-t.Closed():
+			}
+		}()
+	}
+	return map[string]any{"torrent-added": me.torrentBrief(t)}, nil
+}
+
+// Transmission downloads all files of added torrents. Wanted files are those with a priority.
+func wantAllFiles(t *torrent.Torrent) {
+	for _, f := range t.Files() {
+		if f.Priority() == types.PiecePriorityNone {
+			f.SetPriority(types.PiecePriorityNormal)
+		}
+	}
+}
+
+func (me *Handler) torrentAddSpec(args torrentAddArgs) (*torrent.TorrentSpec, error) {
+	var mi *metainfo.MetaInfo
+	var err error
+	switch {
+	case args.Metainfo != "":
+		var b []byte
+		b, err = base64.StdEncoding.DecodeString(args.Metainfo)
+		if err != nil {
+			return nil, fmt.Errorf("decoding metainfo: %w", err)
+		}
+		mi, err = metainfo.Load(bytes.NewReader(b))
+	case strings.HasPrefix(args.Filename, "magnet:"):
+		return torrent.TorrentSpecFromMagnetUri(args.Filename)
+	case strings.HasPrefix(args.Filename, "http://"), strings.HasPrefix(args.Filename, "https://"):
+		mi, err = me.fetchMetainfo(args.Filename)
+	case args.Filename != "":
+		mi, err = metainfo.LoadFromFile(args.Filename)
+	default:
+		return nil, errors.New("no filename or metainfo")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading metainfo: %w", err)
+	}
+	return torrent.TorrentSpecFromMetaInfoErr(mi)
+}
+
+func (me *Handler) fetchMetainfo(url string) (*metainfo.MetaInfo, error) {
+	httpClient := me.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	return metainfo.Load(resp.Body)
+}
+
+// The fields returned for added torrents.
+func (me *Handler) torrentBrief(t *torrent.Torrent) map[string]any {
+	return map[string]any{
+		"id":         me.torrentState(t).id,
+		"name":       t.Name(),
+		"hashString": t.InfoHash().HexString(),
+	}
+}
+
+type torrentGetArgs struct {
+	Fields []string `json:"fields"`
+	Ids    ids      `json:"ids"`
+}
+
+func (me *Handler) torrentGet(b json.RawMessage) (any, error) {
+	var args torrentGetArgs
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return nil, err
+	}
+	torrents := []map[string]any{}
+	now := time.Now()
+	for _, t := range me.selectTorrents(args.Ids) {
+		ts := me.torrentState(t)
+		me.mu.Lock()
+		ts.sample(now, t.Stats())
+		me.mu.Unlock()
+		g := torrentGetter{t: t, ts: ts, h: me}
+		fields := make(map[string]any, len(args.Fields))
+		for _, name := range args.Fields {
+			if f, ok := torrentFields[name]; ok {
+				fields[name] = f(&g)
+			}
+		}
+		torrents = append(torrents, fields)
+	}
+	return map[string]any{"torrents": torrents}, nil
+}
+
+// Updates transfer rates, if enough time has passed since the last sample.
+func (me *torrentState) sample(now time.Time, stats torrent.TorrentStats) {
+	read := stats.BytesReadUsefulData.Int64()
+	written := stats.BytesWrittenData.Int64()
+	elapsed := now.Sub(me.lastSample)
+	if elapsed < time.Second {
+		return
+	}
+	if !me.lastSample.IsZero() {
+		me.downloadRate = int64(float64(read-me.lastRead) / elapsed.Seconds())
+		me.uploadRate = int64(float64(written-me.lastWritten) / elapsed.Seconds())
+	}
+	me.lastSample = now
+	me.lastRead = read
+	me.lastWritten = written
+}
+
+// Computes torrent-get fields for a torrent. Values shared between fields are computed once.
+type torrentGetter struct {
+	t     *torrent.Torrent
+	ts    *torrentState
+	h     *Handler
+	stats *torrent.TorrentStats
+	// Bytes in wanted files, and how many of them are complete.
+	wanted, wantedDone *int64
+}
+
+func (me *torrentGetter) getStats() *torrent.TorrentStats {
+	if me.stats == nil {
+		stats := me.t.Stats()
+		me.stats = &stats
+	}
+	return me.stats
+}
+
+func (me *torrentGetter) getWanted() (wanted, done int64) {
+	if me.wanted == nil {
+		if me.t.Info() != nil {
+			for _, f := range me.t.Files() {
+				if f.Priority() != types.PiecePriorityNone {
+					wanted += f.Length()
+					done += f.BytesCompleted()
+				}
+			}
+		}
+		me.wanted, me.wantedDone = &wanted, &done
+	}
+	return *me.wanted, *me.wantedDone
+}
+
+func (me *torrentGetter) leftUntilDone() int64 {
+	wanted, done := me.getWanted()
+	return wanted - done
+}
+
+// Whether there's nothing left to download. With nothing wanted, that requires all the data.
+func (me *torrentGetter) seeding() bool {
+	wanted, _ := me.getWanted()
+	return wanted != 0 || me.t.BytesCompleted() >= me.t.Length()
+}
+
+func (me *torrentGetter) status() int {
+	switch {
+	case me.t.DataDownloadDisallowed():
+		return statusStopped
+	case me.t.Info() != nil && me.leftUntilDone() == 0 && me.seeding():
+		return statusSeed
+	default:
+		return statusDownload
+	}
+}
+
+func (me *torrentGetter) files() (ret []*torrent.File) {
+	if me.t.Info() != nil {
+		ret = me.t.Files()
+	}
+	return
+}
+
+func filePriority(f *torrent.File) int {
+	if f.Priority() >= types.PiecePriorityHigh {
+		return priorityHigh
+	}
+	return priorityNormal
+}
+
+var torrentFields = map[string]func(*torrentGetter) any{
+	"id":         func(g *torrentGetter) any { return g.ts.id },
+	"hashString": func(g *torrentGetter) any { return g.t.InfoHash().HexString() },
+	"name":       func(g *torrentGetter) any { return g.t.Name() },
+	"addedDate":  func(g *torrentGetter) any { return g.ts.addedDate.Unix() },
+	"status":     func(g *torrentGetter) any { return g.status() },
+	"downloadDir": func(g *torrentGetter) any {
+		return g.h.DownloadDir
+	},
+	"error":       func(g *torrentGetter) any { return 0 },
+	"errorString": func(g *torrentGetter) any { return "" },
+	"isFinished":  func(g *torrentGetter) any { return false },
+	"isStalled":   func(g *torrentGetter) any { return false },
+	"totalSize": func(g *torrentGetter) any {
+		if g.t.Info() == nil {
+			return 0
+		}
+		return g.t.Length()
+	},
+	"sizeWhenDone": func(g *torrentGetter) any {
+		wanted, _ := g.getWanted()
+		return wanted
+	},
+	"leftUntilDone": func(g *torrentGetter) any { return g.leftUntilDone() },
+	"haveValid":     func(g *torrentGetter) any { return g.t.BytesCompleted() },
+	"percentDone": func(g *torrentGetter) any {
+		wanted, done := g.getWanted()
+		if wanted == 0 {
+			return 0
+		}
+		return float64(done) / float64(wanted)
+	},
+	"metadataPercentComplete": func(g *torrentGetter) any {
+		if g.t.Info() == nil {
+			return 0
+		}
+		return 1
+	},
+	"rateDownload": func(g *torrentGetter) any { return g.ts.downloadRate },
+	"rateUpload":   func(g *torrentGetter) any { return g.ts.uploadRate },
+	"eta": func(g *torrentGetter) any {
+		left := g.leftUntilDone()
+		switch {
+		case left == 0:
+			return 0
+		case g.ts.downloadRate <= 0:
+			// Unknown.
+			return -1
+		default:
+			return left / g.ts.downloadRate
+		}
+	},
+	"downloadedEver": func(g *torrentGetter) any {
+		return g.getStats().BytesReadUsefulData.Int64()
+	},
+	"uploadedEver": func(g *torrentGetter) any {
+		return g.getStats().BytesWrittenData.Int64()
+	},
+	"peersConnected": func(g *torrentGetter) any { return g.getStats().ActivePeers },
+	"pieceCount":     func(g *torrentGetter) any { return g.t.NumPieces() },
+	"pieceSize": func(g *torrentGetter) any {
+		if info := g.t.Info(); info != nil {
+			return info.PieceLength
+		}
+		return 0
+	},
+	"magnetLink": func(g *torrentGetter) any {
+		ih := g.t.InfoHash()
+		mi := g.t.Metainfo()
+		return mi.Magnet(&ih, g.t.Info()).String()
+	},
+	"files": func(g *torrentGetter) any {
+		ret := []map[string]any{}
+		for _, f := range g.files() {
+			ret = append(ret, map[string]any{
+				"name":           f.Path(),
+				"length":         f.Length(),
+				"bytesCompleted": f.BytesCompleted(),
+			})
+		}
+		return ret
+	},
+	"fileStats": func(g *torrentGetter) any {
+		ret := []map[string]any{}
+		for _, f := range g.files() {
+			ret = append(ret, map[string]any{
+				"bytesCompleted": f.BytesCompleted(),
+				"wanted":         f.Priority() != types.PiecePriorityNone,
+				"priority":       filePriority(f),
+			})
+		}
+		return ret
+	},
+	"wanted": func(g *torrentGetter) any {
+		ret := []int{}
+		for _, f := range g.files() {
+			if f.Priority() != types.PiecePriorityNone {
+				ret = append(ret, 1)
+			} else {
+				ret = append(ret, 0)
+			}
+		}
+		return ret
+	},
+	"priorities": func(g *torrentGetter) any {
+		ret := []int{}
+		for _, f := range g.files() {
+			ret = append(ret, filePriority(f))
+		}
+		return ret
+	},
+}
+
+type torrentSetArgs struct {
+	Ids            ids   `json:"ids"`
+	FilesWanted    []int `json:"files-wanted"`
+	FilesUnwanted  []int `json:"files-unwanted"`
+	PriorityHigh   []int `json:"priority-high"`
+	PriorityNormal []int `json:"priority-normal"`
+	// There's no low priority, so it's treated as normal.
+	PriorityLow []int `json:"priority-low"`
+}
+
+func (me *Handler) torrentSet(b json.RawMessage) error {
+	var args torrentSetArgs
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return err
+	}
+	for _, t := range me.selectTorrents(args.Ids) {
+		if t.Info() == nil {
+			continue
+		}
+		files := t.Files()
+		apply := func(indexes []int, f func(*torrent.File)) error {
+			for _, i := range indexes {
+				if i < 0 || i >= len(files) {
+					return fmt.Errorf("file index %v out of range", i)
+				}
+				f(files[i])
+			}
+			return nil
+		}
+		// Wanted files keep their priority, and priorities only apply to wanted files.
+		setIfWanted := func(prio types.PiecePriority) func(*torrent.File) {
+			return func(f *torrent.File) {
+				if f.Priority() != types.PiecePriorityNone {
+					f.SetPriority(prio)
+				}
+			}
+		}
+		err := errors.Join(
+			apply(args.FilesUnwanted, func(f *torrent.File) { f.SetPriority(types.PiecePriorityNone) }),
+			apply(args.FilesWanted, func(f *torrent.File) {
+				if f.Priority() == types.PiecePriorityNone {
+					f.SetPriority(types.PiecePriorityNormal)
+				}
+			}),
+			apply(args.PriorityHigh, setIfWanted(types.PiecePriorityHigh)),
+			apply(args.PriorityNormal, setIfWanted(types.PiecePriorityNormal)),
+			apply(args.PriorityLow, setIfWanted(types.PiecePriorityNormal)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type torrentRemoveArgs struct {
+	Ids             ids  `json:"ids"`
+	DeleteLocalData bool `json:"delete-local-data"`
+}
+
+func (me *Handler) torrentRemove(b json.RawMessage) error {
+	var args torrentRemoveArgs
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return err
+	}
+	if args.DeleteLocalData {
+		// Storage implementations don't support deleting data.
+		return errors.New("delete-local-data is not supported")
+	}
+	for _, t := range me.selectTorrents(args.Ids) {
+		t.Drop()
+		me.mu.Lock()
+		delete(me.torrents, me.ids[t.InfoHash()])
+		delete(me.ids, t.InfoHash())
+		me.mu.Unlock()
+	}
+	return nil
+}
+
+func (me *Handler) forTorrents(b json.RawMessage, f func(*torrent.Torrent)) error {
+	var args struct {
+		Ids ids `json:"ids"`
+	}
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return err
+	}
+	for _, t := range me.selectTorrents(args.Ids) {
+		f(t)
+	}
+	return nil
+}
+
+func startTorrent(t *torrent.Torrent) {
+	t.AllowDataDownload()
+	t.AllowDataUpload()
+}
+
+func stopTorrent(t *torrent.Torrent) {
+	t.DisallowDataDownload()
+	t.DisallowDataUpload()
+}
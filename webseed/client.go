@@ -8,7 +8,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RoaringBitmap/roaring"
 
@@ -24,6 +26,8 @@ type requestPart struct {
 	do  func() (*http.Response, error)
 	// Wrap http response bodies for such things as download rate limiting.
 	responseBodyWrapper ResponseBodyWrapper
+
+	fileIndex int
 }
 
 type Request struct {
@@ -54,6 +58,27 @@ type Client struct {
 
 type ResponseBodyWrapper func(io.Reader) io.Reader
 
+// Removes the pieces overlapping the file from Pieces, so they aren't requested from this webseed.
+// Returns the pieces that were removed.
+func (me *Client) DisableFile(fileIndex int) (removed []int) {
+	if me.info == nil {
+		return
+	}
+	fi := me.info.UpvertedFiles()[fileIndex]
+	if fi.Length == 0 {
+		return
+	}
+	pieceLength := me.info.PieceLength
+	begin := fi.TorrentOffset / pieceLength
+	end := (fi.TorrentOffset + fi.Length + pieceLength - 1) / pieceLength
+	for i := begin; i < end; i++ {
+		if me.Pieces.CheckedRemove(uint32(i)) {
+			removed = append(removed, int(i))
+		}
+	}
+	return
+}
+
 func (me *Client) SetInfo(info *metainfo.Info) {
 	if !strings.HasSuffix(me.Url, "/") && info.IsDir() {
 		// In my experience, this is a non-conforming webseed. For example the
@@ -70,9 +95,66 @@ type RequestResult struct {
 	Err   error
 }
 
+// Buffers the whole response. See StartNewStreamingRequest to handle the data as it arrives.
 func (ws *Client) StartNewRequest(r RequestSpec) Request {
 	ctx, cancel := context.WithCancel(context.TODO())
-	var requestParts []requestPart
+	requestParts := ws.requestParts(ctx, r)
+	req := Request{
+		cancel: cancel,
+		Result: make(chan RequestResult, 1),
+	}
+	go func() {
+		var buf bytes.Buffer
+		err := readRequestPartResponses(ctx, &buf, requestParts)
+		req.Result <- RequestResult{
+			Bytes: buf.Bytes(),
+			Err:   err,
+		}
+	}()
+	return req
+}
+
+// A request whose response data is read from Body as it arrives.
+type StreamingRequest struct {
+	cancel func()
+	// Returns the data for the requested extent in order, and then io.EOF. Reads return the
+	// request's error if it fails partway through.
+	Body io.ReadCloser
+}
+
+func (r StreamingRequest) Cancel() {
+	r.cancel()
+}
+
+// Starts a request for the extent, that's streamed instead of buffered, so memory use is bounded
+// by the reader. Body must be closed to release the request.
+func (ws *Client) StartNewStreamingRequest(r RequestSpec) StreamingRequest {
+	ctx, cancel := context.WithCancel(context.TODO())
+	requestParts := ws.requestParts(ctx, r)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(readRequestPartResponses(ctx, pw, requestParts))
+	}()
+	return StreamingRequest{
+		cancel: cancel,
+		Body: streamingRequestBody{
+			PipeReader: pr,
+			cancel:     cancel,
+		},
+	}
+}
+
+type streamingRequestBody struct {
+	*io.PipeReader
+	cancel func()
+}
+
+func (me streamingRequestBody) Close() error {
+	me.cancel()
+	return me.PipeReader.Close()
+}
+
+func (ws *Client) requestParts(ctx context.Context, r RequestSpec) (requestParts []requestPart) {
 	if !ws.fileIndex.Locate(r, func(i int, e segments.Extent) bool {
 		req, err := newRequest(
 			ctx,
@@ -84,6 +166,7 @@ func (ws *Client) StartNewRequest(r RequestSpec) Request {
 		}
 		part := requestPart{
 			req:                 req,
+			fileIndex:           i,
 			e:                   e,
 			responseBodyWrapper: ws.ResponseBodyWrapper,
 		}
@@ -95,18 +178,7 @@ func (ws *Client) StartNewRequest(r RequestSpec) Request {
 	}) {
 		panic("request out of file bounds")
 	}
-	req := Request{
-		cancel: cancel,
-		Result: make(chan RequestResult, 1),
-	}
-	go func() {
-		b, err := readRequestPartResponses(ctx, requestParts)
-		req.Result <- RequestResult{
-			Bytes: b,
-			Err:   err,
-		}
-	}()
-	return req
+	return
 }
 
 type ErrBadResponse struct {
@@ -163,8 +235,13 @@ func recvPartResult(ctx context.Context, buf io.Writer, part requestPart, resp *
 		} else {
 			return ErrBadResponse{"resp status ok but requested range", resp}
 		}
-	case http.StatusServiceUnavailable:
-		return ErrTooFast
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		return ErrRetryAfter{parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	case http.StatusNotFound, http.StatusGone:
+		return ErrFileNotFound{
+			FileIndex:  part.fileIndex,
+			StatusCode: resp.StatusCode,
+		}
 	default:
 		return ErrBadResponse{
 			fmt.Sprintf("unhandled response status code (%v)", resp.StatusCode),
@@ -175,14 +252,56 @@ func recvPartResult(ctx context.Context, buf io.Writer, part requestPart, resp *
 
 var ErrTooFast = errors.New("making requests too fast")
 
-func readRequestPartResponses(ctx context.Context, parts []requestPart) (_ []byte, err error) {
-	var buf bytes.Buffer
+// The webseed asked us to slow down. This matches ErrTooFast.
+type ErrRetryAfter struct {
+	// From the Retry-After header. Zero if it wasn't given.
+	Duration time.Duration
+}
+
+func (me ErrRetryAfter) Error() string {
+	if me.Duration == 0 {
+		return ErrTooFast.Error()
+	}
+	return fmt.Sprintf("%v (retry after %v)", ErrTooFast, me.Duration)
+}
+
+func (me ErrRetryAfter) Is(target error) bool {
+	return target == ErrTooFast
+}
+
+// Retry-After is either a number of seconds, or an HTTP date.
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// The webseed doesn't have a file, such as for 404 and 410 responses. See Client.DisableFile.
+type ErrFileNotFound struct {
+	// Index into the info's upverted files.
+	FileIndex  int
+	StatusCode int
+}
+
+func (me ErrFileNotFound) Error() string {
+	return fmt.Sprintf("file %v not found (%v)", me.FileIndex, me.StatusCode)
+}
+
+// Writes the responses for the parts to w in order.
+func readRequestPartResponses(ctx context.Context, w io.Writer, parts []requestPart) (err error) {
 	for _, part := range parts {
 		var resp *http.Response
 		resp, err = part.do()
 
 		if err == nil {
-			err = recvPartResult(ctx, &buf, part, resp)
+			err = recvPartResult(ctx, w, part, resp)
 		}
 
 		if err != nil {
@@ -190,5 +309,5 @@ func readRequestPartResponses(ctx context.Context, parts []requestPart) (_ []byt
 			break
 		}
 	}
-	return buf.Bytes(), err
+	return
 }
@@ -0,0 +1,81 @@
+package webseed
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	c := &Client{
+		HttpClient: s.Client(),
+		Url:        s.URL + "/file",
+	}
+	c.SetInfo(&metainfo.Info{
+		Name:        "file",
+		Length:      100,
+		PieceLength: 100,
+		Pieces:      make([]byte, metainfo.HashSize),
+	})
+	return c
+}
+
+func TestStreamingRequest(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	req := c.StartNewStreamingRequest(RequestSpec{Start: 10, Length: 50})
+	defer req.Body.Close()
+	b, err := io.ReadAll(req.Body)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(b, data[10:60]))
+}
+
+func TestStreamingRequestPartialFailure(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "50")
+		w.WriteHeader(http.StatusPartialContent)
+		// The connection is dropped partway through.
+		w.Write(make([]byte, 20))
+	}))
+	req := c.StartNewStreamingRequest(RequestSpec{Start: 10, Length: 50})
+	defer req.Body.Close()
+	b, err := io.ReadAll(req.Body)
+	qt.Check(t, qt.IsNotNil(err))
+	// What did arrive is available before the error.
+	qt.Check(t, qt.HasLen(b, 20))
+}
+
+func TestStreamingRequestCancel(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "50")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(make([]byte, 20))
+		w.(http.Flusher).Flush()
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	req := c.StartNewStreamingRequest(RequestSpec{Start: 10, Length: 50})
+	defer req.Body.Close()
+	b := make([]byte, 20)
+	_, err := io.ReadFull(req.Body, b)
+	qt.Assert(t, qt.IsNil(err))
+	req.Cancel()
+	_, err = req.Body.Read(b)
+	qt.Check(t, qt.ErrorIs(err, context.Canceled))
+}
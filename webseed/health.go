@@ -0,0 +1,127 @@
+package webseed
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 5 * time.Minute
+	// How long throughput is measured for before adjusting concurrency.
+	concurrencyWindow = 5 * time.Second
+)
+
+// Tracks how a webseed is behaving, to decide when to make requests to it and how many at once.
+// Failures back off exponentially, and concurrency is adjusted to find the best throughput. It's
+// not safe for concurrent use.
+type Health struct {
+	// The upper bound on concurrency. At least 1.
+	MaxConcurrency int
+	// Default to 1s and 5m.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	concurrency         int
+	consecutiveFailures int
+	backoffUntil        time.Time
+	lastErr             error
+
+	windowStart    time.Time
+	windowBytes    int64
+	lastThroughput float64
+	// The last change to concurrency: -1, 0 or 1.
+	direction int
+}
+
+// The number of requests that should be active at once.
+func (me *Health) Concurrency() int {
+	if me.concurrency == 0 {
+		// Start in the middle, so there's room to move either way.
+		me.concurrency = max(1, (me.MaxConcurrency+1)/2)
+	}
+	return me.concurrency
+}
+
+// No new requests should be started before this time.
+func (me *Health) BackoffUntil() time.Time {
+	return me.backoffUntil
+}
+
+// Data was received.
+func (me *Health) OnData(now time.Time, n int64) {
+	if me.windowStart.IsZero() {
+		me.windowStart = now
+	}
+	me.windowBytes += n
+	elapsed := now.Sub(me.windowStart)
+	if elapsed < concurrencyWindow {
+		return
+	}
+	throughput := float64(me.windowBytes) / elapsed.Seconds()
+	me.windowStart = now
+	me.windowBytes = 0
+	switch {
+	case me.direction == 0 || throughput > me.lastThroughput*1.05:
+		// Keep going while it helps, and probe upward when we haven't moved.
+		if me.direction == 0 {
+			me.direction = 1
+		}
+	case throughput < me.lastThroughput*0.95:
+		me.direction = -me.direction
+	default:
+		me.direction = 0
+	}
+	me.lastThroughput = throughput
+	me.setConcurrency(me.Concurrency() + me.direction)
+}
+
+func (me *Health) setConcurrency(c int) {
+	me.concurrency = max(1, min(c, me.MaxConcurrency))
+}
+
+// A request completed.
+func (me *Health) OnSuccess() {
+	me.consecutiveFailures = 0
+}
+
+// A request failed. Returns the time to wait before making more requests.
+func (me *Health) OnError(now time.Time, err error) time.Duration {
+	me.consecutiveFailures++
+	me.lastErr = err
+	minBackoff := me.MinBackoff
+	if minBackoff == 0 {
+		minBackoff = defaultMinBackoff
+	}
+	maxBackoff := me.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	backoff := minBackoff << min(me.consecutiveFailures-1, 30)
+	if backoff <= 0 || backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	var retryAfter ErrRetryAfter
+	if errors.As(err, &retryAfter) {
+		// The server wants fewer requests.
+		me.setConcurrency(me.Concurrency() / 2)
+		me.direction = 0
+		backoff = max(backoff, retryAfter.Duration)
+	}
+	me.backoffUntil = now.Add(backoff)
+	return backoff
+}
+
+func (me *Health) StatusLines(now time.Time) (ret []string) {
+	ret = append(ret, fmt.Sprintf("concurrency: %v/%v, throughput: %.0f B/s",
+		me.Concurrency(), me.MaxConcurrency, me.lastThroughput))
+	if me.consecutiveFailures != 0 {
+		ret = append(ret, fmt.Sprintf("consecutive failures: %v, last: %v",
+			me.consecutiveFailures, me.lastErr))
+	}
+	if wait := me.backoffUntil.Sub(now); wait > 0 {
+		ret = append(ret, fmt.Sprintf("backing off for %v", wait.Round(time.Second)))
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package webseed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+func TestHealthBackoff(t *testing.T) {
+	h := Health{MaxConcurrency: 8, MaxBackoff: 10 * time.Second}
+	now := time.Unix(0, 0)
+	err := errors.New("boom")
+	for _, expected := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		qt.Check(t, qt.Equals(h.OnError(now, err), expected*time.Second))
+	}
+	qt.Check(t, qt.Equals(h.BackoffUntil(), now.Add(10*time.Second)))
+	h.OnSuccess()
+	qt.Check(t, qt.Equals(h.OnError(now, err), time.Second))
+	// Throttling honours Retry-After, and halves concurrency.
+	qt.Check(t, qt.Equals(h.Concurrency(), 4))
+	qt.Check(t, qt.Equals(h.OnError(now, fmt.Errorf("wrapped: %w", ErrRetryAfter{time.Minute})), time.Minute))
+	qt.Check(t, qt.Equals(h.Concurrency(), 2))
+}
+
+func TestHealthAdaptiveConcurrency(t *testing.T) {
+	h := Health{MaxConcurrency: 8}
+	now := time.Unix(0, 0)
+	qt.Assert(t, qt.Equals(h.Concurrency(), 4))
+	window := func(bytes int64) int {
+		h.OnData(now, 0)
+		now = now.Add(concurrencyWindow)
+		h.OnData(now, bytes)
+		return h.Concurrency()
+	}
+	// Probes upward, and keeps going while throughput improves.
+	qt.Check(t, qt.Equals(window(1000), 5))
+	qt.Check(t, qt.Equals(window(2000), 6))
+	// Reverses when it gets worse.
+	qt.Check(t, qt.Equals(window(1000), 5))
+	qt.Check(t, qt.Equals(window(1500), 4))
+	// Bounded.
+	for range 10 {
+		window(1)
+	}
+	qt.Check(t, qt.IsTrue(h.Concurrency() >= 1 && h.Concurrency() <= 8))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	qt.Check(t, qt.Equals(parseRetryAfter("120", now), 2*time.Minute))
+	qt.Check(t, qt.Equals(parseRetryAfter(now.Add(time.Hour).Format(http.TimeFormat), now), time.Hour))
+	qt.Check(t, qt.Equals(parseRetryAfter("soon", now), 0))
+	qt.Check(t, qt.Equals(parseRetryAfter("", now), 0))
+}
+
+func TestResponseErrors(t *testing.T) {
+	var status int
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(status)
+	}))
+	read := func() error {
+		req := c.StartNewStreamingRequest(RequestSpec{Start: 0, Length: 10})
+		defer req.Body.Close()
+		_, err := req.Body.Read(make([]byte, 10))
+		return err
+	}
+	status = http.StatusServiceUnavailable
+	err := read()
+	qt.Check(t, qt.ErrorIs(err, ErrTooFast))
+	var retryAfter ErrRetryAfter
+	qt.Assert(t, qt.ErrorAs(err, &retryAfter))
+	qt.Check(t, qt.Equals(retryAfter.Duration, 30*time.Second))
+	status = http.StatusGone
+	var notFound ErrFileNotFound
+	qt.Assert(t, qt.ErrorAs(read(), &notFound))
+	qt.Check(t, qt.Equals(notFound.FileIndex, 0))
+	qt.Check(t, qt.DeepEquals(c.DisableFile(notFound.FileIndex), []int{0}))
+	qt.Check(t, qt.IsTrue(c.Pieces.IsEmpty()))
+}